@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// accountState caches the latest pushes of the positions and account channels
+type accountState struct {
+	mu        sync.Mutex
+	positions map[string]WSPosition // by instId
+	accounts  map[string]WSAccount  // by margin coin
+	updated   chan struct{}         // closed and replaced on every positions push
+}
+
+// SubscribeAccountState subscribes to the private positions and account
+// channels and keeps their latest state in memory
+func (c *WebsocketClient) SubscribeAccountState() error {
+	c.state.mu.Lock()
+	c.state.positions = make(map[string]WSPosition)
+	c.state.accounts = make(map[string]WSAccount)
+	c.state.updated = make(chan struct{})
+	c.state.mu.Unlock()
+
+	positionsArg := WSSubscription{InstType: c.InstType(), Channel: "positions", InstId: "default"}
+	if err := c.Subscribe(positionsArg, c.handlePositions); err != nil {
+		return err
+	}
+	accountArg := WSSubscription{InstType: c.InstType(), Channel: "account", Coin: "default"}
+	return c.Subscribe(accountArg, c.handleAccount)
+}
+
+func (c *WebsocketClient) handlePositions(data []byte) {
+	var positions []WSPosition
+	if err := json.Unmarshal(data, &positions); err != nil {
+		log.Printf("Failed to parse positions update: %v \n update data: %s", err, string(data))
+		return
+	}
+
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+
+	// every push is a snapshot of all open positions, closed ones are omitted
+	c.state.positions = make(map[string]WSPosition, len(positions))
+	for _, position := range positions {
+		c.state.positions[position.InstId] = position
+	}
+	close(c.state.updated)
+	c.state.updated = make(chan struct{})
+}
+
+func (c *WebsocketClient) handleAccount(data []byte) {
+	var accounts []WSAccount
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		log.Printf("Failed to parse account update: %v \n update data: %s", err, string(data))
+		return
+	}
+
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+	for _, account := range accounts {
+		c.state.accounts[account.MarginCoin] = account
+	}
+}
+
+// Position returns the cached position for symbol
+func (c *WebsocketClient) Position(symbol string) (*Position, bool) {
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+
+	wsPosition, ok := c.state.positions[symbol]
+	if !ok {
+		return nil, false
+	}
+	position := wsPosition.ToPosition()
+	return &position, true
+}
+
+// Account returns the cached account for marginCoin
+func (c *WebsocketClient) Account(marginCoin string) (*WSAccount, bool) {
+	c.state.mu.Lock()
+	defer c.state.mu.Unlock()
+
+	account, ok := c.state.accounts[marginCoin]
+	if !ok {
+		return nil, false
+	}
+	return &account, true
+}
+
+// WaitForPositionUpdate blocks until a position for symbol has been pushed
+// that was last updated at or after since, or the timeout expires
+func (c *WebsocketClient) WaitForPositionUpdate(symbol string, since time.Time, timeout time.Duration) (*Position, error) {
+	deadline := c.getClock().After(timeout)
+	for {
+		c.state.mu.Lock()
+		if c.state.updated == nil {
+			c.state.mu.Unlock()
+			return nil, fmt.Errorf("not subscribed to account state")
+		}
+		position, ok := c.state.positions[symbol]
+		updated := c.state.updated
+		c.state.mu.Unlock()
+
+		if ok {
+			uTime, err := strconv.ParseInt(position.UTime, 10, 64)
+			if err == nil && !time.UnixMilli(uTime).Before(since) {
+				result := position.ToPosition()
+				return &result, nil
+			}
+		}
+
+		select {
+		case <-updated:
+		case <-deadline:
+			return nil, fmt.Errorf("no position update for %s since %s within %s", symbol, since.Format(time.RFC3339), timeout)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -20,6 +21,7 @@ const (
 	apiPath = "/api/v2/mix"
 	//wsEndpoint             = "wss://ws.bitget.com/mix/v1/stream"
 	wsEndpoint             = "wss://ws.bitget.com/v2/ws/private"
+	wsPublicEndpoint       = "wss://ws.bitget.com/v2/ws/public"
 	productTypeDemoFutures = "susdt-futures"
 	productTypeLiveFutures = "usdt-futures"
 	marginCoinDemo         = "SUSDT"
@@ -61,6 +63,18 @@ type Client struct {
 	passphrase    string
 	isDemoTrading bool
 	httpClient    *http.Client
+	tap           RequestTap
+}
+
+// RequestTap observes the raw REST requests and responses, e.g. to record
+// them. Headers, which carry the credentials, are not passed. response is nil
+// if the request failed without one.
+type RequestTap func(method, path string, body, response []byte, err error)
+
+// SetTap registers a handler observing every request, it must be set before
+// the client is used
+func (c *Client) SetTap(tap RequestTap) {
+	c.tap = tap
 }
 
 func NewClient(apiKey, secretKey, passphrase string, isDemoTrading bool) *Client {
@@ -108,6 +122,19 @@ func (c *Client) doRequest(method, path string, body interface{}) ([]byte, error
 		bodyStr = string(bodyBytes)
 	}
 
+	respBody, err := c.send(method, path, bodyStr)
+	if c.tap != nil {
+		response := respBody
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			response = []byte(apiErr.Body)
+		}
+		c.tap(method, apiPath+path, []byte(bodyStr), response, err)
+	}
+	return respBody, err
+}
+
+func (c *Client) send(method, path, bodyStr string) ([]byte, error) {
 	fullURL := baseURL + apiPath + path
 	req, err := http.NewRequest(method, fullURL, bytes.NewBuffer([]byte(bodyStr)))
 	if err != nil {
@@ -131,7 +158,16 @@ func (c *Client) doRequest(method, path string, body interface{}) ([]byte, error
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(respBody))
+		apiErr := &APIError{Status: resp.StatusCode, Body: string(respBody)}
+		var errResp struct {
+			Code string `json:"code"`
+			Msg  string `json:"msg"`
+		}
+		if json.Unmarshal(respBody, &errResp) == nil {
+			apiErr.Code = errResp.Code
+			apiErr.Msg = errResp.Msg
+		}
+		return nil, apiErr
 	}
 
 	return respBody, nil
@@ -166,6 +202,19 @@ func (c *Client) GetCurrentPrice(symbol string) (float64, error) {
 }
 
 func (c *Client) GetPosition(symbol string) (*Position, error) {
+	positions, err := c.GetPositions(symbol)
+	if err != nil {
+		return nil, err
+	}
+	if len(positions) > 0 {
+		return &positions[0], nil
+	}
+	return nil, ErrNoPosition
+}
+
+// GetPositions returns the open positions of symbol, one per hold side in
+// hedge mode
+func (c *Client) GetPositions(symbol string) ([]Position, error) {
 	if err := c.validateSymbol(symbol); err != nil {
 		return nil, err
 	}
@@ -188,11 +237,7 @@ func (c *Client) GetPosition(symbol string) (*Position, error) {
 		return nil, fmt.Errorf("order placement failed: %s", positionResp.Msg)
 	}
 
-	if len(positionResp.Data) > 0 {
-		return &positionResp.Data[0], nil
-	}
-
-	return nil, errors.New("no position data available")
+	return positionResp.Data, nil
 }
 
 func (c *Client) GetAllPositions() ([]Position, error) {
@@ -224,22 +269,45 @@ func (c *Client) GetPendingOrders(symbol string) ([]Order, error) {
 
 	productType := c.getProductType()
 
-	path := fmt.Sprintf("/order/orders-pending?symbol=%s&productType=%s", symbol, productType)
-	respBody, err := c.doRequest("GET", path, nil)
-	if err != nil {
-		return nil, err
-	}
+	// the pending orders come in pages, newest first
+	const limit = 100
+	var orders []Order
+	idLessThan := ""
+	for {
+		path := fmt.Sprintf("/order/orders-pending?symbol=%s&productType=%s&limit=%d", symbol, productType, limit)
+		if idLessThan != "" {
+			path += "&idLessThan=" + idLessThan
+		}
+		respBody, err := c.doRequest("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
 
-	var ordersListResponse OrderListResponse
-	if err := json.Unmarshal(respBody, &ordersListResponse); err != nil {
-		return nil, err
-	}
+		var ordersListResponse OrderListResponse
+		if err := json.Unmarshal(respBody, &ordersListResponse); err != nil {
+			return nil, err
+		}
+		if ordersListResponse.Code != "00000" {
+			return nil, fmt.Errorf("pending orders request failed: %s", ordersListResponse.Msg)
+		}
 
-	return ordersListResponse.Data.EntrustedList, nil
+		page := ordersListResponse.Data.EntrustedList
+		orders = append(orders, page...)
+		if len(page) < limit || ordersListResponse.Data.EndId == "" {
+			return orders, nil
+		}
+		idLessThan = ordersListResponse.Data.EndId
+	}
 }
 
 func (c *Client) PlaceLimitOrder(symbol string, side string, price float64, size float64) (string, error) {
-	if err := c.validateSymbol(symbol); err != nil {
+	return c.PlaceOrder(LimitOrder{Symbol: symbol, Side: side, Price: price, Size: size})
+}
+
+// PlaceOrder places a limit order. A client order id makes retries over
+// another transport safe, as the exchange rejects duplicates.
+func (c *Client) PlaceOrder(order LimitOrder) (string, error) {
+	if err := c.validateSymbol(order.Symbol); err != nil {
 		return "", err
 	}
 
@@ -247,18 +315,19 @@ func (c *Client) PlaceLimitOrder(symbol string, side string, price float64, size
 	marginCoin := c.getMarginCoin()
 
 	orderReq := OrderRequest{
-		Symbol:      symbol,
+		Symbol:      order.Symbol,
 		ProductType: productType,
 		MarginMode:  "isolated",
 		MarginCoin:  marginCoin,
-		Size:        strconv.FormatFloat(size, 'f', 8, 64),
-		Price:       strconv.FormatFloat(price, 'f', 1, 64),
-		Side:        side,
+		Size:        formatSize(order.Size),
+		Price:       formatPrice(order.Price),
+		Side:        order.Side,
 		// ToDo(ME-01.02.25): Use in hedge mode
 		//TradeSide:   "open",
 		OrderType:  "limit",
 		Force:      "gtc",
 		ReduceOnly: "NO",
+		ClientOid:  order.ClientOid,
 	}
 
 	respBody, err := c.doRequest("POST", "/order/place-order", orderReq)
@@ -278,6 +347,14 @@ func (c *Client) PlaceLimitOrder(symbol string, side string, price float64, size
 	return orderResp.Data.OrderId, nil
 }
 
+func formatPrice(price float64) string {
+	return strconv.FormatFloat(price, 'f', 1, 64)
+}
+
+func formatSize(size float64) string {
+	return strconv.FormatFloat(size, 'f', 8, 64)
+}
+
 func (c *Client) CancelOrder(symbol string, orderId string) error {
 	if err := c.validateSymbol(symbol); err != nil {
 		return err
@@ -310,3 +387,221 @@ func (c *Client) CancelOrder(symbol string, orderId string) error {
 
 	return nil
 }
+
+// PlaceMarketOrder places a market order, reduceOnly orders only close the
+// position
+func (c *Client) PlaceMarketOrder(symbol, side string, size float64, reduceOnly bool) (string, error) {
+	if err := c.validateSymbol(symbol); err != nil {
+		return "", err
+	}
+
+	orderReq := OrderRequest{
+		Symbol:      symbol,
+		ProductType: c.getProductType(),
+		MarginMode:  "isolated",
+		MarginCoin:  c.getMarginCoin(),
+		Size:        formatSize(size),
+		Side:        side,
+		OrderType:   "market",
+		ReduceOnly:  "NO",
+	}
+	if reduceOnly {
+		orderReq.ReduceOnly = "YES"
+	}
+
+	respBody, err := c.doRequest("POST", "/order/place-order", orderReq)
+	if err != nil {
+		return "", err
+	}
+
+	var orderResp OrderResponse
+	if err := json.Unmarshal(respBody, &orderResp); err != nil {
+		return "", err
+	}
+	if orderResp.Code != "00000" {
+		return "", fmt.Errorf("market order placement failed: %s", orderResp.Msg)
+	}
+	return orderResp.Data.OrderId, nil
+}
+
+// FlashClose closes the position of symbol at market price with the flash
+// close endpoint. An empty holdSide closes both sides in hedge mode.
+func (c *Client) FlashClose(symbol, holdSide string) error {
+	if err := c.validateSymbol(symbol); err != nil {
+		return err
+	}
+
+	closeReq := ClosePositionsRequest{
+		Symbol:      symbol,
+		ProductType: c.getProductType(),
+		HoldSide:    holdSide,
+	}
+	respBody, err := c.doRequest("POST", "/order/close-positions", closeReq)
+	if err != nil {
+		return err
+	}
+
+	var closeResp ClosePositionsResponse
+	if err := json.Unmarshal(respBody, &closeResp); err != nil {
+		return err
+	}
+	if closeResp.Code != "00000" {
+		return fmt.Errorf("flash close failed: %s", closeResp.Msg)
+	}
+	if len(closeResp.Data.FailureList) > 0 {
+		failure := closeResp.Data.FailureList[0]
+		return fmt.Errorf("flash close of %s failed: %s (%s)", failure.Symbol, failure.ErrorMsg, failure.ErrorCode)
+	}
+	return nil
+}
+
+// AddMargin adds amount of the margin coin to the isolated margin of a
+// position, moving its liquidation price away
+func (c *Client) AddMargin(symbol, holdSide string, amount float64) error {
+	if err := c.validateSymbol(symbol); err != nil {
+		return err
+	}
+
+	setMarginReq := SetMarginRequest{
+		Symbol:      symbol,
+		ProductType: c.getProductType(),
+		MarginCoin:  c.getMarginCoin(),
+		HoldSide:    holdSide,
+		Amount:      strconv.FormatFloat(amount, 'f', -1, 64),
+	}
+	respBody, err := c.doRequest("POST", "/account/set-margin", setMarginReq)
+	if err != nil {
+		return err
+	}
+
+	var setMarginResp SetMarginResponse
+	if err := json.Unmarshal(respBody, &setMarginResp); err != nil {
+		return err
+	}
+	if setMarginResp.Code != "00000" {
+		return fmt.Errorf("adding margin failed: %s", setMarginResp.Msg)
+	}
+	return nil
+}
+
+// GetOrderHistory returns all orders of symbol created since the given time,
+// following the pagination of the history endpoint
+func (c *Client) GetOrderHistory(symbol string, since time.Time) ([]Order, error) {
+	if err := c.validateSymbol(symbol); err != nil {
+		return nil, err
+	}
+
+	const limit = 100
+	productType := c.getProductType()
+	var orders []Order
+	idLessThan := ""
+	for {
+		path := fmt.Sprintf("/order/orders-history?symbol=%s&productType=%s&startTime=%d&limit=%d", symbol, productType, since.UnixMilli(), limit)
+		if idLessThan != "" {
+			path += "&idLessThan=" + idLessThan
+		}
+		respBody, err := c.doRequest("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var ordersListResponse OrderListResponse
+		if err := json.Unmarshal(respBody, &ordersListResponse); err != nil {
+			return nil, err
+		}
+		if ordersListResponse.Code != "00000" {
+			return nil, fmt.Errorf("order history request failed: %s", ordersListResponse.Msg)
+		}
+
+		orders = append(orders, ordersListResponse.Data.EntrustedList...)
+		if len(ordersListResponse.Data.EntrustedList) < limit || ordersListResponse.Data.EndId == "" {
+			return orders, nil
+		}
+		idLessThan = ordersListResponse.Data.EndId
+	}
+}
+
+// GranularityDuration returns the length of a candle granularity such as "1m", "4H" or "1D"
+func GranularityDuration(granularity string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		'm': time.Minute,
+		'H': time.Hour,
+		'D': 24 * time.Hour,
+		'W': 7 * 24 * time.Hour,
+		'M': 30 * 24 * time.Hour,
+	}
+	if len(granularity) < 2 {
+		return 0, fmt.Errorf("invalid granularity: %s", granularity)
+	}
+	unit, ok := units[granularity[len(granularity)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid granularity: %s", granularity)
+	}
+	n, err := strconv.Atoi(granularity[:len(granularity)-1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid granularity: %s", granularity)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// GetCandles returns the candles of symbol between start and end from the
+// recent candles endpoint, paginating as needed
+func (c *Client) GetCandles(symbol, granularity string, start, end time.Time) ([]Candle, error) {
+	return c.getCandles("/market/candles", 1000, symbol, granularity, start, end)
+}
+
+// GetHistoryCandles returns the candles of symbol between start and end from
+// the history endpoint, which reaches further back than GetCandles
+func (c *Client) GetHistoryCandles(symbol, granularity string, start, end time.Time) ([]Candle, error) {
+	return c.getCandles("/market/history-candles", 200, symbol, granularity, start, end)
+}
+
+func (c *Client) getCandles(endpoint string, limit int, symbol, granularity string, start, end time.Time) ([]Candle, error) {
+	if err := c.validateSymbol(symbol); err != nil {
+		return nil, err
+	}
+	interval, err := GranularityDuration(granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	var candles []Candle
+	for windowStart := start; windowStart.Before(end); {
+		windowEnd := windowStart.Add(time.Duration(limit) * interval)
+		if windowEnd.After(end) {
+			windowEnd = end
+		}
+
+		path := fmt.Sprintf("%s?symbol=%s&productType=%s&granularity=%s&startTime=%d&endTime=%d&limit=%d",
+			endpoint, symbol, c.getProductType(), granularity, windowStart.UnixMilli(), windowEnd.UnixMilli(), limit)
+		respBody, err := c.doRequest("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var candleResp CandleResponse
+		if err := json.Unmarshal(respBody, &candleResp); err != nil {
+			return nil, err
+		}
+		if candleResp.Code != "00000" {
+			return nil, fmt.Errorf("candle request failed: %s", candleResp.Msg)
+		}
+
+		for _, row := range candleResp.Data {
+			candle, err := parseCandle(row)
+			if err != nil {
+				return nil, err
+			}
+			if candle.Timestamp.Before(windowStart) || !candle.Timestamp.Before(windowEnd) {
+				continue
+			}
+			candles = append(candles, candle)
+		}
+		windowStart = windowEnd
+	}
+
+	sort.Slice(candles, func(i, j int) bool {
+		return candles[i].Timestamp.Before(candles[j].Timestamp)
+	})
+	return candles, nil
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Contract holds the trading rules of a symbol. Zero values mean the rule
+// does not apply.
+type Contract struct {
+	Symbol      string
+	MinTradeNum float64 // minimum order size in the base coin
+	SizeStep    float64 // order sizes are multiples of it
+}
+
+// RoundSize rounds size down to the size step of the contract
+func (c Contract) RoundSize(size float64) float64 {
+	if c.SizeStep <= 0 {
+		return size
+	}
+	// tolerate sizes a hair below a step after floating point arithmetic
+	steps := math.Floor(size/c.SizeStep + 1e-9)
+	return steps * c.SizeStep
+}
+
+// GetContract returns the trading rules of symbol
+func (c *Client) GetContract(symbol string) (*Contract, error) {
+	if err := c.validateSymbol(symbol); err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("/market/contracts?symbol=%s&productType=%s", symbol, c.getProductType())
+	respBody, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var contractResp ContractResponse
+	if err := json.Unmarshal(respBody, &contractResp); err != nil {
+		return nil, err
+	}
+	if contractResp.Code != "00000" {
+		return nil, fmt.Errorf("contract request failed: %s", contractResp.Msg)
+	}
+	if len(contractResp.Data) == 0 {
+		return nil, fmt.Errorf("no contract available for %s", symbol)
+	}
+
+	data := contractResp.Data[0]
+	contract := &Contract{Symbol: data.Symbol}
+	if contract.MinTradeNum, err = strconv.ParseFloat(data.MinTradeNum, 64); err != nil {
+		return nil, fmt.Errorf("failed to parse minimum trade size: %w", err)
+	}
+	if contract.SizeStep, err = strconv.ParseFloat(data.SizeMultiplier, 64); err != nil {
+		return nil, fmt.Errorf("failed to parse size multiplier: %w", err)
+	}
+	return contract, nil
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoPosition is returned by GetPosition if the symbol has no open position
+var ErrNoPosition = errors.New("no position data available")
+
+// APIError is returned when a REST request fails with an error status
+type APIError struct {
+	Status int
+	Code   string // bitget error code, if the body could be parsed
+	Msg    string
+	Body   string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed with status %d: %s", e.Status, e.Body)
+}
+
+// IsOrderNotFound reports whether err means the order does not exist (any
+// more), e.g. when cancelling an order that was already cancelled
+func IsOrderNotFound(err error) bool {
+	code, msg := errorCode(err)
+	return code == "40768" || code == "43001" || strings.Contains(msg, "does not exist")
+}
+
+// IsDuplicateClientOid reports whether err means an order with the same client
+// order id was placed before
+func IsDuplicateClientOid(err error) bool {
+	code, msg := errorCode(err)
+	return code == "40786" || strings.Contains(msg, "duplicate")
+}
+
+func errorCode(err error) (string, string) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code, strings.ToLower(apiErr.Msg)
+	}
+	var tradeErr *TradeError
+	if errors.As(err, &tradeErr) {
+		return fmt.Sprint(tradeErr.Code), strings.ToLower(tradeErr.Msg)
+	}
+	if err == nil {
+		return "", ""
+	}
+	return "", strings.ToLower(err.Error())
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// GetFills returns the fills of symbol executed since the given time, newest
+// first, following the pagination of the fills endpoint
+func (c *Client) GetFills(symbol string, since time.Time) ([]Fill, error) {
+	if err := c.validateSymbol(symbol); err != nil {
+		return nil, err
+	}
+
+	const limit = 100
+	var fills []Fill
+	idLessThan := ""
+	for {
+		path := fmt.Sprintf("/order/fills?symbol=%s&productType=%s&startTime=%d&limit=%d", symbol, c.getProductType(), since.UnixMilli(), limit)
+		if idLessThan != "" {
+			path += "&idLessThan=" + idLessThan
+		}
+		respBody, err := c.doRequest("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var fillsResp FillListResponse
+		if err := json.Unmarshal(respBody, &fillsResp); err != nil {
+			return nil, err
+		}
+		if fillsResp.Code != "00000" {
+			return nil, fmt.Errorf("fills request failed: %s", fillsResp.Msg)
+		}
+
+		fills = append(fills, fillsResp.Data.FillList...)
+		if len(fillsResp.Data.FillList) < limit || fillsResp.Data.EndId == "" {
+			return fills, nil
+		}
+		idLessThan = fillsResp.Data.EndId
+	}
+}
+
+// GetOrder returns the order of symbol with the given id
+func (c *Client) GetOrder(symbol, orderId string) (*Order, error) {
+	return c.getOrderDetail(symbol, "orderId", orderId)
+}
+
+// GetOrderByClientOid returns the order of symbol placed with the given client
+// order id
+func (c *Client) GetOrderByClientOid(symbol, clientOid string) (*Order, error) {
+	return c.getOrderDetail(symbol, "clientOid", clientOid)
+}
+
+func (c *Client) getOrderDetail(symbol, idParam, id string) (*Order, error) {
+	if err := c.validateSymbol(symbol); err != nil {
+		return nil, err
+	}
+
+	path := fmt.Sprintf("/order/detail?symbol=%s&productType=%s&%s=%s", symbol, c.getProductType(), idParam, url.QueryEscape(id))
+	respBody, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var detailResp OrderDetailResponse
+	if err := json.Unmarshal(respBody, &detailResp); err != nil {
+		return nil, err
+	}
+	if detailResp.Code != "00000" {
+		return nil, fmt.Errorf("order detail request failed: %s", detailResp.Msg)
+	}
+	order := detailResp.Data.Order()
+	return &order, nil
+}
+
+// GetFilledOrders returns the orders of symbol that were filled, at least
+// partially, since the given time, regardless of when they were created.
+// Orders are returned in the order of their first fill in that period.
+func (c *Client) GetFilledOrders(symbol string, since time.Time) ([]Order, error) {
+	fills, err := c.GetFills(symbol, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fills: %w", err)
+	}
+
+	var orders []Order
+	seen := make(map[string]bool)
+	for i := len(fills) - 1; i >= 0; i-- {
+		orderId := fills[i].OrderId
+		if seen[orderId] {
+			continue
+		}
+		seen[orderId] = true
+		order, err := c.GetOrder(symbol, orderId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get order %s: %w", orderId, err)
+		}
+		orders = append(orders, *order)
+	}
+	return orders, nil
+}
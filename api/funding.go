@@ -0,0 +1,122 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// GetCurrentFundingRate returns the funding rate of symbol for the next
+// settlement, positive if longs pay shorts
+func (c *Client) GetCurrentFundingRate(symbol string) (float64, error) {
+	if err := c.validateSymbol(symbol); err != nil {
+		return 0, err
+	}
+
+	path := fmt.Sprintf("/market/current-fund-rate?symbol=%s&productType=%s", symbol, c.getProductType())
+	respBody, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var fundingResp FundingRateResponse
+	if err := json.Unmarshal(respBody, &fundingResp); err != nil {
+		return 0, err
+	}
+	if fundingResp.Code != "00000" {
+		return 0, fmt.Errorf("funding rate request failed: %s", fundingResp.Msg)
+	}
+	if len(fundingResp.Data) == 0 {
+		return 0, fmt.Errorf("no funding rate available for %s", symbol)
+	}
+
+	rate, err := strconv.ParseFloat(fundingResp.Data[0].FundingRate, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse funding rate: %w", err)
+	}
+	return rate, nil
+}
+
+// GetFundingRateHistory returns the funding rates of symbol settled since the
+// given time, oldest first, following the pagination of the history endpoint
+func (c *Client) GetFundingRateHistory(symbol string, since time.Time) ([]FundingRate, error) {
+	if err := c.validateSymbol(symbol); err != nil {
+		return nil, err
+	}
+
+	const pageSize = 100
+	var rates []FundingRate
+	for page := 1; ; page++ {
+		path := fmt.Sprintf("/market/history-fund-rate?symbol=%s&productType=%s&pageSize=%d&pageNo=%d", symbol, c.getProductType(), pageSize, page)
+		respBody, err := c.doRequest("GET", path, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var fundingResp FundingRateResponse
+		if err := json.Unmarshal(respBody, &fundingResp); err != nil {
+			return nil, err
+		}
+		if fundingResp.Code != "00000" {
+			return nil, fmt.Errorf("funding rate history request failed: %s", fundingResp.Msg)
+		}
+
+		// pages are newest first
+		reachedSince := false
+		for _, row := range fundingResp.Data {
+			rate, err := strconv.ParseFloat(row.FundingRate, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse funding rate: %w", err)
+			}
+			ms, err := strconv.ParseInt(row.FundingTime, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse funding time: %w", err)
+			}
+			settled := time.UnixMilli(ms)
+			if settled.Before(since) {
+				reachedSince = true
+				break
+			}
+			rates = append(rates, FundingRate{Symbol: symbol, Rate: rate, Time: settled})
+		}
+		if reachedSince || len(fundingResp.Data) < pageSize {
+			break
+		}
+	}
+
+	for i, j := 0, len(rates)-1; i < j; i, j = i+1, j-1 {
+		rates[i], rates[j] = rates[j], rates[i]
+	}
+	return rates, nil
+}
+
+// GetNextFundingTime returns when funding of symbol is settled next
+func (c *Client) GetNextFundingTime(symbol string) (time.Time, error) {
+	if err := c.validateSymbol(symbol); err != nil {
+		return time.Time{}, err
+	}
+
+	path := fmt.Sprintf("/market/funding-time?symbol=%s&productType=%s", symbol, c.getProductType())
+	respBody, err := c.doRequest("GET", path, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var fundingResp FundingTimeResponse
+	if err := json.Unmarshal(respBody, &fundingResp); err != nil {
+		return time.Time{}, err
+	}
+	if fundingResp.Code != "00000" {
+		return time.Time{}, fmt.Errorf("funding time request failed: %s", fundingResp.Msg)
+	}
+	if len(fundingResp.Data) == 0 {
+		return time.Time{}, fmt.Errorf("no funding time available for %s", symbol)
+	}
+
+	ms, err := strconv.ParseInt(fundingResp.Data[0].NextFundingTime, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse funding time: %w", err)
+	}
+	return time.UnixMilli(ms), nil
+}
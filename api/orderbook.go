@@ -0,0 +1,290 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const checksumLevels = 25 // bitget computes the checksum over the top 25 levels of each side
+
+var (
+	ErrBookNotSynced    = errors.New("order book has not received a snapshot yet")
+	ErrChecksumMismatch = errors.New("order book checksum mismatch")
+	ErrSequenceGap      = errors.New("order book update out of sequence")
+	ErrInsufficientBook = errors.New("not enough liquidity in order book")
+)
+
+type bookLevel struct {
+	rawPrice string // kept verbatim for the checksum
+	rawSize  string
+	price    float64
+	size     float64
+}
+
+// OrderBook is a local copy of an order book maintained from the full-depth
+// books channel
+type OrderBook struct {
+	mu     sync.RWMutex
+	Symbol string
+	bids   []bookLevel // sorted by price, best (highest) first
+	asks   []bookLevel // sorted by price, best (lowest) first
+	seq    int64
+	synced bool
+}
+
+func NewOrderBook(symbol string) *OrderBook {
+	return &OrderBook{Symbol: symbol}
+}
+
+// Apply applies a snapshot or update push to the book. On a checksum mismatch
+// or sequence gap the book is reset and has to be resynced from a new snapshot.
+// Every push must carry a checksum; a missing one counts as a mismatch.
+func (b *OrderBook) Apply(action string, books WSBooks) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch action {
+	case "snapshot":
+		b.bids = nil
+		b.asks = nil
+	case "update":
+		if !b.synced {
+			return ErrBookNotSynced
+		}
+		if err := b.checkSequence(books); err != nil {
+			b.reset()
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown books action: %s", action)
+	}
+
+	var err error
+	if b.bids, err = applyLevels(b.bids, books.Bids, true); err != nil {
+		b.reset()
+		return err
+	}
+	if b.asks, err = applyLevels(b.asks, books.Asks, false); err != nil {
+		b.reset()
+		return err
+	}
+
+	if checksum := b.checksum(); checksum != books.Checksum {
+		b.reset()
+		return fmt.Errorf("%w: expected %d, calculated %d", ErrChecksumMismatch, books.Checksum, checksum)
+	}
+
+	b.seq = books.Seq
+	b.synced = true
+	return nil
+}
+
+// checkSequence detects missed updates. Pushes carrying pseq must continue
+// exactly at the last applied seq, others must at least advance it.
+func (b *OrderBook) checkSequence(books WSBooks) error {
+	switch {
+	case books.Pseq != 0 && books.Pseq != b.seq:
+		return fmt.Errorf("%w: got update %d following %d after %d", ErrSequenceGap, books.Seq, books.Pseq, b.seq)
+	case books.Seq <= b.seq:
+		return fmt.Errorf("%w: got seq %d after %d", ErrSequenceGap, books.Seq, b.seq)
+	}
+	return nil
+}
+
+func (b *OrderBook) reset() {
+	b.bids = nil
+	b.asks = nil
+	b.seq = 0
+	b.synced = false
+}
+
+// Synced reports whether the book holds a verified snapshot
+func (b *OrderBook) Synced() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.synced
+}
+
+func applyLevels(levels []bookLevel, changes [][]string, descending bool) ([]bookLevel, error) {
+	for _, change := range changes {
+		if len(change) < 2 {
+			return nil, fmt.Errorf("invalid book level: %v", change)
+		}
+		price, err := strconv.ParseFloat(change[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse book price: %w", err)
+		}
+		size, err := strconv.ParseFloat(change[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse book size: %w", err)
+		}
+
+		i := sort.Search(len(levels), func(i int) bool {
+			if descending {
+				return levels[i].price <= price
+			}
+			return levels[i].price >= price
+		})
+		exists := i < len(levels) && levels[i].price == price
+		switch {
+		case size == 0 && exists:
+			levels = append(levels[:i], levels[i+1:]...)
+		case size == 0:
+			// removal of a level we don't know, nothing to do
+		case exists:
+			levels[i] = bookLevel{rawPrice: change[0], rawSize: change[1], price: price, size: size}
+		default:
+			levels = append(levels, bookLevel{})
+			copy(levels[i+1:], levels[i:])
+			levels[i] = bookLevel{rawPrice: change[0], rawSize: change[1], price: price, size: size}
+		}
+	}
+	return levels, nil
+}
+
+// checksum calculates the signed CRC32 of the interleaved top levels
+// "bid1Price:bid1Size:ask1Price:ask1Size:bid2Price:..."
+func (b *OrderBook) checksum() int64 {
+	var parts []string
+	for i := 0; i < checksumLevels; i++ {
+		if i < len(b.bids) {
+			parts = append(parts, b.bids[i].rawPrice, b.bids[i].rawSize)
+		}
+		if i < len(b.asks) {
+			parts = append(parts, b.asks[i].rawPrice, b.asks[i].rawSize)
+		}
+	}
+	return int64(int32(crc32.ChecksumIEEE([]byte(strings.Join(parts, ":")))))
+}
+
+// BestBid returns price and size of the highest bid
+func (b *OrderBook) BestBid() (price, size float64, ok bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.bids) == 0 {
+		return 0, 0, false
+	}
+	return b.bids[0].price, b.bids[0].size, true
+}
+
+// BestAsk returns price and size of the lowest ask
+func (b *OrderBook) BestAsk() (price, size float64, ok bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if len(b.asks) == 0 {
+		return 0, 0, false
+	}
+	return b.asks[0].price, b.asks[0].size, true
+}
+
+// DepthAt returns the cumulative size resting on the given book side ("buy" for
+// bids, "sell" for asks) at price or better
+func (b *OrderBook) DepthAt(side string, price float64) (float64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.synced {
+		return 0, ErrBookNotSynced
+	}
+	var depth float64
+	for _, level := range b.side(side) {
+		if (side == "buy" && level.price < price) || (side == "sell" && level.price > price) {
+			break
+		}
+		depth += level.size
+	}
+	return depth, nil
+}
+
+// VWAP returns the volume weighted average price of a market order of the
+// given side and size, i.e. a "buy" walks the asks and a "sell" the bids
+func (b *OrderBook) VWAP(side string, size float64) (float64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.synced {
+		return 0, ErrBookNotSynced
+	}
+	levels := b.asks
+	if side == "sell" {
+		levels = b.bids
+	}
+
+	remaining := size
+	var notional float64
+	for _, level := range levels {
+		fill := min(remaining, level.size)
+		notional += fill * level.price
+		remaining -= fill
+		if remaining <= 0 {
+			return notional / size, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %.8f of %.8f %s unfilled", ErrInsufficientBook, remaining, size, b.Symbol)
+}
+
+// EstimateSlippage returns the expected slippage in percent of a market order
+// of the given side and size relative to the best price
+func (b *OrderBook) EstimateSlippage(side string, size float64) (float64, error) {
+	vwap, err := b.VWAP(side, size)
+	if err != nil {
+		return 0, err
+	}
+	if side == "sell" {
+		best, _, _ := b.BestBid()
+		return (best - vwap) / best * 100, nil
+	}
+	best, _, _ := b.BestAsk()
+	return (vwap - best) / best * 100, nil
+}
+
+func (b *OrderBook) side(side string) []bookLevel {
+	if side == "sell" {
+		return b.asks
+	}
+	return b.bids
+}
+
+// TrackOrderBook subscribes to the full-depth books channel of symbol and keeps
+// the returned book in sync. Whenever the book gets out of sync it resubscribes
+// to receive a fresh snapshot.
+func (c *PublicWebsocketClient) TrackOrderBook(symbol string) (*OrderBook, error) {
+	book := NewOrderBook(symbol)
+	arg, err := c.arg(BooksChannel, symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	var handler func(action string, books []WSBooks)
+	handler = func(action string, books []WSBooks) {
+		for _, data := range books {
+			err := book.Apply(action, data)
+			if err == nil {
+				continue
+			}
+			if errors.Is(err, ErrBookNotSynced) {
+				// updates in flight while waiting for the new snapshot
+				continue
+			}
+			log.Printf("Order book for %s out of sync, resubscribing: %v", symbol, err)
+			if err := c.Unsubscribe(arg); err != nil {
+				log.Printf("Failed to unsubscribe from order book for %s: %v", symbol, err)
+			}
+			if err := c.SubscribeBooks(symbol, BooksChannel, handler); err != nil {
+				log.Printf("Failed to resubscribe to order book for %s: %v", symbol, err)
+			}
+			return
+		}
+	}
+
+	if err := c.SubscribeBooks(symbol, BooksChannel, handler); err != nil {
+		return nil, err
+	}
+	return book, nil
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"errors"
+	"hash/crc32"
+	"testing"
+)
+
+// snapshot and update as pushed on the books channel of BTCUSDT, cut to three
+// levels per side
+var (
+	testSnapshot = WSBooks{
+		Asks: [][]string{{"27000.5", "8.760"}, {"27001.0", "0.400"}, {"27002.5", "1.250"}},
+		Bids: [][]string{{"27000.0", "2.710"}, {"26999.5", "1.460"}, {"26998.0", "0.800"}},
+		Seq:  1000,
+	}
+	testUpdate = WSBooks{
+		Asks: [][]string{{"27000.5", "0"}, {"27001.5", "2.000"}},
+		Bids: [][]string{{"27000.0", "3.100"}},
+		Seq:  1001,
+		Pseq: 1000,
+	}
+)
+
+func checksumOf(s string) int64 {
+	return int64(int32(crc32.ChecksumIEEE([]byte(s))))
+}
+
+func withChecksum(books WSBooks, interleaved string) WSBooks {
+	books.Checksum = checksumOf(interleaved)
+	return books
+}
+
+func syncedBook(t *testing.T) *OrderBook {
+	t.Helper()
+	book := NewOrderBook("BTCUSDT")
+	snapshot := withChecksum(testSnapshot, "27000.0:2.710:27000.5:8.760:26999.5:1.460:27001.0:0.400:26998.0:0.800:27002.5:1.250")
+	if err := book.Apply("snapshot", snapshot); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	return book
+}
+
+func TestOrderBookChecksumMatch(t *testing.T) {
+	book := syncedBook(t)
+	update := withChecksum(testUpdate, "27000.0:3.100:27001.0:0.400:26999.5:1.460:27001.5:2.000:26998.0:0.800:27002.5:1.250")
+	if err := book.Apply("update", update); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	if price, size, _ := book.BestBid(); price != 27000 || size != 3.1 {
+		t.Errorf("best bid = %v %v, want 27000 3.1", price, size)
+	}
+	if price, size, _ := book.BestAsk(); price != 27001 || size != 0.4 {
+		t.Errorf("best ask = %v %v, want 27001 0.4", price, size)
+	}
+	depth, err := book.DepthAt("sell", 27001.5)
+	if err != nil || depth != 2.4 {
+		t.Errorf("ask depth = %v, %v, want 2.4", depth, err)
+	}
+}
+
+func TestOrderBookChecksumMismatch(t *testing.T) {
+	book := syncedBook(t)
+	update := testUpdate
+	update.Checksum = 12345
+	if err := book.Apply("update", update); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("update with wrong checksum: got %v, want ErrChecksumMismatch", err)
+	}
+	if book.Synced() {
+		t.Error("book still synced after checksum mismatch")
+	}
+
+	update.Checksum = 0
+	book = syncedBook(t)
+	if err := book.Apply("update", update); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("update without checksum: got %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestOrderBookSequenceGap(t *testing.T) {
+	tests := []struct {
+		name      string
+		seq, pseq int64
+	}{
+		{"gap", 1005, 1004},
+		{"stale", 1000, 0},
+		{"replayed", 999, 998},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := syncedBook(t)
+			update := withChecksum(testUpdate, "27000.0:3.100:27001.0:0.400:26999.5:1.460:27001.5:2.000:26998.0:0.800:27002.5:1.250")
+			update.Seq, update.Pseq = tt.seq, tt.pseq
+			if err := book.Apply("update", update); !errors.Is(err, ErrSequenceGap) {
+				t.Fatalf("got %v, want ErrSequenceGap", err)
+			}
+			if book.Synced() {
+				t.Error("book still synced after sequence gap")
+			}
+		})
+	}
+}
+
+func TestOrderBookResync(t *testing.T) {
+	book := syncedBook(t)
+	bad := testUpdate
+	bad.Checksum = 1
+	if err := book.Apply("update", bad); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("got %v, want ErrChecksumMismatch", err)
+	}
+
+	// updates in flight before the new snapshot are dropped and the book
+	// serves no data
+	if err := book.Apply("update", testUpdate); !errors.Is(err, ErrBookNotSynced) {
+		t.Fatalf("update while unsynced: got %v, want ErrBookNotSynced", err)
+	}
+	if _, err := book.DepthAt("buy", 26000); !errors.Is(err, ErrBookNotSynced) {
+		t.Errorf("DepthAt while unsynced: got %v, want ErrBookNotSynced", err)
+	}
+	if _, err := book.VWAP("buy", 1); !errors.Is(err, ErrBookNotSynced) {
+		t.Errorf("VWAP while unsynced: got %v, want ErrBookNotSynced", err)
+	}
+
+	resynced := syncedBook(t)
+	if err := book.Apply("snapshot", withChecksum(testSnapshot, "27000.0:2.710:27000.5:8.760:26999.5:1.460:27001.0:0.400:26998.0:0.800:27002.5:1.250")); err != nil {
+		t.Fatalf("new snapshot: %v", err)
+	}
+	if !book.Synced() {
+		t.Fatal("book not synced after new snapshot")
+	}
+	want, _ := resynced.DepthAt("buy", 26998)
+	if got, err := book.DepthAt("buy", 26998); err != nil || got != want {
+		t.Errorf("bid depth after resync = %v, %v, want %v", got, err, want)
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+)
+
+const (
+	BooksChannel   = "books"   // full depth, snapshot followed by incremental updates
+	Books1Channel  = "books1"  // top of book snapshots
+	Books5Channel  = "books5"  // top 5 levels snapshots
+	Books15Channel = "books15" // top 15 levels snapshots
+)
+
+// PublicWebsocketClient streams public market data (tickers, candles, trades
+// and order books). It shares connection handling with WebsocketClient but
+// does not log in.
+type PublicWebsocketClient struct {
+	*WebsocketClient
+}
+
+func NewPublicWebsocketClient(isDemoTrading bool) (*PublicWebsocketClient, error) {
+	ws, err := newWebsocketClient(wsPublicEndpoint, false, "", "", "", isDemoTrading)
+	if err != nil {
+		return nil, err
+	}
+	return &PublicWebsocketClient{WebsocketClient: ws}, nil
+}
+
+func (c *PublicWebsocketClient) arg(channel, symbol string) (WSSubscription, error) {
+	if err := c.validateSymbol(symbol); err != nil {
+		return WSSubscription{}, err
+	}
+	return WSSubscription{
+		InstType: c.InstType(),
+		Channel:  channel,
+		InstId:   symbol,
+	}, nil
+}
+
+// SubscribeTicker pushes ticker updates for symbol to handler
+func (c *PublicWebsocketClient) SubscribeTicker(symbol string, handler func([]WSTicker)) error {
+	arg, err := c.arg("ticker", symbol)
+	if err != nil {
+		return err
+	}
+	return c.Subscribe(arg, func(data []byte) {
+		var tickers []WSTicker
+		if err := json.Unmarshal(data, &tickers); err != nil {
+			log.Printf("Failed to parse ticker update: %v \n update data: %s", err, string(data))
+			return
+		}
+		handler(tickers)
+	})
+}
+
+// SubscribeCandles pushes candles of the given interval (e.g. "1m", "15m", "1H")
+// for symbol to handler. The last candle of each push may still be open.
+func (c *PublicWebsocketClient) SubscribeCandles(symbol, interval string, handler func([]Candle)) error {
+	arg, err := c.arg("candle"+interval, symbol)
+	if err != nil {
+		return err
+	}
+	return c.Subscribe(arg, func(data []byte) {
+		candles, err := parseCandles(data)
+		if err != nil {
+			log.Printf("Failed to parse candle update: %v \n update data: %s", err, string(data))
+			return
+		}
+		handler(candles)
+	})
+}
+
+// SubscribeTrades pushes public trades for symbol to handler
+func (c *PublicWebsocketClient) SubscribeTrades(symbol string, handler func([]WSTrade)) error {
+	arg, err := c.arg("trade", symbol)
+	if err != nil {
+		return err
+	}
+	return c.Subscribe(arg, func(data []byte) {
+		var trades []WSTrade
+		if err := json.Unmarshal(data, &trades); err != nil {
+			log.Printf("Failed to parse trade update: %v \n update data: %s", err, string(data))
+			return
+		}
+		handler(trades)
+	})
+}
+
+// SubscribeBooks pushes order book data of the given books channel for symbol
+// to handler. action is either "snapshot" or "update".
+func (c *PublicWebsocketClient) SubscribeBooks(symbol, channel string, handler func(action string, books []WSBooks)) error {
+	arg, err := c.arg(channel, symbol)
+	if err != nil {
+		return err
+	}
+	return c.SubscribeMessage(arg, func(msg WSMessage) {
+		var books []WSBooks
+		if err := json.Unmarshal(msg.Data, &books); err != nil {
+			log.Printf("Failed to parse books update: %v \n update data: %s", err, string(msg.Data))
+			return
+		}
+		handler(msg.Action, books)
+	})
+}
+
+func parseCandles(data []byte) ([]Candle, error) {
+	var rows [][]string
+	if err := json.Unmarshal(data, &rows); err != nil {
+		return nil, err
+	}
+	candles := make([]Candle, 0, len(rows))
+	for _, row := range rows {
+		candle, err := parseCandle(row)
+		if err != nil {
+			return nil, err
+		}
+		candles = append(candles, candle)
+	}
+	return candles, nil
+}
+
+// parseCandle parses [timestamp, open, high, low, close, baseVolume, quoteVolume, ...]
+func parseCandle(row []string) (Candle, error) {
+	if len(row) < 7 {
+		return Candle{}, fmt.Errorf("candle has %d fields, expected at least 7", len(row))
+	}
+	ts, err := strconv.ParseInt(row[0], 10, 64)
+	if err != nil {
+		return Candle{}, fmt.Errorf("failed to parse candle timestamp: %w", err)
+	}
+	var values [6]float64
+	for i := range values {
+		values[i], err = strconv.ParseFloat(row[i+1], 64)
+		if err != nil {
+			return Candle{}, fmt.Errorf("failed to parse candle field %d: %w", i+1, err)
+		}
+	}
+	return Candle{
+		Timestamp:   time.UnixMilli(ts),
+		Open:        values[0],
+		High:        values[1],
+		Low:         values[2],
+		Close:       values[3],
+		BaseVolume:  values[4],
+		QuoteVolume: values[5],
+	}, nil
+}
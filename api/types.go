@@ -1,5 +1,7 @@
 package api
 
+import "time"
+
 type Order struct {
 	AccBaseVolume          string      `json:"accBaseVolume"`
 	CTime                  string      `json:"cTime"`
@@ -13,6 +15,7 @@ type Order struct {
 	FillTime               string      `json:"fillTime"`
 	Force                  string      `json:"force"`
 	InstId                 string      `json:"instId"`
+	Symbol                 string      `json:"symbol"` // set instead of instId by the REST endpoints
 	Leverage               string      `json:"leverage"`
 	MarginCoin             string      `json:"marginCoin"`
 	MarginMode             string      `json:"marginMode"`
@@ -81,6 +84,42 @@ type TickerResponse struct {
 	Msg string `json:"msg"`
 }
 
+type CandleResponse struct {
+	Code string     `json:"code"`
+	Data [][]string `json:"data"`
+	Msg  string     `json:"msg"`
+}
+
+type FundingRateResponse struct {
+	Code string `json:"code"`
+	Data []struct {
+		Symbol              string `json:"symbol"`
+		FundingRate         string `json:"fundingRate"`
+		FundingRateInterval string `json:"fundingRateInterval"` // hours between settlements
+		NextUpdate          string `json:"nextUpdate"`          // next settlement time
+		FundingTime         string `json:"fundingTime"`         // settlement time of historical rates
+	} `json:"data"`
+	Msg string `json:"msg"`
+}
+
+type FundingTimeResponse struct {
+	Code string `json:"code"`
+	Data []struct {
+		Symbol          string `json:"symbol"`
+		NextFundingTime string `json:"nextFundingTime"`
+		RatePeriod      string `json:"ratePeriod"` // hours between settlements
+	} `json:"data"`
+	Msg string `json:"msg"`
+}
+
+// FundingRate is the funding rate settled at Time. Longs pay shorts if it is
+// positive.
+type FundingRate struct {
+	Symbol string
+	Rate   float64
+	Time   time.Time
+}
+
 type FeeDetail struct {
 	FeeCoin string `json:"feeCoin"`
 	Fee     string `json:"fee"`
@@ -98,6 +137,16 @@ type OrderRequest struct {
 	OrderType   string `json:"orderType"`
 	Force       string `json:"force"`
 	ReduceOnly  string `json:"reduceOnly"`
+	ClientOid   string `json:"clientOid,omitempty"`
+}
+
+// LimitOrder describes a limit order independent of the transport used to place it
+type LimitOrder struct {
+	Symbol    string
+	Side      string
+	Price     float64
+	Size      float64
+	ClientOid string // optional
 }
 
 type OrderResponse struct {
@@ -130,6 +179,41 @@ type CancelOrderRequest struct {
 	OrderID     string `json:"orderId"`     // Optional: Order ID
 }
 
+type ClosePositionsRequest struct {
+	Symbol      string `json:"symbol"`
+	ProductType string `json:"productType"`
+	HoldSide    string `json:"holdSide,omitempty"` // both sides if empty
+}
+
+type ClosePositionsResponse struct {
+	Code string `json:"code"`
+	Data struct {
+		SuccessList []struct {
+			OrderId string `json:"orderId"`
+			Symbol  string `json:"symbol"`
+		} `json:"successList"`
+		FailureList []struct {
+			Symbol    string `json:"symbol"`
+			ErrorMsg  string `json:"errorMsg"`
+			ErrorCode string `json:"errorCode"`
+		} `json:"failureList"`
+	} `json:"data"`
+	Msg string `json:"msg"`
+}
+
+type SetMarginRequest struct {
+	Symbol      string `json:"symbol"`
+	ProductType string `json:"productType"`
+	MarginCoin  string `json:"marginCoin"`
+	HoldSide    string `json:"holdSide"` // long or short
+	Amount      string `json:"amount"`   // positive adds, negative removes margin
+}
+
+type SetMarginResponse struct {
+	Code string `json:"code"`
+	Msg  string `json:"msg"`
+}
+
 type CancelOrderResponse struct {
 	Code string `json:"code"`
 	Data struct {
@@ -139,3 +223,217 @@ type CancelOrderResponse struct {
 	Msg         string `json:"msg"`
 	RequestTime int64  `json:"requestTime"`
 }
+
+type WSTicker struct {
+	InstId          string `json:"instId"`          // Trading pair
+	LastPr          string `json:"lastPr"`          // Latest price
+	BidPr           string `json:"bidPr"`           // Best bid price
+	AskPr           string `json:"askPr"`           // Best ask price
+	BidSz           string `json:"bidSz"`           // Size at best bid
+	AskSz           string `json:"askSz"`           // Size at best ask
+	Open24h         string `json:"open24h"`         // Entry price of the last 24 hours
+	High24h         string `json:"high24h"`         // 24h high
+	Low24h          string `json:"low24h"`          // 24h low
+	Change24h       string `json:"change24h"`       // 24h change
+	FundingRate     string `json:"fundingRate"`     // Current funding rate
+	NextFundingTime string `json:"nextFundingTime"` // Next funding settlement time
+	MarkPrice       string `json:"markPrice"`       // Mark price
+	IndexPrice      string `json:"indexPrice"`      // Index price
+	HoldingAmount   string `json:"holdingAmount"`   // Open interest
+	BaseVolume      string `json:"baseVolume"`      // Trading volume of the coin
+	QuoteVolume     string `json:"quoteVolume"`     // Trading volume of the quote currency
+	Ts              string `json:"ts"`              // System time
+}
+
+type WSTrade struct {
+	Ts      string `json:"ts"`      // Fill time
+	Price   string `json:"price"`   // Fill price
+	Size    string `json:"size"`    // Fill size
+	Side    string `json:"side"`    // Taker side (buy/sell)
+	TradeId string `json:"tradeId"` // Trade ID
+}
+
+type WSBooks struct {
+	Asks     [][]string `json:"asks"`     // Ask levels as [price, size]
+	Bids     [][]string `json:"bids"`     // Bid levels as [price, size]
+	Checksum int64      `json:"checksum"` // CRC32 over the top 25 levels
+	Seq      int64      `json:"seq"`      // Sequence number
+	Pseq     int64      `json:"pseq"`     // Sequence number of the previous push, if sent
+	Ts       string     `json:"ts"`       // Matching engine timestamp
+}
+
+// Candle is a parsed candlestick as pushed by the candle channels
+// or returned by the candle endpoints
+type Candle struct {
+	Timestamp   time.Time
+	Open        float64
+	High        float64
+	Low         float64
+	Close       float64
+	BaseVolume  float64
+	QuoteVolume float64
+}
+
+type WSPosition struct {
+	PosId            string `json:"posId"`            // Position ID
+	InstId           string `json:"instId"`           // Trading pair
+	MarginCoin       string `json:"marginCoin"`       // Margin coin
+	MarginSize       string `json:"marginSize"`       // Margin amount
+	MarginMode       string `json:"marginMode"`       // Margin mode (isolated/crossed)
+	HoldSide         string `json:"holdSide"`         // Position direction (long/short)
+	PosMode          string `json:"posMode"`          // Position mode (one_way_mode/hedge_mode)
+	Total            string `json:"total"`            // Total amount of the position
+	Available        string `json:"available"`        // Available amount for positions
+	Frozen           string `json:"frozen"`           // Frozen amount in the position
+	OpenPriceAvg     string `json:"openPriceAvg"`     // Average entry price
+	Leverage         string `json:"leverage"`         // Leverage
+	AchievedProfits  string `json:"achievedProfits"`  // Realized PnL
+	UnrealizedPL     string `json:"unrealizedPL"`     // Unrealized PnL
+	LiquidationPrice string `json:"liquidationPrice"` // Estimated liquidation price
+	KeepMarginRate   string `json:"keepMarginRate"`   // Tiered maintenance margin rate
+	MarginRate       string `json:"marginRate"`       // Maintenance margin rate
+	BreakEvenPrice   string `json:"breakEvenPrice"`   // Position breakeven price
+	TotalFee         string `json:"totalFee"`         // Funding fee
+	DeductedFee      string `json:"deductedFee"`      // Deducted transaction fees
+	AutoMargin       string `json:"autoMargin"`       // Auto Margin (on/off)
+	CTime            string `json:"cTime"`            // Creation time
+	UTime            string `json:"uTime"`            // Last updated time
+}
+
+// ToPosition converts the pushed position into the REST representation
+func (p WSPosition) ToPosition() Position {
+	return Position{
+		Symbol:           p.InstId,
+		MarginCoin:       p.MarginCoin,
+		HoldSide:         p.HoldSide,
+		MarginSize:       p.MarginSize,
+		Available:        p.Available,
+		Locked:           p.Frozen,
+		Total:            p.Total,
+		Leverage:         p.Leverage,
+		AchievedProfits:  p.AchievedProfits,
+		OpenPriceAvg:     p.OpenPriceAvg,
+		MarginMode:       p.MarginMode,
+		PosMode:          p.PosMode,
+		UnrealizedPL:     p.UnrealizedPL,
+		LiquidationPrice: p.LiquidationPrice,
+		KeepMarginRate:   p.KeepMarginRate,
+		MarginRatio:      p.MarginRate,
+		BreakEvenPrice:   p.BreakEvenPrice,
+		TotalFee:         p.TotalFee,
+		DeductedFee:      p.DeductedFee,
+		CTime:            p.CTime,
+		UTime:            p.UTime,
+		AutoMargin:       p.AutoMargin,
+	}
+}
+
+type WSAccount struct {
+	MarginCoin          string `json:"marginCoin"`          // Margin coin
+	Frozen              string `json:"frozen"`              // Locked quantity (margin coin)
+	Available           string `json:"available"`           // Available quantity in the account
+	MaxOpenPosAvailable string `json:"maxOpenPosAvailable"` // Maximum available balance to open positions
+	MaxTransferOut      string `json:"maxTransferOut"`      // Maximum transferable amount
+	Equity              string `json:"equity"`              // Equity of the margin coin
+	UsdtEquity          string `json:"usdtEquity"`          // Total equity in USDT
+	CrossedRiskRate     string `json:"crossedRiskRate"`     // Risk ratio in cross margin mode
+	UnrealizedPL        string `json:"unrealizedPL"`        // Unrealized PnL
+}
+
+// Fill is an execution of one of the account's orders
+type Fill struct {
+	TradeId    string      `json:"tradeId"`
+	Symbol     string      `json:"symbol"`
+	OrderId    string      `json:"orderId"`
+	Price      string      `json:"price"`
+	BaseVolume string      `json:"baseVolume"`
+	FeeDetail  []FeeDetail `json:"feeDetail"`
+	Side       string      `json:"side"`
+	Profit     string      `json:"profit"`
+	TradeSide  string      `json:"tradeSide"`
+	CTime      string      `json:"cTime"`
+}
+
+type FillListResponse struct {
+	Code string `json:"code"`
+	Data struct {
+		FillList []Fill `json:"fillList"`
+		EndId    string `json:"endId"`
+	} `json:"data"`
+	Msg string `json:"msg"`
+}
+
+// OrderDetail is an order as returned by the order detail endpoint, which
+// names some fields differently than the order lists
+type OrderDetail struct {
+	Symbol       string `json:"symbol"`
+	Size         string `json:"size"`
+	OrderId      string `json:"orderId"`
+	ClientOid    string `json:"clientOid"`
+	BaseVolume   string `json:"baseVolume"`
+	PriceAvg     string `json:"priceAvg"`
+	Fee          string `json:"fee"`
+	Price        string `json:"price"`
+	State        string `json:"state"`
+	Side         string `json:"side"`
+	Force        string `json:"force"`
+	TotalProfits string `json:"totalProfits"`
+	PosSide      string `json:"posSide"`
+	MarginCoin   string `json:"marginCoin"`
+	OrderType    string `json:"orderType"`
+	MarginMode   string `json:"marginMode"`
+	ReduceOnly   string `json:"reduceOnly"`
+	TradeSide    string `json:"tradeSide"`
+	PosMode      string `json:"posMode"`
+	CTime        string `json:"cTime"`
+	UTime        string `json:"uTime"`
+}
+
+// Order converts the detail to the Order pushed on the orders channel
+func (d OrderDetail) Order() Order {
+	return Order{
+		AccBaseVolume: d.BaseVolume,
+		BaseVolume:    d.BaseVolume,
+		CTime:         d.CTime,
+		ClientOId:     d.ClientOid,
+		FillFee:       d.Fee,
+		FillPrice:     d.PriceAvg,
+		Force:         d.Force,
+		InstId:        d.Symbol,
+		Symbol:        d.Symbol,
+		MarginCoin:    d.MarginCoin,
+		MarginMode:    d.MarginMode,
+		OrderId:       d.OrderId,
+		OrderType:     d.OrderType,
+		Pnl:           d.TotalProfits,
+		PosMode:       d.PosMode,
+		PosSide:       d.PosSide,
+		Price:         d.Price,
+		PriceAvg:      d.PriceAvg,
+		ReduceOnly:    d.ReduceOnly,
+		Side:          d.Side,
+		Size:          d.Size,
+		Status:        d.State,
+		TradeSide:     d.TradeSide,
+		TotalProfits:  d.TotalProfits,
+		UTime:         d.UTime,
+	}
+}
+
+type OrderDetailResponse struct {
+	Code string      `json:"code"`
+	Data OrderDetail `json:"data"`
+	Msg  string      `json:"msg"`
+}
+
+type ContractResponse struct {
+	Code string `json:"code"`
+	Data []struct {
+		Symbol         string `json:"symbol"`
+		MinTradeNum    string `json:"minTradeNum"`
+		SizeMultiplier string `json:"sizeMultiplier"`
+		VolumePlace    string `json:"volumePlace"`
+		PricePlace     string `json:"pricePlace"`
+	} `json:"data"`
+	Msg string `json:"msg"`
+}
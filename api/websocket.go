@@ -5,8 +5,11 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"math/rand"
 	"net/url"
 	"strconv"
 	"strings"
@@ -14,91 +17,510 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"botcoin/clock"
+)
+
+const (
+	pingInterval      = 15 * time.Second
+	idleCheckInterval = 1 * time.Second
+	idleTimeout       = 50 * time.Second // bitget disconnects after 60 seconds of inactivity
+	sendTimeout       = 10 * time.Second
+	ackTimeout        = 10 * time.Second // max wait for login and subscribe acknowledgements
 )
 
+var (
+	ErrNotConnected       = errors.New("websocket not connected")
+	ErrClosed             = errors.New("websocket client closed")
+	ErrReconnectExhausted = errors.New("websocket reconnect attempts exhausted")
+	ErrAckTimeout         = errors.New("timed out waiting for acknowledgement")
+)
+
+// LoginError is returned when the exchange rejects the websocket login
+type LoginError struct {
+	Code int
+	Msg  string
+}
+
+func (e *LoginError) Error() string {
+	return fmt.Sprintf("websocket login rejected (code %d): %s", e.Code, e.Msg)
+}
+
+// SubscriptionError is returned when the exchange rejects a subscription
+type SubscriptionError struct {
+	Arg  WSSubscription
+	Code int
+	Msg  string
+}
+
+func (e *SubscriptionError) Error() string {
+	return fmt.Sprintf("subscription to %s/%s/%s rejected (code %d): %s", e.Arg.InstType, e.Arg.Channel, e.Arg.InstId, e.Code, e.Msg)
+}
+
+// ReconnectPolicy configures the delays between reconnect attempts and what
+// happens once MaxAttempts is reached
+type ReconnectPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64 // growth factor of the delay per failed attempt
+	Jitter       float64 // randomizes each delay by +/- this fraction
+	MaxAttempts  int     // 0 retries forever
+	KeepTrying   bool    // keep retrying at MaxDelay after MaxAttempts instead of giving up
+}
+
+func DefaultReconnectPolicy() ReconnectPolicy {
+	return ReconnectPolicy{
+		InitialDelay: 1 * time.Second,
+		MaxDelay:     60 * time.Second,
+		Multiplier:   2,
+		Jitter:       0.2,
+		MaxAttempts:  20,
+	}
+}
+
+// delay returns the jittered delay before the given (1-based) attempt
+func (p ReconnectPolicy) delay(attempt int) time.Duration {
+	delay := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(attempt-1))
+	if delay > float64(p.MaxDelay) || math.IsInf(delay, 0) {
+		delay = float64(p.MaxDelay)
+	}
+	delay *= 1 + p.Jitter*(2*rand.Float64()-1)
+	return time.Duration(delay)
+}
+
+// ConnEvent describes a transition of the connection state machine
+type ConnEvent struct {
+	State   ConnState
+	Attempt int   // reconnect attempt, 0 outside of reconnects
+	Err     error // cause of the transition, if any
+	Time    time.Time
+}
+
+// ConnEventHandler is called on the goroutine owning the connection and must not block
+type ConnEventHandler func(ConnEvent)
+
+// GapHandler receives the time the last message was received before the
+// connection dropped. Like ConnEventHandler it must not block.
+type GapHandler func(lastReceived time.Time)
+
+// Directions of tapped messages
+const (
+	TapSent     = "sent"
+	TapReceived = "received"
+)
+
+// TapHandler observes raw websocket messages, e.g. to record them
+type TapHandler func(direction string, message []byte)
+
 type SubscriptionHandler func([]byte)
 
+// MessageHandler receives the full pushed message, e.g. to inspect its action
+type MessageHandler func(WSMessage)
+
+// ConnState is a state of the websocket connection state machine
+type ConnState int
+
+const (
+	StateConnecting ConnState = iota
+	StateAuthenticating
+	StateSubscribed
+	StateReconnecting
+	StateClosed
+	StateFailed // gave up reconnecting
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case StateConnecting:
+		return "connecting"
+	case StateAuthenticating:
+		return "authenticating"
+	case StateSubscribed:
+		return "subscribed"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateClosed:
+		return "closed"
+	case StateFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// WebsocketClient manages a single websocket connection. The connection itself
+// is owned by one goroutine (run) which performs all writes and drives the
+// state machine connecting -> authenticating -> subscribed -> reconnecting
+// (-> failed once the reconnect policy gives up).
+// Other goroutines only talk to it through channels.
 type WebsocketClient struct {
-	conn                *websocket.Conn
-	mu                  sync.Mutex
-	isConnected         bool
-	keepAliveTicker     *time.Ticker
-	lastReceivedTicket  *time.Ticker
-	lastReceived        time.Time
-	done                chan struct{}
-	reconnectInProgress bool
-	apiKey              string
-	secretKey           string
-	passphrase          string
-	isDemoTrading       bool
-	handlers            map[string]func([]byte)
+	endpoint      string
+	private       bool // private channels require a login
+	apiKey        string
+	secretKey     string
+	passphrase    string
+	isDemoTrading bool
+
+	outgoing chan outgoingMessage
+	done     chan struct{} // closed by Close
+	stopped  chan struct{} // closed when the owner goroutine exited
+	once     sync.Once
+
+	mu            sync.Mutex
+	clock         clock.Clock
+	connState     ConnState
+	policy        ReconnectPolicy
+	eventHandlers []ConnEventHandler
+	onDisconnect  []GapHandler
+	onReconnect   []GapHandler
+	lastReceived  time.Time
+	handlers      map[WSSubscription]MessageHandler // active subscriptions and their handlers
+	pendingAcks   map[WSSubscription]chan error     // subscriptions waiting for their acknowledgement
+	pendingTrades map[string]chan TradeResult       // trade requests waiting for their response, by request id
+	nextTradeId   int64
+	queue         []WSMessage // pushed messages waiting for their handler
+	taps          []TapHandler
+	queued        chan struct{}
+	clockChanged  chan struct{} // tells the owner goroutine to restart its tickers
+
+	state accountState
+}
+
+type outgoingMessage struct {
+	data   []byte
+	result chan error
 }
 
 type WSMessage struct {
-	Event string          `json:"event"`
-	Code  int             `json:"code"`
-	Msg   string          `json:"msg"`
-	Arg   WSSubscription  `json:"arg"`
-	Data  json.RawMessage `json:"data"`
+	Event  string          `json:"event"`
+	Action string          `json:"action"` // snapshot or update for channels pushing incremental data
+	Code   int             `json:"code"`
+	Msg    string          `json:"msg"`
+	Arg    WSSubscription  `json:"arg"`
+	Data   json.RawMessage `json:"data"`
 }
 
 type WSSubscription struct {
 	InstType string `json:"instType"`
 	Channel  string `json:"channel"`
-	InstId   string `json:"instId"`
+	InstId   string `json:"instId,omitempty"`
+	Coin     string `json:"coin,omitempty"` // used by the account channel instead of instId
 }
 
+// NewWebsocketClient creates a client for the private (authenticated) channels
 func NewWebsocketClient(apiKey, secretKey, passphrase string, isDemoTrading bool) (*WebsocketClient, error) {
-	u, err := url.Parse(wsEndpoint)
+	return newWebsocketClient(wsEndpoint, true, apiKey, secretKey, passphrase, isDemoTrading)
+}
+
+func newWebsocketClient(endpoint string, private bool, apiKey, secretKey, passphrase string, isDemoTrading bool) (*WebsocketClient, error) {
+	u, err := url.Parse(endpoint)
 	if err != nil {
 		return nil, err
 	}
 
 	c := &WebsocketClient{
-		keepAliveTicker:    time.NewTicker(15 * time.Second),
-		lastReceivedTicket: time.NewTicker(1 * time.Second),
-		lastReceived:       time.Now(),
-		done:               make(chan struct{}),
-		apiKey:             apiKey,
-		secretKey:          secretKey,
-		passphrase:         passphrase,
-		isDemoTrading:      isDemoTrading,
-		handlers:           make(map[string]func([]byte)),
-	}
-
-	if err := c.connect(u.String()); err != nil {
+		endpoint:      u.String(),
+		private:       private,
+		apiKey:        apiKey,
+		secretKey:     secretKey,
+		passphrase:    passphrase,
+		isDemoTrading: isDemoTrading,
+		outgoing:      make(chan outgoingMessage),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+		clock:         clock.Real,
+		policy:        DefaultReconnectPolicy(),
+		handlers:      make(map[WSSubscription]MessageHandler),
+		pendingAcks:   make(map[WSSubscription]chan error),
+		pendingTrades: make(map[string]chan TradeResult),
+		queued:        make(chan struct{}, 1),
+		clockChanged:  make(chan struct{}, 1),
+	}
+
+	conn, err := c.establish()
+	if err != nil {
 		return nil, err
 	}
 
-	go c.readLoop()
-	go c.keepAlive()
-	go c.monitorReceived()
+	go c.run(conn)
+	go c.dispatch()
 
-	log.Println("Websocket client created")
+	log.Printf("Websocket client created for %s", c.endpoint)
 
-	log.Println("Attempting to send subscribe message...")
-	if err = c.subscribe(); err != nil {
-		return nil, fmt.Errorf("failed to send subscribe message: %w", err)
+	return c, nil
+}
+
+// State returns the current connection state
+func (c *WebsocketClient) State() ConnState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connState
+}
+
+// SetReconnectPolicy replaces the default reconnect policy
+func (c *WebsocketClient) SetReconnectPolicy(policy ReconnectPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.policy = policy
+}
+
+// SetClock replaces the wall clock driving keepalives, reconnect delays and
+// timeouts. The keepalive tickers and a pending reconnect delay are restarted
+// on the new clock, timeouts already running keep their clock.
+func (c *WebsocketClient) SetClock(clock clock.Clock) {
+	c.mu.Lock()
+	c.clock = clock
+	c.mu.Unlock()
+	select {
+	case c.clockChanged <- struct{}{}:
+	default:
 	}
+}
 
-	return c, nil
+func (c *WebsocketClient) getClock() clock.Clock {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock
+}
+
+// OnStateChange registers a handler for connection state transitions
+func (c *WebsocketClient) OnStateChange(handler ConnEventHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.eventHandlers = append(c.eventHandlers, handler)
+}
+
+// OnDisconnect registers a handler called when an established connection drops
+func (c *WebsocketClient) OnDisconnect(handler GapHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onDisconnect = append(c.onDisconnect, handler)
+}
+
+// OnReconnect registers a handler called once a dropped connection has been
+// restored, including its login and subscriptions
+func (c *WebsocketClient) OnReconnect(handler GapHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onReconnect = append(c.onReconnect, handler)
+}
+
+// Tap registers a handler observing every message sent and received on the
+// connection, except keepalive pings. Handlers are called on the owner
+// goroutine and must not block.
+func (c *WebsocketClient) Tap(handler TapHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.taps = append(c.taps, handler)
 }
 
-func (c *WebsocketClient) connect(endpoint string) error {
-	conn, _, err := websocket.DefaultDialer.Dial(endpoint, nil)
+func (c *WebsocketClient) tap(direction string, message []byte) {
+	if string(message) == "ping" || string(message) == "pong" {
+		return
+	}
+	c.mu.Lock()
+	taps := append([]TapHandler(nil), c.taps...)
+	c.mu.Unlock()
+
+	for _, handler := range taps {
+		handler(direction, message)
+	}
+}
+
+// writeJSON writes v to conn, passing it to the taps
+func (c *WebsocketClient) writeJSON(conn *websocket.Conn, v interface{}) error {
+	data, err := json.Marshal(v)
 	if err != nil {
-		return fmt.Errorf("websocket connection failed: %w", err)
+		return err
 	}
+	c.tap(TapSent, data)
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
 
+// LastReceived returns the time the last message was received
+func (c *WebsocketClient) LastReceived() time.Time {
 	c.mu.Lock()
-	c.conn = conn
-	c.isConnected = true
+	defer c.mu.Unlock()
+	return c.lastReceived
+}
+
+func (c *WebsocketClient) notifyGap(handlers *[]GapHandler) {
+	c.mu.Lock()
+	lastReceived := c.lastReceived
+	gapHandlers := append([]GapHandler(nil), *handlers...)
+	c.mu.Unlock()
+
+	for _, handler := range gapHandlers {
+		handler(lastReceived)
+	}
+}
+
+func (c *WebsocketClient) setState(state ConnState) {
+	c.transition(ConnEvent{State: state})
+}
+
+func (c *WebsocketClient) transition(event ConnEvent) {
+	event.Time = c.getClock().Now()
+
+	c.mu.Lock()
+	previous := c.connState
+	c.connState = event.State
+	c.mu.Unlock()
+
+	c.announce(previous, event)
+}
+
+// announce logs a transition from previous and passes it to the handlers
+func (c *WebsocketClient) announce(previous ConnState, event ConnEvent) {
+	c.mu.Lock()
+	handlers := append([]ConnEventHandler(nil), c.eventHandlers...)
+	c.mu.Unlock()
+
+	if previous == event.State && event.Err == nil {
+		return
+	}
+	if event.Err != nil {
+		log.Printf("Websocket %s: %s -> %s (%v)", c.endpoint, previous, event.State, event.Err)
+	} else {
+		log.Printf("Websocket %s: %s -> %s", c.endpoint, previous, event.State)
+	}
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// establish dials the endpoint, logs in and restores all subscriptions,
+// waiting for the acknowledgements of each. It is only called by the goroutine
+// owning the connection.
+func (c *WebsocketClient) establish() (*websocket.Conn, error) {
+	c.setState(StateConnecting)
+	conn, _, err := websocket.DefaultDialer.Dial(c.endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("websocket connection failed: %w", err)
+	}
+
+	if c.private {
+		c.setState(StateAuthenticating)
+		if err := c.authenticate(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		if err := c.awaitAcks(conn, true, nil); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	// subscriptions added while restoring the others are sent in another
+	// round until none is left
+	sent := make(map[WSSubscription]bool)
+	for {
+		subs := c.subscribeOrComplete(sent)
+		if len(subs) == 0 {
+			return conn, nil
+		}
+		if err := c.writeJSON(conn, opMessage("subscribe", subs)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to send re-subscribe request: %w", err)
+		}
+		if err := c.awaitAcks(conn, false, subs); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		for _, arg := range subs {
+			sent[arg] = true
+		}
+	}
+}
+
+// subscribeOrComplete returns the subscriptions not sent yet on the new
+// connection. If there are none, it switches to StateSubscribed under the same
+// lock SubscribeMessage registers subscriptions with, so no subscription added
+// meanwhile can be missed.
+func (c *WebsocketClient) subscribeOrComplete(sent map[WSSubscription]bool) []WSSubscription {
+	now := c.getClock().Now()
+	c.mu.Lock()
+	var subs []WSSubscription
+	for arg := range c.handlers {
+		if !sent[arg] {
+			subs = append(subs, arg)
+		}
+	}
+	if len(subs) > 0 {
+		c.mu.Unlock()
+		return subs
+	}
+	previous := c.connState
+	c.connState = StateSubscribed
 	c.mu.Unlock()
 
-	return c.authenticate()
+	c.announce(previous, ConnEvent{State: StateSubscribed, Time: now})
+	return nil
+}
+
+// awaitAcks reads from conn until the login (if requested) and all given
+// subscriptions are acknowledged. Pushed data arriving in the meantime is
+// queued as usual. Rejected subscriptions are dropped.
+func (c *WebsocketClient) awaitAcks(conn *websocket.Conn, login bool, subs []WSSubscription) error {
+	pending := make(map[WSSubscription]bool, len(subs))
+	for _, arg := range subs {
+		pending[arg] = true
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(ackTimeout)); err != nil {
+		return err
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	for login || len(pending) > 0 {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			var netErr interface{ Timeout() bool }
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return fmt.Errorf("%w: login pending %t, %d subscriptions pending", ErrAckTimeout, login, len(pending))
+			}
+			return fmt.Errorf("read error: %w", err)
+		}
+		c.tap(TapReceived, message)
+		if string(message) == "pong" {
+			continue
+		}
+
+		var msg WSMessage
+		if err := json.Unmarshal(message, &msg); err != nil {
+			log.Printf("parse error: %v \n message: %s", err, string(message))
+			continue
+		}
+
+		switch {
+		case msg.Event == "login":
+			log.Print("Received login event")
+			login = false
+		case msg.Event == "error" && login:
+			return &LoginError{Code: msg.Code, Msg: msg.Msg}
+		case msg.Event == "subscribe":
+			log.Printf("Subscribed to %s on channel %s", msg.Arg.InstType, msg.Arg.Channel)
+			delete(pending, msg.Arg)
+			// a subscription sent just before the connection dropped is
+			// acknowledged on the new one
+			c.resolveAck(msg.Arg, nil)
+		case msg.Event == "error" && pending[msg.Arg]:
+			err := &SubscriptionError{Arg: msg.Arg, Code: msg.Code, Msg: msg.Msg}
+			log.Printf("Dropping subscription: %v", err)
+			c.mu.Lock()
+			delete(c.handlers, msg.Arg)
+			c.mu.Unlock()
+			delete(pending, msg.Arg)
+			c.resolveAck(msg.Arg, err)
+		case msg.Event == "error":
+			log.Printf("Received error message: %s", string(message))
+		case msg.Event == "":
+			c.enqueue(msg)
+		}
+	}
+	return nil
 }
 
-func (c *WebsocketClient) authenticate() error {
+func (c *WebsocketClient) authenticate(conn *websocket.Conn) error {
 	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
 	sign := c.sign(timestamp)
 
@@ -112,12 +534,7 @@ func (c *WebsocketClient) authenticate() error {
 		}},
 	}
 
-	authMsg, err := c.toJson(auth)
-	if err != nil {
-		return err
-	}
-
-	if err := c.Send(authMsg); err != nil {
+	if err := c.writeJSON(conn, auth); err != nil {
 		return fmt.Errorf("authentication failed: %w", err)
 	}
 	return nil
@@ -130,230 +547,471 @@ func (c *WebsocketClient) sign(timestamp string) string {
 	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
 }
 
-func (c *WebsocketClient) toJson(data interface{}) (string, error) {
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal data: %w", err)
+// resubscribe restores all active subscriptions, e.g. after a reconnect
+func (c *WebsocketClient) resubscribe(conn *websocket.Conn) error {
+	subs := c.Subscriptions()
+	if len(subs) == 0 {
+		return nil
 	}
-	return string(jsonData), nil
+	return c.writeJSON(conn, opMessage("subscribe", subs))
 }
 
-func (c *WebsocketClient) Send(data string) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	if !c.isConnected {
-		return fmt.Errorf("not connected")
+func opMessage(op string, args []WSSubscription) map[string]interface{} {
+	return map[string]interface{}{
+		"op":   op,
+		"args": args,
 	}
-	return c.conn.WriteMessage(websocket.TextMessage, []byte(data))
 }
 
-func (c *WebsocketClient) RegisterHandler(handler SubscriptionHandler) {
-	c.handlers["default"] = handler
-}
+// run owns the connection for the lifetime of the client and reconnects
+// whenever serve returns
+func (c *WebsocketClient) run(conn *websocket.Conn) {
+	defer close(c.stopped)
 
-func (c *WebsocketClient) subscribe() error {
-	instType := "USDT-FUTURES"
-	if c.isDemoTrading {
-		instType = "SUSDT-FUTURES"
-	}
+	for {
+		cause := c.serve(conn)
 
-	sub := map[string]interface{}{
-		"op": "subscribe",
-		"args": []WSSubscription{{
-			InstType: instType,
-			Channel:  "orders",
-			InstId:   "default", // all trading pairs
-		}},
+		select {
+		case <-c.done:
+			c.setState(StateClosed)
+			return
+		default:
+		}
+
+		c.transition(ConnEvent{State: StateReconnecting, Err: cause})
+		c.notifyGap(&c.onDisconnect)
+		var ok bool
+		if conn, ok = c.reconnect(); !ok {
+			return
+		}
+		c.notifyGap(&c.onReconnect)
 	}
-	return c.conn.WriteJSON(sub)
 }
 
-// validateSymbol checks if the symbol format matches the trading mode
-func (c *WebsocketClient) validateSymbol(symbol string) error {
-	if c.isDemoTrading {
-		if !strings.HasPrefix(symbol, "S") {
-			return fmt.Errorf("demo trading requires symbols with 'S' prefix, got: %s", symbol)
+// reconnect retries establishing a connection according to the reconnect
+// policy. It returns false if the client was closed or gave up.
+func (c *WebsocketClient) reconnect() (*websocket.Conn, bool) {
+	c.mu.Lock()
+	policy := c.policy
+	c.mu.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		if policy.MaxAttempts > 0 && attempt > policy.MaxAttempts {
+			err := fmt.Errorf("%w after %d attempts", ErrReconnectExhausted, policy.MaxAttempts)
+			if !policy.KeepTrying {
+				log.Printf("giving up reconnecting: %v", err)
+				c.transition(ConnEvent{State: StateFailed, Attempt: attempt - 1, Err: err})
+				return nil, false
+			}
+			if attempt == policy.MaxAttempts+1 {
+				log.Printf("still reconnecting: %v", err)
+				c.transition(ConnEvent{State: StateReconnecting, Attempt: attempt - 1, Err: err})
+			}
 		}
-	} else {
-		if strings.HasPrefix(symbol, "S") {
-			return fmt.Errorf("live trading requires symbols without 'S' prefix, got: %s", symbol)
+
+		delay := policy.delay(attempt)
+		log.Printf("attempting to reconnect in %s (attempt %d)...", delay.Round(time.Millisecond), attempt)
+		if !c.wait(delay) {
+			c.setState(StateClosed)
+			return nil, false
 		}
+
+		conn, err := c.establish()
+		if err == nil {
+			log.Print("reconnected successfully")
+			return conn, true
+		}
+		log.Printf("reconnect failed: %v", err)
+		c.transition(ConnEvent{State: StateReconnecting, Attempt: attempt, Err: err})
 	}
-	return nil
 }
 
-func (c *WebsocketClient) keepAlive() {
+// wait waits for d on the current clock, starting over if the clock is
+// replaced. It returns false if the client was closed.
+func (c *WebsocketClient) wait(d time.Duration) bool {
 	for {
 		select {
-		case <-c.keepAliveTicker.C:
-			if !c.isConnected {
-				continue
-			}
-
-			err := c.Send("ping")
-			if err != nil {
-				log.Printf("ping failed: %v", err)
-				log.Println("keepAlive: calling reconnect")
-				c.reconnect()
-				continue
-			}
-			log.Println("Sent ping")
-
+		case <-c.getClock().After(d):
+			return true
+		case <-c.clockChanged:
 		case <-c.done:
-			log.Println("Done channel closed, exiting keepAlive")
-			return // Exit the keepAlive goroutine when done channel is closed
+			return false
 		}
 	}
 }
 
-func (c *WebsocketClient) monitorReceived() {
+// serve pumps messages on conn until the connection fails or the client is
+// closed. All writes to conn happen here.
+func (c *WebsocketClient) serve(conn *websocket.Conn) error {
+	defer conn.Close()
+
+	incoming := make(chan []byte)
+	readErr := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case incoming <- message:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	clock := c.getClock()
+	pingTicker := clock.NewTicker(pingInterval)
+	idleTicker := clock.NewTicker(idleCheckInterval)
+	defer func() {
+		pingTicker.Stop()
+		idleTicker.Stop()
+	}()
+	lastReceived := clock.Now()
+	c.mu.Lock()
+	c.lastReceived = lastReceived
+	c.mu.Unlock()
+
 	for {
 		select {
-		case <-c.lastReceivedTicket.C:
-			if !c.isConnected {
-				continue
+		case message := <-incoming:
+			lastReceived = clock.Now()
+			c.mu.Lock()
+			c.lastReceived = lastReceived
+			c.mu.Unlock()
+			c.tap(TapReceived, message)
+			if err := c.handleMessage(conn, message); err != nil {
+				return fmt.Errorf("failed to handle message: %w", err)
+			}
+
+		case err := <-readErr:
+			return fmt.Errorf("read error: %w", err)
+
+		case <-pingTicker.C():
+			if err := conn.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+				return fmt.Errorf("ping failed: %w", err)
+			}
+
+		case <-idleTicker.C():
+			if clock.Since(lastReceived) > idleTimeout {
+				return fmt.Errorf("last received message was more than %s ago", idleTimeout)
 			}
-			if time.Since(c.lastReceived).Seconds() > 50 { // bitget disconnects after 60 seconds of inactivity
-				log.Println("Last received message was more than 50 seconds ago")
-				log.Println("monitorReceived: calling reconnect")
-				c.reconnect()
+
+		case <-c.clockChanged:
+			// times of different clocks don't compare, the idle timeout
+			// starts over
+			pingTicker.Stop()
+			idleTicker.Stop()
+			clock = c.getClock()
+			pingTicker = clock.NewTicker(pingInterval)
+			idleTicker = clock.NewTicker(idleCheckInterval)
+			lastReceived = clock.Now()
+			c.mu.Lock()
+			c.lastReceived = lastReceived
+			c.mu.Unlock()
+
+		case out := <-c.outgoing:
+			c.tap(TapSent, out.data)
+			err := conn.WriteMessage(websocket.TextMessage, out.data)
+			out.result <- err
+			if err != nil {
+				return fmt.Errorf("write failed: %w", err)
 			}
+
 		case <-c.done:
-			log.Println("Done channel closed, exiting monitorReceived")
-			return
+			err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			if err != nil {
+				log.Printf("failed to send close message: %v", err)
+			}
+			return nil
 		}
 	}
 }
 
-func (c *WebsocketClient) reconnect() {
-	if c.reconnectInProgress {
-		log.Println("reconnect already in progress")
-		return
+// handleMessage handles control events on the owner goroutine and queues
+// pushed data for the dispatcher
+func (c *WebsocketClient) handleMessage(conn *websocket.Conn, message []byte) error {
+	if string(message) == "pong" {
+		return nil
+	}
+	if c.handleTradeResponse(message) {
+		return nil
 	}
 
-	c.mu.Lock()
-	c.reconnectInProgress = true
-	c.mu.Unlock()
+	var msg WSMessage
+	if err := json.Unmarshal(message, &msg); err != nil {
+		log.Printf("parse error: %v \n message: %s", err, string(message))
+		return nil
+	}
 
-	c.disconnect()
+	switch {
+	case msg.Event == "error" && msg.Code == 30004 && strings.Contains(msg.Msg, "not logged in"):
+		return c.authenticate(conn)
 
-	for {
-		log.Println("attempting to reconnect...")
-		if err := c.connect(wsEndpoint); err != nil {
-			log.Println("reconnect failed")
-			time.Sleep(5 * time.Second)
-			continue
-		}
-		log.Print("reconnected successfully")
+	case msg.Event == "error" && msg.Code == 30006 && strings.Contains(msg.Msg, "request too many"):
+		log.Printf("Received error message: %s", string(message))
+		log.Println("This sometimes seems to happen on trying to subscribe to a channel, resubscribing")
+		return c.resubscribe(conn)
 
-		c.mu.Lock()
-		c.reconnectInProgress = false
-		c.lastReceived = time.Now()
-		c.mu.Unlock()
+	case msg.Event == "error":
+		log.Printf("Received error message: %s", string(message))
+		c.resolveAck(msg.Arg, &SubscriptionError{Arg: msg.Arg, Code: msg.Code, Msg: msg.Msg})
 
-		if err := c.subscribe(); err != nil {
-			log.Printf("failed to send re-subscribe request: %v", err)
-			time.Sleep(5 * time.Second)
-			continue
-		}
-		log.Print("sent re-subscribe request successfully")
+	case msg.Event == "login":
+		log.Print("Received login event")
 
-		return
+	case msg.Event == "subscribe":
+		log.Printf("Subscribed to %s on channel %s", msg.Arg.InstType, msg.Arg.Channel)
+		c.resolveAck(msg.Arg, nil)
+
+	case msg.Event == "unsubscribe":
+		log.Printf("Unsubscribed from %s on channel %s", msg.Arg.InstType, msg.Arg.Channel)
+
+	default:
+		c.enqueue(msg)
 	}
+	return nil
 }
 
-func (c *WebsocketClient) disconnect() {
-	if err := c.closeConnection(); err != nil {
-		log.Printf("failed to close connection: %v", err)
+func (c *WebsocketClient) enqueue(msg WSMessage) {
+	c.mu.Lock()
+	c.queue = append(c.queue, msg)
+	c.mu.Unlock()
+	select {
+	case c.queued <- struct{}{}:
+	default:
 	}
 }
 
-func (c *WebsocketClient) closeConnection() error {
+// expectAck registers a waiter for the acknowledgement of a subscription
+func (c *WebsocketClient) expectAck(arg WSSubscription) chan error {
+	ack := make(chan error, 1)
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.conn != nil {
-		c.isConnected = false
-		return c.conn.Close()
+	c.pendingAcks[arg] = ack
+	c.mu.Unlock()
+	return ack
+}
+
+func (c *WebsocketClient) cancelAck(arg WSSubscription) {
+	c.mu.Lock()
+	delete(c.pendingAcks, arg)
+	c.mu.Unlock()
+}
+
+func (c *WebsocketClient) resolveAck(arg WSSubscription, err error) {
+	c.mu.Lock()
+	ack, ok := c.pendingAcks[arg]
+	delete(c.pendingAcks, arg)
+	c.mu.Unlock()
+	if ok {
+		ack <- err
 	}
-	return nil
 }
 
-func (c *WebsocketClient) readLoop() {
+// dispatch hands queued messages to their handlers in order. Handlers run
+// outside the owner goroutine so they may call Send or Subscribe.
+func (c *WebsocketClient) dispatch() {
 	for {
 		select {
+		case <-c.queued:
 		case <-c.done:
-			log.Println("Done channel closed, exiting read loop")
 			return
-		default:
-			if !c.isConnected {
-				continue
-			}
-			_, message, err := c.conn.ReadMessage()
-			if err != nil {
-				log.Printf("read error: %v", err)
-				log.Println("readLoop: calling reconnect")
-				c.reconnect()
-				continue
-			}
+		}
 
-			c.lastReceived = time.Now()
-			var msg WSMessage
-			if string(message) == "pong" {
-				log.Print("Received pong")
-				continue
+		for {
+			c.mu.Lock()
+			if len(c.queue) == 0 {
+				c.mu.Unlock()
+				break
 			}
+			msg := c.queue[0]
+			c.queue = c.queue[1:]
+			handler, ok := c.handlers[msg.Arg]
+			c.mu.Unlock()
 
-			if err := json.Unmarshal(message, &msg); err != nil {
-				log.Printf("parse error: %v \n message: %s", err, string(message))
+			if !ok {
+				log.Printf("No handler for %s/%s/%s, dropping message", msg.Arg.InstType, msg.Arg.Channel, msg.Arg.InstId)
 				continue
 			}
+			handler(msg)
+		}
+	}
+}
 
-			if msg.Event == "error" && msg.Code == 30004 && strings.Contains(msg.Msg, "not logged in") {
-				if err := c.authenticate(); err != nil {
-					log.Fatalf("failed to re-authenticate: %v", err)
-				}
-				continue
-			}
+func (c *WebsocketClient) toJson(data interface{}) (string, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal data: %w", err)
+	}
+	return string(jsonData), nil
+}
 
-			if msg.Event == "error" && msg.Code == 30006 && strings.Contains(msg.Msg, "request too many") {
-				log.Printf("Received error message: %s", string(message))
-				log.Println("This sometimes seems to happen on trying to subscribe to a channel")
-				log.Println("readLoop: calling subscribe (to ensure we are subscribed)")
-				if err := c.subscribe(); err != nil {
-					log.Fatalf("failed to send re-subscribe message: %v", err)
-				}
-				continue
+// Send writes data to the connection. It fails with ErrNotConnected while the
+// client is (re)connecting.
+func (c *WebsocketClient) Send(data string) error {
+	switch c.State() {
+	case StateSubscribed:
+	case StateClosed:
+		return ErrClosed
+	case StateFailed:
+		return ErrReconnectExhausted
+	default:
+		return ErrNotConnected
+	}
 
-			}
+	out := outgoingMessage{data: []byte(data), result: make(chan error, 1)}
+	timeout := c.getClock().NewTimer(sendTimeout)
+	defer timeout.Stop()
 
-			if msg.Event == "error" {
-				log.Printf("Received error message: %s", string(message))
-				continue
-			}
+	select {
+	case c.outgoing <- out:
+	case <-c.done:
+		return ErrClosed
+	case <-timeout.C():
+		return ErrNotConnected
+	}
+	return <-out.result
+}
 
-			if msg.Event == "login" {
-				log.Print("Received login event")
-				continue
-			}
+// InstType returns the websocket instType matching the trading mode
+func (c *WebsocketClient) InstType() string {
+	if c.isDemoTrading {
+		return "SUSDT-FUTURES"
+	}
+	return "USDT-FUTURES"
+}
 
-			if msg.Event == "subscribe" {
-				log.Printf(string(message))
-				log.Printf("Subscribed to %s on channel %s", msg.Arg.InstType, msg.Arg.Channel)
-				continue
-			}
+// Subscribe subscribes to the channel described by arg and routes all pushed
+// messages for it to handler. The subscription is restored after a reconnect.
+func (c *WebsocketClient) Subscribe(arg WSSubscription, handler SubscriptionHandler) error {
+	return c.SubscribeMessage(arg, func(msg WSMessage) {
+		handler(msg.Data)
+	})
+}
 
-			if handler, ok := c.handlers["default"]; ok {
-				handler(msg.Data)
-			}
+// SubscribeMessage works like Subscribe, but hands the full message to handler.
+// It blocks until the exchange acknowledged the subscription. While the client
+// is (re)connecting it returns right away and the subscription is sent once
+// the connection is restored.
+func (c *WebsocketClient) SubscribeMessage(arg WSSubscription, handler MessageHandler) error {
+	c.mu.Lock()
+	state := c.connState
+	switch state {
+	case StateClosed, StateFailed:
+	default:
+		c.handlers[arg] = handler
+	}
+	c.mu.Unlock()
+
+	var err error
+	switch state {
+	case StateSubscribed:
+	case StateClosed:
+		err = ErrClosed
+	case StateFailed:
+		err = ErrReconnectExhausted
+	default:
+		// establish sends every subscription registered before it completes
+		log.Printf("Not connected, subscribing to %s/%s/%s after reconnect", arg.InstType, arg.Channel, arg.InstId)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s/%s/%s: %w", arg.InstType, arg.Channel, arg.InstId, err)
+	}
+
+	ack := c.expectAck(arg)
+	err = c.sendOp("subscribe", []WSSubscription{arg})
+	if errors.Is(err, ErrNotConnected) {
+		// the connection dropped after the subscription was registered, so
+		// the reconnect restores it
+		c.cancelAck(arg)
+		log.Printf("Not connected, subscribing to %s/%s/%s after reconnect", arg.InstType, arg.Channel, arg.InstId)
+		return nil
+	}
+	if err == nil {
+		timeout := c.getClock().NewTimer(ackTimeout)
+		defer timeout.Stop()
+		select {
+		case err = <-ack:
+		case <-timeout.C():
+			c.cancelAck(arg)
+			err = ErrAckTimeout
+		case <-c.done:
+			err = ErrClosed
 		}
+	} else {
+		c.cancelAck(arg)
 	}
+	if err != nil {
+		c.mu.Lock()
+		delete(c.handlers, arg)
+		c.mu.Unlock()
+		return fmt.Errorf("failed to subscribe to %s/%s/%s: %w", arg.InstType, arg.Channel, arg.InstId, err)
+	}
+	return nil
 }
 
-func (c *WebsocketClient) Close() error {
+// Unsubscribe removes the subscription described by arg and its handler
+func (c *WebsocketClient) Unsubscribe(arg WSSubscription) error {
 	c.mu.Lock()
-	close(c.done)
+	_, ok := c.handlers[arg]
+	delete(c.handlers, arg)
 	c.mu.Unlock()
 
-	return c.closeConnection()
+	if !ok {
+		return fmt.Errorf("not subscribed to %s/%s/%s", arg.InstType, arg.Channel, arg.InstId)
+	}
+	err := c.sendOp("unsubscribe", []WSSubscription{arg})
+	if err != nil && !errors.Is(err, ErrNotConnected) {
+		return fmt.Errorf("failed to unsubscribe from %s/%s/%s: %w", arg.InstType, arg.Channel, arg.InstId, err)
+	}
+	return nil
+}
+
+// Subscriptions returns all currently active subscriptions
+func (c *WebsocketClient) Subscriptions() []WSSubscription {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	subs := make([]WSSubscription, 0, len(c.handlers))
+	for arg := range c.handlers {
+		subs = append(subs, arg)
+	}
+	return subs
+}
+
+func (c *WebsocketClient) sendOp(op string, args []WSSubscription) error {
+	msg, err := c.toJson(opMessage(op, args))
+	if err != nil {
+		return err
+	}
+	return c.Send(msg)
+}
+
+// validateSymbol checks if the symbol format matches the trading mode
+func (c *WebsocketClient) validateSymbol(symbol string) error {
+	if c.isDemoTrading {
+		if !strings.HasPrefix(symbol, "S") {
+			return fmt.Errorf("demo trading requires symbols with 'S' prefix, got: %s", symbol)
+		}
+	} else {
+		if strings.HasPrefix(symbol, "S") {
+			return fmt.Errorf("live trading requires symbols without 'S' prefix, got: %s", symbol)
+		}
+	}
+	return nil
+}
+
+// Close closes the connection and stops all goroutines of the client
+func (c *WebsocketClient) Close() error {
+	c.once.Do(func() {
+		close(c.done)
+	})
+	<-c.stopped
+	return nil
 }
@@ -0,0 +1,493 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"botcoin/clock"
+)
+
+// standIn is a minimal stand-in for the bitget websocket server. It
+// acknowledges logins and subscriptions, answers pings and can drop or refuse
+// connections or stop answering.
+type standIn struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu         sync.Mutex
+	conns      []*standInConn
+	refuse     bool
+	silent     bool // pings and subscriptions go unanswered
+	pings      int
+	logins     int
+	subscribed []WSSubscription // in order of the subscribe requests
+	accepted   chan struct{}
+}
+
+func newStandIn(t *testing.T) *standIn {
+	s := &standIn{t: t, accepted: make(chan struct{}, 16)}
+	upgrader := websocket.Upgrader{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		refuse := s.refuse
+		s.mu.Unlock()
+		if refuse {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn := &standInConn{Conn: ws}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		s.accepted <- struct{}{}
+		s.serve(conn)
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+func (s *standIn) url() string {
+	return "ws" + strings.TrimPrefix(s.server.URL, "http")
+}
+
+// standInConn serializes the writes of the handler and the test
+type standInConn struct {
+	*websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *standInConn) write(v interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if text, ok := v.(string); ok {
+		c.WriteMessage(websocket.TextMessage, []byte(text))
+		return
+	}
+	c.WriteJSON(v)
+}
+
+func (s *standIn) serve(conn *standInConn) {
+	write := conn.write
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		silent := s.silent
+		s.mu.Unlock()
+		if string(message) == "ping" {
+			s.mu.Lock()
+			s.pings++
+			s.mu.Unlock()
+			if !silent {
+				write("pong")
+			}
+			continue
+		}
+		var request struct {
+			Op   string            `json:"op"`
+			Args []json.RawMessage `json:"args"`
+		}
+		if err := json.Unmarshal(message, &request); err != nil {
+			s.t.Errorf("stand-in got invalid request %s: %v", message, err)
+			return
+		}
+		switch request.Op {
+		case "login":
+			s.mu.Lock()
+			s.logins++
+			s.mu.Unlock()
+			write(map[string]interface{}{"event": "login", "code": 0})
+		case "subscribe":
+			if silent {
+				continue
+			}
+			for _, raw := range request.Args {
+				var arg WSSubscription
+				json.Unmarshal(raw, &arg)
+				s.mu.Lock()
+				s.subscribed = append(s.subscribed, arg)
+				s.mu.Unlock()
+				write(map[string]interface{}{"event": "subscribe", "arg": arg})
+			}
+		}
+	}
+}
+
+// push sends a data message for arg on the latest connection
+func (s *standIn) push(arg WSSubscription, data string) {
+	s.mu.Lock()
+	conn := s.conns[len(s.conns)-1]
+	s.mu.Unlock()
+	conn.write(map[string]interface{}{"action": "snapshot", "arg": arg, "data": json.RawMessage(data)})
+}
+
+// drop closes all open connections
+func (s *standIn) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *standIn) setRefuse(refuse bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refuse = refuse
+}
+
+func (s *standIn) setSilent(silent bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.silent = silent
+}
+
+func (s *standIn) pingCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pings
+}
+
+func (s *standIn) subscriptions() []WSSubscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]WSSubscription(nil), s.subscribed...)
+}
+
+func (s *standIn) count(arg WSSubscription) int {
+	n := 0
+	for _, sub := range s.subscriptions() {
+		if sub == arg {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *standIn) awaitAccepted(t *testing.T) {
+	t.Helper()
+	select {
+	case <-s.accepted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no connection accepted")
+	}
+}
+
+// eventually polls cond until it holds or fails the test after 5 seconds
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func fastReconnects() ReconnectPolicy {
+	return ReconnectPolicy{InitialDelay: 5 * time.Millisecond, MaxDelay: 20 * time.Millisecond, Multiplier: 2}
+}
+
+var testArg = WSSubscription{InstType: "USDT-FUTURES", Channel: "orders", InstId: "default"}
+
+func TestWebsocketConnectLoginSubscribe(t *testing.T) {
+	s := newStandIn(t)
+	c, err := newWebsocketClient(s.url(), true, "key", "secret", "pass", false)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+	s.awaitAccepted(t)
+
+	if state := c.State(); state != StateSubscribed {
+		t.Errorf("state = %s, want subscribed", state)
+	}
+	s.mu.Lock()
+	logins := s.logins
+	s.mu.Unlock()
+	if logins != 1 {
+		t.Errorf("logins = %d, want 1", logins)
+	}
+
+	received := make(chan string, 1)
+	if err := c.Subscribe(testArg, func(data []byte) { received <- string(data) }); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	if n := s.count(testArg); n != 1 {
+		t.Errorf("subscribe requests = %d, want 1", n)
+	}
+
+	s.push(testArg, `[{"ordId":"1"}]`)
+	select {
+	case data := <-received:
+		if data != `[{"ordId":"1"}]` {
+			t.Errorf("received %s", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("pushed message not delivered")
+	}
+}
+
+func TestWebsocketReconnectResubscribes(t *testing.T) {
+	s := newStandIn(t)
+	c, err := newWebsocketClient(s.url(), true, "key", "secret", "pass", false)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+	s.awaitAccepted(t)
+	c.SetReconnectPolicy(fastReconnects())
+
+	var mu sync.Mutex
+	var states []ConnState
+	c.OnStateChange(func(event ConnEvent) {
+		mu.Lock()
+		states = append(states, event.State)
+		mu.Unlock()
+	})
+	reconnected := make(chan time.Time, 1)
+	c.OnReconnect(func(lastReceived time.Time) { reconnected <- lastReceived })
+
+	received := make(chan string, 4)
+	if err := c.Subscribe(testArg, func(data []byte) { received <- string(data) }); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	s.drop()
+	s.awaitAccepted(t)
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not reconnected")
+	}
+	if n := s.count(testArg); n != 2 {
+		t.Errorf("subscribe requests = %d, want 2", n)
+	}
+	s.mu.Lock()
+	logins := s.logins
+	s.mu.Unlock()
+	if logins != 2 {
+		t.Errorf("logins = %d, want 2", logins)
+	}
+	mu.Lock()
+	if len(states) == 0 || states[0] != StateReconnecting || states[len(states)-1] != StateSubscribed {
+		t.Errorf("states = %v, want reconnecting ... subscribed", states)
+	}
+	mu.Unlock()
+
+	s.push(testArg, `[]`)
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message after reconnect not delivered")
+	}
+}
+
+func TestWebsocketSubscribeWhileReconnecting(t *testing.T) {
+	s := newStandIn(t)
+	c, err := newWebsocketClient(s.url(), false, "", "", "", false)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+	s.awaitAccepted(t)
+	c.SetReconnectPolicy(fastReconnects())
+
+	s.setRefuse(true)
+	s.drop()
+	eventually(t, "reconnecting", func() bool { return c.State() == StateReconnecting })
+
+	if err := c.Subscribe(testArg, func([]byte) {}); err != nil {
+		t.Fatalf("subscribe while reconnecting: %v", err)
+	}
+	s.setRefuse(false)
+	s.awaitAccepted(t)
+	eventually(t, "subscribed", func() bool { return c.State() == StateSubscribed })
+	if n := s.count(testArg); n != 1 {
+		t.Errorf("subscribe requests after reconnect = %d, want 1", n)
+	}
+}
+
+func TestWebsocketSubscribeDuringReconnectRace(t *testing.T) {
+	s := newStandIn(t)
+	c, err := newWebsocketClient(s.url(), false, "", "", "", false)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer c.Close()
+	s.awaitAccepted(t)
+	c.SetReconnectPolicy(fastReconnects())
+
+	// subscriptions keep coming in while the connection is dropped and
+	// restored; every one of them has to reach the server
+	const subscriptions = 50
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < subscriptions; i++ {
+			arg := WSSubscription{InstType: "USDT-FUTURES", Channel: "ticker", InstId: strings.Repeat("X", i+1)}
+			if err := c.Subscribe(arg, func([]byte) {}); err != nil {
+				t.Errorf("subscribe %d: %v", i, err)
+			}
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		s.drop()
+		s.awaitAccepted(t)
+	}
+	wg.Wait()
+
+	eventually(t, "all subscriptions sent", func() bool {
+		if c.State() != StateSubscribed {
+			return false
+		}
+		seen := make(map[WSSubscription]bool)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, sub := range s.subscribed {
+			seen[sub] = true
+		}
+		return len(seen) == subscriptions
+	})
+}
+
+func TestWebsocketCloseWhileReconnectPending(t *testing.T) {
+	s := newStandIn(t)
+	c, err := newWebsocketClient(s.url(), false, "", "", "", false)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	s.awaitAccepted(t)
+	c.SetReconnectPolicy(ReconnectPolicy{InitialDelay: time.Hour, MaxDelay: time.Hour, Multiplier: 1})
+
+	s.drop()
+	eventually(t, "reconnecting", func() bool { return c.State() == StateReconnecting })
+
+	closed := make(chan error, 1)
+	go func() { closed <- c.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("close: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked while a reconnect was pending")
+	}
+	if state := c.State(); state != StateClosed {
+		t.Errorf("state = %s, want closed", state)
+	}
+	if err := c.Send("{}"); err != ErrClosed {
+		t.Errorf("send after close = %v, want ErrClosed", err)
+	}
+	if err := c.Subscribe(testArg, func([]byte) {}); err == nil {
+		t.Error("subscribe after close succeeded")
+	}
+}
+
+// fakeClocked connects a client and switches it to a fake clock, waiting
+// until the running keepalive tickers moved to it
+func fakeClocked(t *testing.T, s *standIn) (*WebsocketClient, *clock.Fake) {
+	t.Helper()
+	c, err := newWebsocketClient(s.url(), false, "", "", "", false)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	s.awaitAccepted(t)
+
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	c.SetClock(fake)
+	eventually(t, "keepalive tickers on the fake clock", func() bool { return fake.Waiters() == 2 })
+	return c, fake
+}
+
+func TestWebsocketFakeClockPings(t *testing.T) {
+	s := newStandIn(t)
+	c, fake := fakeClocked(t, s)
+
+	fake.Advance(pingInterval - time.Second)
+	time.Sleep(20 * time.Millisecond)
+	if n := s.pingCount(); n != 0 {
+		t.Fatalf("pings = %d before the ping interval passed, want 0", n)
+	}
+	for i := 1; i <= 3; i++ {
+		fake.Advance(pingInterval)
+		eventually(t, "ping", func() bool { return s.pingCount() == i })
+	}
+	if state := c.State(); state != StateSubscribed {
+		t.Errorf("state = %s, want subscribed while pongs arrive", state)
+	}
+}
+
+func TestWebsocketFakeClockIdleTimeout(t *testing.T) {
+	s := newStandIn(t)
+	c, fake := fakeClocked(t, s)
+	c.SetReconnectPolicy(ReconnectPolicy{InitialDelay: time.Minute, MaxDelay: time.Minute, Multiplier: 1})
+	reconnected := make(chan struct{}, 1)
+	c.OnReconnect(func(time.Time) { reconnected <- struct{}{} })
+
+	s.setSilent(true)
+	fake.Advance(idleTimeout - idleCheckInterval)
+	time.Sleep(20 * time.Millisecond)
+	if state := c.State(); state != StateSubscribed {
+		t.Fatalf("state = %s before the idle timeout, want subscribed", state)
+	}
+	for i := 0; i < 3 && c.State() == StateSubscribed; i++ {
+		fake.Advance(idleCheckInterval)
+		time.Sleep(20 * time.Millisecond)
+	}
+	eventually(t, "reconnecting after the idle timeout", func() bool { return c.State() == StateReconnecting })
+
+	// the reconnect delay runs on the fake clock as well
+	s.setSilent(false)
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-reconnected:
+		t.Fatal("reconnected before the reconnect delay passed")
+	default:
+	}
+	eventually(t, "reconnect delay pending", func() bool { return fake.Waiters() == 1 })
+	fake.Advance(time.Minute)
+	s.awaitAccepted(t)
+	select {
+	case <-reconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not reconnected after the reconnect delay")
+	}
+}
+
+func TestWebsocketFakeClockAckTimeout(t *testing.T) {
+	s := newStandIn(t)
+	c, fake := fakeClocked(t, s)
+	s.setSilent(true)
+
+	result := make(chan error, 1)
+	go func() { result <- c.Subscribe(testArg, func([]byte) {}) }()
+	eventually(t, "subscribe waiting for its ack", func() bool { return fake.Waiters() == 3 })
+	fake.Advance(ackTimeout)
+	select {
+	case err := <-result:
+		if !errors.Is(err, ErrAckTimeout) {
+			t.Errorf("subscribe = %v, want ErrAckTimeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscribe did not time out on the fake clock")
+	}
+}
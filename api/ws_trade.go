@@ -0,0 +1,215 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const tradeTimeout = 5 * time.Second
+
+var ErrTradeTimeout = errors.New("timed out waiting for websocket trade response")
+
+// TradeError is returned when the exchange rejects a websocket trade request
+type TradeError struct {
+	Channel string
+	Code    int
+	Msg     string
+}
+
+func (e *TradeError) Error() string {
+	return fmt.Sprintf("websocket %s failed (code %d): %s", e.Channel, e.Code, e.Msg)
+}
+
+// TradeResult is the outcome of a single request of a batch
+type TradeResult struct {
+	OrderId string
+	Err     error
+}
+
+type wsTradeArg struct {
+	Id       string                 `json:"id"`
+	InstType string                 `json:"instType"`
+	InstId   string                 `json:"instId"`
+	Channel  string                 `json:"channel"`
+	Params   map[string]interface{} `json:"params"`
+}
+
+type wsTradeResponse struct {
+	Event string `json:"event"`
+	Arg   []struct {
+		Id      string `json:"id"`
+		Channel string `json:"channel"`
+		Params  struct {
+			OrderId   string `json:"orderId"`
+			ClientOid string `json:"clientOid"`
+		} `json:"params"`
+	} `json:"arg"`
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+}
+
+func (c *WebsocketClient) getMarginCoin() string {
+	if c.isDemoTrading {
+		return marginCoinDemo
+	}
+	return marginCoinLive
+}
+
+// PlaceOrder places a limit order over the websocket trade api
+func (c *WebsocketClient) PlaceOrder(order LimitOrder) (string, error) {
+	results, err := c.BatchPlaceOrders([]LimitOrder{order})
+	if err != nil {
+		return "", err
+	}
+	return results[0].OrderId, results[0].Err
+}
+
+// CancelOrder cancels an order over the websocket trade api
+func (c *WebsocketClient) CancelOrder(symbol string, orderId string) error {
+	results, err := c.BatchCancelOrders(symbol, []string{orderId})
+	if err != nil {
+		return err
+	}
+	return results[0].Err
+}
+
+// BatchPlaceOrders places several limit orders with a single trade request.
+// The returned results are in the order of orders.
+func (c *WebsocketClient) BatchPlaceOrders(orders []LimitOrder) ([]TradeResult, error) {
+	args := make([]wsTradeArg, 0, len(orders))
+	for _, order := range orders {
+		if err := c.validateSymbol(order.Symbol); err != nil {
+			return nil, err
+		}
+		params := map[string]interface{}{
+			"orderType":  "limit",
+			"side":       order.Side,
+			"size":       formatSize(order.Size),
+			"price":      formatPrice(order.Price),
+			"force":      "gtc",
+			"marginCoin": c.getMarginCoin(),
+			"marginMode": "isolated",
+			"reduceOnly": "NO",
+		}
+		if order.ClientOid != "" {
+			params["clientOid"] = order.ClientOid
+		}
+		args = append(args, c.tradeArg("place-order", order.Symbol, params))
+	}
+	return c.trade(args)
+}
+
+// BatchCancelOrders cancels several orders of symbol with a single trade request
+func (c *WebsocketClient) BatchCancelOrders(symbol string, orderIds []string) ([]TradeResult, error) {
+	if err := c.validateSymbol(symbol); err != nil {
+		return nil, err
+	}
+	args := make([]wsTradeArg, 0, len(orderIds))
+	for _, orderId := range orderIds {
+		args = append(args, c.tradeArg("cancel-order", symbol, map[string]interface{}{
+			"orderId":    orderId,
+			"marginCoin": c.getMarginCoin(),
+		}))
+	}
+	return c.trade(args)
+}
+
+func (c *WebsocketClient) tradeArg(channel, symbol string, params map[string]interface{}) wsTradeArg {
+	c.mu.Lock()
+	c.nextTradeId++
+	id := strconv.FormatInt(c.nextTradeId, 10)
+	c.mu.Unlock()
+
+	return wsTradeArg{
+		Id:       id,
+		InstType: c.InstType(),
+		InstId:   symbol,
+		Channel:  channel,
+		Params:   params,
+	}
+}
+
+// trade sends the trade request and waits for the response of every arg,
+// correlated by request id
+func (c *WebsocketClient) trade(args []wsTradeArg) ([]TradeResult, error) {
+	if !c.private {
+		return nil, errors.New("websocket trading requires the private endpoint")
+	}
+
+	waiters := make([]chan TradeResult, len(args))
+	c.mu.Lock()
+	for i, arg := range args {
+		waiters[i] = make(chan TradeResult, 1)
+		c.pendingTrades[arg.Id] = waiters[i]
+	}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		for _, arg := range args {
+			delete(c.pendingTrades, arg.Id)
+		}
+		c.mu.Unlock()
+	}()
+
+	msg, err := c.toJson(map[string]interface{}{
+		"op":   "trade",
+		"args": args,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Send(msg); err != nil {
+		return nil, err
+	}
+
+	timeout := c.getClock().NewTimer(tradeTimeout)
+	defer timeout.Stop()
+
+	results := make([]TradeResult, len(args))
+	for i, waiter := range waiters {
+		select {
+		case results[i] = <-waiter:
+		case <-timeout.C():
+			return nil, fmt.Errorf("%w: %s %s", ErrTradeTimeout, args[i].Channel, args[i].Id)
+		case <-c.done:
+			return nil, ErrClosed
+		}
+	}
+	return results, nil
+}
+
+// handleTradeResponse resolves pending trade requests. It reports false if
+// message is not a trade response, which is recognized by its arg list.
+func (c *WebsocketClient) handleTradeResponse(message []byte) bool {
+	var envelope struct {
+		Arg json.RawMessage `json:"arg"`
+	}
+	if err := json.Unmarshal(message, &envelope); err != nil || !bytes.HasPrefix(bytes.TrimSpace(envelope.Arg), []byte("[")) {
+		return false
+	}
+
+	var resp wsTradeResponse
+	if err := json.Unmarshal(message, &resp); err != nil {
+		return false
+	}
+
+	for _, arg := range resp.Arg {
+		result := TradeResult{OrderId: arg.Params.OrderId}
+		if resp.Event == "error" || resp.Code != 0 {
+			result.Err = &TradeError{Channel: arg.Channel, Code: resp.Code, Msg: resp.Msg}
+		}
+
+		c.mu.Lock()
+		waiter, ok := c.pendingTrades[arg.Id]
+		delete(c.pendingTrades, arg.Id)
+		c.mu.Unlock()
+		if ok {
+			waiter <- result
+		}
+	}
+	return true
+}
@@ -0,0 +1,211 @@
+package backtest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"botcoin/api"
+	"botcoin/clock"
+	"botcoin/config"
+	"botcoin/marketdata"
+	"botcoin/sim"
+	"botcoin/trading"
+)
+
+// ErrInsufficientData is returned when the candles don't cover a symbol or
+// its warm-up
+var ErrInsufficientData = errors.New("insufficient candles")
+
+// EquityPoint is the account equity after a simulated time step
+type EquityPoint struct {
+	Time   time.Time
+	Equity float64
+}
+
+// Result summarizes a backtest run
+type Result struct {
+	Start           time.Time
+	End             time.Time
+	StartEquity     float64
+	EndEquity       float64
+	Return          float64 // in percent
+	MaxDrawdown     float64 // in percent of the peak equity
+	TimeInPosition  time.Duration
+	CompletedCycles int
+	Fills           int
+	FeesPaid        float64
+	FundingPaid     float64
+	RealizedPnL     float64
+	EquityCurve     []EquityPoint
+}
+
+// Exposure returns the fraction of the tested period with an open position
+func (r *Result) Exposure() float64 {
+	total := r.End.Sub(r.Start)
+	if total <= 0 {
+		return 0
+	}
+	return float64(r.TimeInPosition) / float64(total)
+}
+
+// NetPnL returns the realized PnL after fees and funding
+func (r *Result) NetPnL() float64 {
+	return r.RealizedPnL - r.FeesPaid - r.FundingPaid
+}
+
+// Print writes a human readable summary
+func (r *Result) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Period\t%s - %s\n", r.Start.Format(time.DateTime), r.End.Format(time.DateTime))
+	fmt.Fprintf(tw, "Equity\t%.2f -> %.2f\n", r.StartEquity, r.EndEquity)
+	fmt.Fprintf(tw, "Return\t%.2f%%\n", r.Return)
+	fmt.Fprintf(tw, "Max drawdown\t%.2f%%\n", r.MaxDrawdown)
+	fmt.Fprintf(tw, "Time in position\t%s (%.1f%%)\n", r.TimeInPosition.Round(time.Minute), r.Exposure()*100)
+	fmt.Fprintf(tw, "Completed cycles\t%d\n", r.CompletedCycles)
+	fmt.Fprintf(tw, "Fills\t%d\n", r.Fills)
+	fmt.Fprintf(tw, "Realized PnL\t%.2f\n", r.RealizedPnL)
+	fmt.Fprintf(tw, "Fees paid\t%.2f\n", r.FeesPaid)
+	fmt.Fprintf(tw, "Funding paid\t%.2f\n", r.FundingPaid)
+	fmt.Fprintf(tw, "Net PnL\t%.2f\n", r.NetPnL())
+	tw.Flush()
+}
+
+// LoadCandles loads the stored candles of all symbols of cfg
+func LoadCandles(cfg *config.Config, dir, granularity string) (map[string][]api.Candle, error) {
+	store := marketdata.NewStore(dir)
+	candles := make(map[string][]api.Candle)
+	for _, process := range cfg.TradingProcesses {
+		symbolCandles, err := store.Load(process.Symbol, granularity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load candles for %s: %w", process.Symbol, err)
+		}
+		if len(symbolCandles) == 0 {
+			return nil, fmt.Errorf("no candles stored for %s", process.Symbol)
+		}
+		candles[process.Symbol] = symbolCandles
+	}
+	return candles, nil
+}
+
+// candleInterval returns the smallest distance between consecutive candles
+func candleInterval(candles map[string][]api.Candle) time.Duration {
+	var interval time.Duration
+	for _, symbolCandles := range candles {
+		for i := 1; i < len(symbolCandles); i++ {
+			if d := symbolCandles[i].Timestamp.Sub(symbolCandles[i-1].Timestamp); d > 0 && (interval == 0 || d < interval) {
+				interval = d
+			}
+		}
+	}
+	return interval
+}
+
+type step struct {
+	symbol string
+	candle api.Candle
+}
+
+// Run replays candles through a simulated exchange driven by the same trading
+// logic as the live bot
+func Run(cfg *config.Config, candles map[string][]api.Candle, options sim.Options) (*Result, error) {
+	var steps []step
+	if options.CandleInterval == 0 {
+		options.CandleInterval = candleInterval(candles)
+	}
+	exchange := sim.NewExchange(options)
+	for _, process := range cfg.TradingProcesses {
+		symbolCandles := candles[process.Symbol]
+		if len(symbolCandles) == 0 {
+			return nil, fmt.Errorf("%w: no candles for %s", ErrInsufficientData, process.Symbol)
+		}
+		// candles needed to measure the volatility or evaluate the entry
+		// filters of the first ladder are history rather than traded
+		if warmup := trading.LadderWarmup(process); warmup > 0 {
+			start := symbolCandles[0].Timestamp.Add(warmup)
+			i := sort.Search(len(symbolCandles), func(i int) bool { return !symbolCandles[i].Timestamp.Before(start) })
+			if i == len(symbolCandles) {
+				return nil, fmt.Errorf("%w: not enough candles for %s to warm up for %s", ErrInsufficientData, process.Symbol, warmup)
+			}
+			exchange.AddHistory(process.Symbol, symbolCandles[:i])
+			symbolCandles = symbolCandles[i:]
+		}
+		first := symbolCandles[0]
+		exchange.SetPrice(process.Symbol, first.Open, first.Timestamp)
+		for _, candle := range symbolCandles {
+			steps = append(steps, step{symbol: process.Symbol, candle: candle})
+		}
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].candle.Timestamp.Before(steps[j].candle.Timestamp)
+	})
+
+	bot, err := trading.NewSimulatedBot(cfg, exchange)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create simulated bot: %w", err)
+	}
+	// the ladders start over after every take-profit, so the completed cycles
+	// and the ranking of a sweep cover the whole period
+	bot.SetRepeatCycles(true)
+	simClock := clock.NewFake(steps[0].candle.Timestamp)
+	bot.SetClock(simClock)
+	exchange.SetClock(simClock)
+	exchange.OnFill(bot.HandleOrderUpdate)
+	exchange.OnStep(func(symbol string, candle api.Candle) {
+		bot.HandlePrice(symbol, candle.Close)
+		bot.HandleTimer(simClock.Now())
+	})
+	if err := bot.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start simulated bot: %w", err)
+	}
+	defer bot.Stop()
+
+	result := &Result{
+		Start:       steps[0].candle.Timestamp,
+		StartEquity: exchange.Equity(),
+	}
+	peak := result.StartEquity
+	var lastTime time.Time
+	inPosition := false
+	for _, s := range steps {
+		if inPosition && !lastTime.IsZero() {
+			result.TimeInPosition += s.candle.Timestamp.Sub(lastTime)
+		}
+		lastTime = s.candle.Timestamp
+
+		exchange.Step(s.symbol, s.candle)
+
+		inPosition = false
+		for _, process := range cfg.TradingProcesses {
+			if exchange.HasPosition(process.Symbol) {
+				inPosition = true
+				break
+			}
+		}
+
+		equity := exchange.Equity()
+		result.EquityCurve = append(result.EquityCurve, EquityPoint{Time: s.candle.Timestamp, Equity: equity})
+		if equity > peak {
+			peak = equity
+		}
+		if peak > 0 {
+			result.MaxDrawdown = max(result.MaxDrawdown, (peak-equity)/peak*100)
+		}
+	}
+
+	stats := exchange.Stats()
+	result.End = lastTime
+	result.EndEquity = exchange.Equity()
+	if result.StartEquity != 0 {
+		result.Return = (result.EndEquity - result.StartEquity) / result.StartEquity * 100
+	}
+	result.CompletedCycles = stats.ClosedPositions
+	result.Fills = stats.Fills
+	result.FeesPaid = stats.FeesPaid
+	result.FundingPaid = stats.FundingPaid
+	result.RealizedPnL = stats.RealizedPnL
+	return result, nil
+}
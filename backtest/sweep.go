@@ -0,0 +1,544 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"botcoin/api"
+	"botcoin/config"
+	"botcoin/sim"
+)
+
+// Range lists the values of a swept parameter, either explicitly or as
+// min..max in steps
+type Range struct {
+	Min    float64   `json:"min"`
+	Max    float64   `json:"max"`
+	Step   float64   `json:"step"`
+	Values []float64 `json:"values"`
+}
+
+func (r Range) values() ([]float64, error) {
+	if len(r.Values) > 0 {
+		return r.Values, nil
+	}
+	if r.Step <= 0 || r.Max < r.Min {
+		return nil, fmt.Errorf("invalid range: min %v, max %v, step %v", r.Min, r.Max, r.Step)
+	}
+	var values []float64
+	for v := r.Min; v <= r.Max+r.Step*1e-9; v += r.Step {
+		values = append(values, math.Round(v*1e9)/1e9)
+	}
+	return values, nil
+}
+
+// LoadRanges reads the swept parameters from a JSON file mapping parameter
+// paths of TradingProcessConfig, e.g. "sell_target_percent" or
+// "buy_orders[0].coin_price_below_percent", to ranges
+func LoadRanges(path string) (map[string]Range, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var ranges map[string]Range
+	if err := json.Unmarshal(data, &ranges); err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
+
+// ParamSet is one combination of swept parameter values
+type ParamSet map[string]float64
+
+// Metrics are the figures a parameter set is ranked by
+type Metrics struct {
+	Return          float64 `json:"return"`       // in percent
+	MaxDrawdown     float64 `json:"max_drawdown"` // in percent
+	Sharpe          float64 `json:"sharpe"`       // annualized from daily returns
+	CompletedCycles float64 `json:"completed_cycles"`
+}
+
+func metricsOf(result *Result) Metrics {
+	return Metrics{
+		Return:          result.Return,
+		MaxDrawdown:     result.MaxDrawdown,
+		Sharpe:          sharpe(result.EquityCurve),
+		CompletedCycles: float64(result.CompletedCycles),
+	}
+}
+
+func averageMetrics(metrics []Metrics) Metrics {
+	var avg Metrics
+	for _, m := range metrics {
+		avg.Return += m.Return / float64(len(metrics))
+		avg.MaxDrawdown += m.MaxDrawdown / float64(len(metrics))
+		avg.Sharpe += m.Sharpe / float64(len(metrics))
+		avg.CompletedCycles += m.CompletedCycles / float64(len(metrics))
+	}
+	return avg
+}
+
+// sharpe returns the annualized Sharpe ratio of the daily returns of curve
+func sharpe(curve []EquityPoint) float64 {
+	var daily []float64
+	var dayEquity float64
+	var day time.Time
+	for _, point := range curve {
+		pointDay := point.Time.Truncate(24 * time.Hour)
+		if day.IsZero() {
+			day, dayEquity = pointDay, point.Equity
+			continue
+		}
+		if pointDay.After(day) {
+			daily = append(daily, point.Equity/dayEquity-1)
+			day, dayEquity = pointDay, point.Equity
+		}
+	}
+	if len(daily) < 2 {
+		return 0
+	}
+
+	var mean float64
+	for _, r := range daily {
+		mean += r / float64(len(daily))
+	}
+	var variance float64
+	for _, r := range daily {
+		variance += (r - mean) * (r - mean) / float64(len(daily)-1)
+	}
+	if variance == 0 {
+		return 0
+	}
+	return mean / math.Sqrt(variance) * math.Sqrt(365)
+}
+
+// SweepOptions configure a parameter sweep
+type SweepOptions struct {
+	Ranges   map[string]Range
+	Exchange sim.Options
+	Folds    int    // walk-forward folds, 0 evaluates every set on the full data
+	Workers  int    // parallel backtests, defaults to the number of CPUs
+	RankBy   string // "return" (default), "drawdown" or "sharpe"
+}
+
+// SweepResult holds the in-sample metrics of one parameter set, averaged
+// over the segments it could be backtested on
+type SweepResult struct {
+	Params   ParamSet `json:"params"`
+	InSample Metrics  `json:"in_sample"`
+}
+
+// FoldResult is one walk-forward step: the best set on the training segment
+// evaluated on the following test segment
+type FoldResult struct {
+	Fold      int       `json:"fold"`
+	TestStart time.Time `json:"test_start"`
+	TestEnd   time.Time `json:"test_end"`
+	Params    ParamSet  `json:"params,omitempty"`
+	Train     Metrics   `json:"train"`
+	Test      Metrics   `json:"test"`
+	Skipped   string    `json:"skipped,omitempty"` // why the fold couldn't be evaluated
+}
+
+// SkippedRun is a backtest of a set on a segment that lacked candles, e.g.
+// for the warm-up of a symbol
+type SkippedRun struct {
+	Params ParamSet  `json:"params"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Reason string    `json:"reason"`
+}
+
+// SweepReport is the ranked outcome of a sweep. Results are ranked in-sample;
+// only OutOfSample, stitched from the test segments of the walk-forward
+// folds, measures how the parameter selection does on unseen data.
+type SweepReport struct {
+	RankBy      string        `json:"rank_by"`
+	Results     []SweepResult `json:"results"`
+	WalkForward []FoldResult  `json:"walk_forward,omitempty"`
+	OutOfSample *Metrics      `json:"out_of_sample,omitempty"`
+	Skipped     []SkippedRun  `json:"skipped,omitempty"`
+}
+
+// Sweep backtests every combination of the swept parameters in parallel and
+// ranks them. With walk-forward folds the data is split into Folds+1
+// consecutive segments; for each fold the best set on segment i is chosen
+// and only that set is evaluated on segment i+1.
+func Sweep(cfg *config.Config, candles map[string][]api.Candle, options SweepOptions) (*SweepReport, error) {
+	paramSets, err := expand(options.Ranges)
+	if err != nil {
+		return nil, err
+	}
+	segments := splitCandles(candles, options.Folds+1)
+	workers := options.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	report := &SweepReport{RankBy: options.RankBy}
+	if report.RankBy == "" {
+		report.RankBy = "return"
+	}
+
+	type job struct{ set, segment int }
+	results := make([][]*Result, len(paramSets))
+	skipped := make([][]string, len(paramSets))
+	for i := range results {
+		results[i] = make([]*Result, len(segments))
+		skipped[i] = make([]string, len(segments))
+	}
+
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+	fail := func(err error) {
+		errMu.Lock()
+		defer errMu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				setCfg, err := applyParams(cfg, paramSets[j.set])
+				if err != nil {
+					fail(err)
+					continue
+				}
+				result, err := Run(setCfg, segments[j.segment].candles, options.Exchange)
+				switch {
+				case errors.Is(err, ErrInsufficientData):
+					skipped[j.set][j.segment] = err.Error()
+				case err != nil:
+					fail(fmt.Errorf("backtest of %v failed: %w", paramSets[j.set], err))
+				default:
+					result.EquityCurve = compact(result.EquityCurve)
+					results[j.set][j.segment] = result
+				}
+			}
+		}()
+	}
+	go func() {
+		for set := range paramSets {
+			for segment := range segments {
+				jobs <- job{set, segment}
+			}
+		}
+		close(jobs)
+	}()
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	for i, params := range paramSets {
+		var metrics []Metrics
+		for j, result := range results[i] {
+			if result != nil {
+				metrics = append(metrics, metricsOf(result))
+				continue
+			}
+			report.Skipped = append(report.Skipped, SkippedRun{
+				Params: params,
+				Start:  segments[j].start,
+				End:    segments[j].end,
+				Reason: skipped[i][j],
+			})
+		}
+		if len(metrics) > 0 {
+			report.Results = append(report.Results, SweepResult{Params: params, InSample: averageMetrics(metrics)})
+		}
+	}
+	if len(report.Results) == 0 {
+		return nil, fmt.Errorf("%w: no parameter set could be backtested on any segment", ErrInsufficientData)
+	}
+
+	better := func(a, b Metrics) bool {
+		switch report.RankBy {
+		case "drawdown":
+			return a.MaxDrawdown < b.MaxDrawdown
+		case "sharpe":
+			return a.Sharpe > b.Sharpe
+		}
+		return a.Return > b.Return
+	}
+	sort.SliceStable(report.Results, func(i, j int) bool {
+		return better(report.Results[i].InSample, report.Results[j].InSample)
+	})
+
+	var tests []*Result
+	for fold := 0; fold < options.Folds; fold++ {
+		foldResult := FoldResult{
+			Fold:      fold + 1,
+			TestStart: segments[fold+1].start,
+			TestEnd:   segments[fold+1].end,
+		}
+		best := -1
+		for i := range paramSets {
+			if results[i][fold] == nil {
+				continue
+			}
+			if best < 0 || better(metricsOf(results[i][fold]), metricsOf(results[best][fold])) {
+				best = i
+			}
+		}
+		switch {
+		case best < 0:
+			foldResult.Skipped = "no parameter set could be backtested on the training segment"
+		case results[best][fold+1] == nil:
+			foldResult.Params = paramSets[best]
+			foldResult.Train = metricsOf(results[best][fold])
+			foldResult.Skipped = skipped[best][fold+1]
+		default:
+			foldResult.Params = paramSets[best]
+			foldResult.Train = metricsOf(results[best][fold])
+			foldResult.Test = metricsOf(results[best][fold+1])
+			tests = append(tests, results[best][fold+1])
+		}
+		report.WalkForward = append(report.WalkForward, foldResult)
+	}
+	if len(tests) > 0 {
+		outOfSample := stitch(tests)
+		report.OutOfSample = &outOfSample
+	}
+	return report, nil
+}
+
+// compact keeps the last equity point of every hour, enough for the daily
+// returns of the Sharpe ratio, so the curves of all runs fit in memory. The
+// drawdown is taken from the result itself.
+func compact(curve []EquityPoint) []EquityPoint {
+	var compacted []EquityPoint
+	for i, point := range curve {
+		if i == len(curve)-1 || !curve[i+1].Time.Truncate(time.Hour).Equal(point.Time.Truncate(time.Hour)) {
+			compacted = append(compacted, point)
+		}
+	}
+	return compacted
+}
+
+// stitch chains the test results of the walk-forward folds into one equity
+// curve, as if the selected sets had traded one after another. Drawdowns
+// spanning segments are measured on the compacted curves.
+func stitch(tests []*Result) Metrics {
+	var curve []EquityPoint
+	var metrics Metrics
+	growth, peak := 1.0, 1.0
+	for _, result := range tests {
+		metrics.MaxDrawdown = max(metrics.MaxDrawdown, result.MaxDrawdown)
+		for _, point := range result.EquityCurve {
+			equity := growth * point.Equity / result.StartEquity
+			curve = append(curve, EquityPoint{Time: point.Time, Equity: equity})
+			peak = max(peak, equity)
+			metrics.MaxDrawdown = max(metrics.MaxDrawdown, (peak-equity)/peak*100)
+		}
+		growth *= result.EndEquity / result.StartEquity
+		metrics.CompletedCycles += float64(result.CompletedCycles)
+	}
+	metrics.Return = (growth - 1) * 100
+	metrics.Sharpe = sharpe(curve)
+	return metrics
+}
+
+// expand returns the cartesian product of all ranges
+func expand(ranges map[string]Range) ([]ParamSet, error) {
+	names := make([]string, 0, len(ranges))
+	for name := range ranges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sets := []ParamSet{{}}
+	for _, name := range names {
+		values, err := ranges[name].values()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		var next []ParamSet
+		for _, set := range sets {
+			for _, value := range values {
+				extended := ParamSet{name: value}
+				for k, v := range set {
+					extended[k] = v
+				}
+				next = append(next, extended)
+			}
+		}
+		sets = next
+	}
+	return sets, nil
+}
+
+var pathSegment = regexp.MustCompile(`^([a-z_]+)(?:\[(\d+)\])?$`)
+
+// applyParams returns a copy of cfg with the parameters set on every trading process
+func applyParams(cfg *config.Config, params ParamSet) (*config.Config, error) {
+	copied := *cfg
+	copied.TradingProcesses = make([]config.TradingProcessConfig, len(cfg.TradingProcesses))
+	for i, process := range cfg.TradingProcesses {
+		data, err := json.Marshal(process)
+		if err != nil {
+			return nil, err
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+		for path, value := range params {
+			if err := setPath(fields, path, value); err != nil {
+				return nil, err
+			}
+		}
+		if data, err = json.Marshal(fields); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &copied.TradingProcesses[i]); err != nil {
+			return nil, fmt.Errorf("failed to apply %v: %w", params, err)
+		}
+	}
+	return &copied, nil
+}
+
+func setPath(fields map[string]interface{}, path string, value float64) error {
+	parts := strings.Split(path, ".")
+	current := fields
+	for i, part := range parts {
+		match := pathSegment.FindStringSubmatch(part)
+		if match == nil {
+			return fmt.Errorf("invalid parameter path: %s", path)
+		}
+		name, index := match[1], match[2]
+		last := i == len(parts)-1
+
+		if index == "" {
+			if last {
+				current[name] = value
+				return nil
+			}
+			next, ok := current[name].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("parameter path %s: %s is not an object", path, name)
+			}
+			current = next
+			continue
+		}
+
+		list, ok := current[name].([]interface{})
+		idx, _ := strconv.Atoi(index)
+		if !ok || idx >= len(list) {
+			return fmt.Errorf("parameter path %s: %s has no element %d", path, name, idx)
+		}
+		if last {
+			list[idx] = value
+			return nil
+		}
+		next, ok := list[idx].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("parameter path %s: %s[%d] is not an object", path, name, idx)
+		}
+		current = next
+	}
+	return nil
+}
+
+type segment struct {
+	start   time.Time
+	end     time.Time
+	candles map[string][]api.Candle
+}
+
+// splitCandles splits the candles into n consecutive segments of equal duration
+func splitCandles(candles map[string][]api.Candle, n int) []segment {
+	var start, end time.Time
+	for _, symbolCandles := range candles {
+		if len(symbolCandles) == 0 {
+			continue
+		}
+		if first := symbolCandles[0].Timestamp; start.IsZero() || first.Before(start) {
+			start = first
+		}
+		if last := symbolCandles[len(symbolCandles)-1].Timestamp; last.After(end) {
+			end = last
+		}
+	}
+
+	length := end.Sub(start) / time.Duration(n)
+	segments := make([]segment, n)
+	for i := range segments {
+		segments[i] = segment{
+			start:   start.Add(time.Duration(i) * length),
+			end:     start.Add(time.Duration(i+1) * length),
+			candles: make(map[string][]api.Candle),
+		}
+	}
+	segments[n-1].end = end.Add(time.Nanosecond)
+
+	for symbol, symbolCandles := range candles {
+		for _, candle := range symbolCandles {
+			for i := range segments {
+				if !candle.Timestamp.Before(segments[i].start) && candle.Timestamp.Before(segments[i].end) {
+					segments[i].candles[symbol] = append(segments[i].candles[symbol], candle)
+					break
+				}
+			}
+		}
+	}
+	return segments
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *SweepReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteCSV writes one row per parameter set in ranking order
+func (r *SweepReport) WriteCSV(w io.Writer) error {
+	var names []string
+	if len(r.Results) > 0 {
+		for name := range r.Results[0].Params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	header := append([]string{"rank"}, names...)
+	header = append(header, "return", "max_drawdown", "sharpe", "completed_cycles")
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 4, 64)
+	}
+	for i, result := range r.Results {
+		row := []string{strconv.Itoa(i + 1)}
+		for _, name := range names {
+			row = append(row, format(result.Params[name]))
+		}
+		m := result.InSample
+		row = append(row, format(m.Return), format(m.MaxDrawdown), format(m.Sharpe), format(m.CompletedCycles))
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
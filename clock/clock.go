@@ -0,0 +1,212 @@
+// Package clock abstracts time, so the trading logic and the websocket client
+// can run on simulated time in backtests, replays and tests.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and schedules timers
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a time.Timer of a Clock
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Ticker is a time.Ticker of a Clock
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the wall clock
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct{ *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.Timer.C }
+
+type realTicker struct{ *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// Fake is a manually advanced clock. Timers and tickers fire when the clock
+// is advanced past their deadline. Like their real counterparts their
+// channels hold a single tick and further ticks are dropped while it is
+// not received.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	fake     *Fake
+	deadline time.Time
+	period   time.Duration // tickers only
+	c        chan time.Time
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// Sleep blocks until the clock has been advanced by d
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.schedule(d, 0)
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return fakeTicker{f.schedule(d, d)}
+}
+
+func (f *Fake) schedule(d, period time.Duration) *fakeWaiter {
+	w := &fakeWaiter{fake: f, period: period, c: make(chan time.Time, 1)}
+	f.mu.Lock()
+	w.deadline = f.now.Add(d)
+	f.waiters = append(f.waiters, w)
+	f.mu.Unlock()
+	if d <= 0 {
+		f.Advance(0)
+	}
+	return w
+}
+
+// Advance moves the clock forward by d, firing every timer and ticker due
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	f.set(f.now.Add(d))
+}
+
+// Set moves the clock forward to t. Earlier times are ignored.
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	if t.Before(f.now) {
+		t = f.now
+	}
+	f.set(t)
+}
+
+// set is called holding the lock and releases it
+func (f *Fake) set(t time.Time) {
+	f.now = t
+	type tick struct {
+		c    chan time.Time
+		time time.Time
+	}
+	var ticks []tick
+	remaining := f.waiters[:0]
+	for _, w := range f.waiters {
+		for !w.deadline.After(t) {
+			ticks = append(ticks, tick{c: w.c, time: w.deadline})
+			if w.period == 0 {
+				break
+			}
+			w.deadline = w.deadline.Add(w.period)
+		}
+		if w.deadline.After(t) {
+			remaining = append(remaining, w)
+		}
+	}
+	f.waiters = remaining
+	f.mu.Unlock()
+
+	sort.SliceStable(ticks, func(i, j int) bool {
+		return ticks[i].time.Before(ticks[j].time)
+	})
+	for _, tick := range ticks {
+		select {
+		case tick.c <- tick.time:
+		default:
+		}
+	}
+}
+
+// Waiters returns the number of pending timers and tickers, e.g. to wait in
+// tests until a goroutine started waiting before advancing the clock
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *fakeWaiter) Stop() bool {
+	w.fake.mu.Lock()
+	defer w.fake.mu.Unlock()
+	return w.fake.remove(w)
+}
+
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	f := w.fake
+	f.mu.Lock()
+	active := f.remove(w)
+	w.deadline = f.now.Add(d)
+	f.waiters = append(f.waiters, w)
+	f.mu.Unlock()
+	if d <= 0 {
+		f.Advance(0)
+	}
+	return active
+}
+
+type fakeTicker struct{ *fakeWaiter }
+
+func (t fakeTicker) Stop() {
+	t.fakeWaiter.Stop()
+}
+
+func (f *Fake) remove(w *fakeWaiter) bool {
+	for i, waiter := range f.waiters {
+		if waiter == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
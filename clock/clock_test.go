@@ -0,0 +1,168 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// received returns the pending tick of c, if any
+func received(c <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-c:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		advance []time.Duration
+		fired   bool
+	}{
+		{"before deadline", time.Minute, []time.Duration{59 * time.Second}, false},
+		{"at deadline", time.Minute, []time.Duration{time.Minute}, true},
+		{"in steps", time.Minute, []time.Duration{30 * time.Second, 30 * time.Second}, true},
+		{"past deadline", time.Minute, []time.Duration{time.Hour}, true},
+		{"zero timeout", 0, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFake(start)
+			timer := f.NewTimer(tt.timeout)
+			for _, d := range tt.advance {
+				f.Advance(d)
+			}
+			tick, fired := received(timer.C())
+			if fired != tt.fired {
+				t.Fatalf("fired = %v, want %v", fired, tt.fired)
+			}
+			if fired && !tick.Equal(start.Add(tt.timeout)) {
+				t.Errorf("tick = %v, want the deadline %v", tick, start.Add(tt.timeout))
+			}
+			if fired && f.Waiters() != 0 {
+				t.Errorf("waiters = %d after the timer fired, want 0", f.Waiters())
+			}
+		})
+	}
+}
+
+func TestFakeTimerStopAndReset(t *testing.T) {
+	f := NewFake(start)
+	timer := f.NewTimer(time.Minute)
+	if !timer.Stop() {
+		t.Error("Stop of a pending timer returned false")
+	}
+	f.Advance(time.Hour)
+	if _, fired := received(timer.C()); fired {
+		t.Error("stopped timer fired")
+	}
+	if timer.Stop() {
+		t.Error("Stop of a stopped timer returned true")
+	}
+
+	if timer.Reset(time.Minute) {
+		t.Error("Reset of a stopped timer returned true")
+	}
+	f.Advance(30 * time.Second)
+	if !timer.Reset(time.Minute) {
+		t.Error("Reset of a pending timer returned false")
+	}
+	f.Advance(59 * time.Second)
+	if _, fired := received(timer.C()); fired {
+		t.Fatal("reset timer fired at its old deadline")
+	}
+	f.Advance(time.Second)
+	if tick, fired := received(timer.C()); !fired || !tick.Equal(start.Add(time.Hour+90*time.Second)) {
+		t.Errorf("reset timer tick = %v, %v, want %v", tick, fired, start.Add(time.Hour+90*time.Second))
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(start)
+	ticker := f.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	f.Advance(time.Minute)
+	if tick, ok := received(ticker.C()); !ok || !tick.Equal(start.Add(time.Minute)) {
+		t.Fatalf("first tick = %v, %v, want %v", tick, ok, start.Add(time.Minute))
+	}
+	f.Advance(30 * time.Second)
+	if _, ok := received(ticker.C()); ok {
+		t.Fatal("ticked before its period passed")
+	}
+
+	// like time.Ticker, ticks are dropped while one is pending
+	f.Advance(5 * time.Minute)
+	if tick, ok := received(ticker.C()); !ok || !tick.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("tick after a long advance = %v, %v, want the oldest due %v", tick, ok, start.Add(2*time.Minute))
+	}
+	if _, ok := received(ticker.C()); ok {
+		t.Error("more than one tick pending")
+	}
+	if f.Waiters() != 1 {
+		t.Errorf("waiters = %d, want the ticker", f.Waiters())
+	}
+
+	ticker.Stop()
+	f.Advance(time.Hour)
+	if _, ok := received(ticker.C()); ok {
+		t.Error("stopped ticker ticked")
+	}
+	if f.Waiters() != 0 {
+		t.Errorf("waiters = %d after Stop, want 0", f.Waiters())
+	}
+}
+
+func TestFakeSet(t *testing.T) {
+	f := NewFake(start)
+	timer := f.NewTimer(time.Hour)
+
+	f.Set(start.Add(-time.Hour))
+	if !f.Now().Equal(start) {
+		t.Errorf("now = %v after setting an earlier time, want %v", f.Now(), start)
+	}
+	f.Set(start.Add(2 * time.Hour))
+	if !f.Now().Equal(start.Add(2 * time.Hour)) {
+		t.Errorf("now = %v, want %v", f.Now(), start.Add(2*time.Hour))
+	}
+	if _, fired := received(timer.C()); !fired {
+		t.Error("timer did not fire when the clock was set past its deadline")
+	}
+	if d := f.Since(start); d != 2*time.Hour {
+		t.Errorf("since = %v, want 2h", d)
+	}
+}
+
+func TestFakeSleep(t *testing.T) {
+	f := NewFake(start)
+	done := make(chan struct{})
+	go func() {
+		f.Sleep(time.Minute)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for f.Waiters() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Sleep did not start waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	f.Advance(59 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("Sleep returned before the clock advanced far enough")
+	case <-time.After(10 * time.Millisecond):
+	}
+	f.Advance(time.Second)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Sleep did not return after the clock advanced")
+	}
+}
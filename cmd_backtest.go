@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"botcoin/backtest"
+	"botcoin/config"
+	"botcoin/sim"
+)
+
+// simFlags registers the flags configuring the simulated exchange
+func simFlags(flags *flag.FlagSet) *sim.Options {
+	options := &sim.Options{}
+	flags.Float64Var(&options.InitialBalance, "balance", 10000, "initial balance in the margin coin")
+	flags.Float64Var(&options.Fees.Maker, "maker-fee", 0.0002, "maker fee rate")
+	flags.Float64Var(&options.Fees.Taker, "taker-fee", 0.0006, "taker fee rate")
+	flags.Float64Var(&options.FundingRate, "funding-rate", 0.0001, "funding rate charged every 8 hours")
+	flags.Func("fill", "fill model: touch or trade-through (default touch)", func(value string) error {
+		switch sim.FillModel(value) {
+		case sim.FillOnTouch, sim.FillOnTradeThrough:
+			options.FillModel = sim.FillModel(value)
+			return nil
+		}
+		return fmt.Errorf("unknown fill model: %s", value)
+	})
+	return options
+}
+
+// runBacktest implements "botcoin backtest"
+func runBacktest(args []string) error {
+	flags := flag.NewFlagSet("backtest", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "path to configuration file")
+	dataDir := flags.String("data", "data", "directory of the candle store")
+	granularity := flags.String("granularity", "1m", "candle granularity to replay")
+	verbose := flags.Bool("v", false, "log the simulated trading activity")
+	options := simFlags(flags)
+	flags.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	candles, err := backtest.LoadCandles(cfg, *dataDir, *granularity)
+	if err != nil {
+		return err
+	}
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+	result, err := backtest.Run(cfg, candles, *options)
+	if err != nil {
+		return err
+	}
+	result.Print(os.Stdout)
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"botcoin/api"
+	"botcoin/config"
+	"botcoin/marketdata"
+)
+
+// runData implements "botcoin data fetch"
+func runData(args []string) error {
+	if len(args) == 0 || args[0] != "fetch" {
+		return fmt.Errorf("usage: botcoin data fetch [-config config.json] [-dir data] [-granularity 1m] [-since 2006-01-02]")
+	}
+
+	flags := flag.NewFlagSet("data fetch", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "path to configuration file")
+	dir := flags.String("dir", "data", "directory of the candle store")
+	granularity := flags.String("granularity", "1m", "candle granularity, e.g. 1m, 15m, 1H, 1D")
+	sinceFlag := flags.String("since", time.Now().AddDate(0, 0, -30).Format(time.DateOnly), "first day to download for symbols without stored candles")
+	flags.Parse(args[1:])
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	since, err := time.Parse(time.DateOnly, *sinceFlag)
+	if err != nil {
+		return fmt.Errorf("invalid -since: %w", err)
+	}
+
+	client := api.NewClient(cfg.APIKey, cfg.SecretKey, cfg.PassPhrase, cfg.IsDemoTrading)
+	store := marketdata.NewStore(*dir)
+	for _, process := range cfg.TradingProcesses {
+		added, err := marketdata.Fetch(client, store, process.Symbol, *granularity, since)
+		if err != nil {
+			return err
+		}
+		log.Printf("Stored %d new candles for %s in %s", added, process.Symbol, store.Path(process.Symbol, *granularity))
+	}
+	return nil
+}
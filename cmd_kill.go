@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"botcoin/api"
+	"botcoin/config"
+	"botcoin/trading"
+)
+
+// runKill implements "botcoin kill", the kill switch. It halts trading,
+// cancels all orders and closes all positions of the configured symbols. A
+// running bot notices the halt within a minute and stops. "botcoin kill
+// -clear" allows trading again.
+func runKill(args []string) error {
+	flags := flag.NewFlagSet("kill", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "path to configuration file")
+	reason := flags.String("reason", "kill command", "reason recorded in the halt state")
+	clear := flags.Bool("clear", false, "clear the halt so the bot can trade again")
+	flags.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	haltFile := trading.HaltFile(cfg.KillSwitch)
+	if cfg.PaperTrading.Enabled {
+		haltFile = trading.PaperHaltFile(cfg.KillSwitch)
+	}
+
+	if *clear {
+		state, err := trading.LoadHalt(haltFile)
+		if err != nil {
+			return err
+		}
+		if !state.Halted {
+			fmt.Println("Trading is not halted")
+			return nil
+		}
+		if err := trading.ClearHalt(haltFile); err != nil {
+			return err
+		}
+		fmt.Printf("Cleared halt of %s (%s), the bot can be started again\n", state.Time.Format(time.DateTime), state.Reason)
+		return nil
+	}
+
+	if err := trading.SaveHalt(haltFile, trading.HaltState{Halted: true, Reason: *reason, Time: time.Now()}); err != nil {
+		return fmt.Errorf("failed to save halt state: %w", err)
+	}
+	log.Printf("Trading halted, state saved to %s", haltFile)
+	if cfg.PaperTrading.Enabled {
+		// the simulated orders only exist in the running paper trader
+		fmt.Println("Paper trading: the running paper trader cancels its orders and closes its positions within a minute")
+		return nil
+	}
+
+	symbols := make([]string, 0, len(cfg.TradingProcesses))
+	for _, process := range cfg.TradingProcesses {
+		symbols = append(symbols, process.Symbol)
+	}
+	client := api.NewClient(cfg.APIKey, cfg.SecretKey, cfg.PassPhrase, cfg.IsDemoTrading)
+	if err := trading.KillSwitch(client, symbols, cfg.KillSwitch.CloseMethod); err != nil {
+		return fmt.Errorf("kill switch incomplete, check the account: %w", err)
+	}
+	fmt.Println("All orders cancelled and positions closed")
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"botcoin/api"
+	"botcoin/config"
+	"botcoin/trading"
+)
+
+// runLadder implements "botcoin ladder", a dry run printing the buy orders
+// the ladder strategy would place
+func runLadder(args []string) error {
+	flags := flag.NewFlagSet("ladder", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "path to configuration file")
+	price := flags.Float64("price", 0, "current price to plan with, fetched from the exchange if 0")
+	volatilityPercent := flags.Float64("volatility", 0, "volatility in percent for levels spaced by volatility, measured from recent candles if 0")
+	flags.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	client := api.NewClient(cfg.APIKey, cfg.SecretKey, cfg.PassPhrase, cfg.IsDemoTrading)
+
+	for _, process := range cfg.TradingProcesses {
+		if process.Strategy != "" && process.Strategy != "ladder" {
+			fmt.Printf("%s: %s strategy, no ladder\n\n", process.Symbol, process.Strategy)
+			continue
+		}
+		currentPrice := *price
+		if currentPrice <= 0 {
+			currentPrice, err = client.GetCurrentPrice(process.Symbol)
+			if err != nil {
+				return fmt.Errorf("failed to get current price for %s: %w", process.Symbol, err)
+			}
+		}
+		volatility, err := trading.LadderVolatility(process)
+		if err != nil {
+			return fmt.Errorf("invalid ladder for %s: %w", process.Symbol, err)
+		}
+		processVolatility := *volatilityPercent
+		if volatility != nil && processVolatility <= 0 {
+			processVolatility, err = measureVolatility(client, process.Symbol, *volatility)
+			if err != nil {
+				return err
+			}
+		}
+		levels, err := trading.PlanLadder(process, currentPrice, processVolatility)
+		if err != nil {
+			return fmt.Errorf("invalid ladder for %s: %w", process.Symbol, err)
+		}
+
+		fmt.Printf("%s at %.2f\n", process.Symbol, currentPrice)
+		if volatility != nil {
+			fmt.Printf("Volatility %.3f%% (%s, %d x %s)\n", processVolatility, volatility.Measure, volatility.Period, volatility.Granularity)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(tw, "Level\tBelow %\tPrice\tAmount\tSize\tTotal\tAvg entry\tTake profit\t")
+		for i, level := range levels {
+			fmt.Fprintf(tw, "%d\t%.2f\t%.2f\t%.2f\t%.6f\t%.2f\t%.2f\t%.2f\t\n", i+1, level.BelowPercent, level.Price,
+				level.Amount, level.Size, level.CumulativeAmount, level.AveragePrice, level.SellPrice)
+		}
+		tw.Flush()
+		fmt.Println()
+	}
+	return nil
+}
+
+// measureVolatility measures the volatility of symbol from its latest closed
+// candles
+func measureVolatility(client *api.Client, symbol string, volatility config.VolatilityConfig) (float64, error) {
+	interval, err := api.GranularityDuration(volatility.Granularity)
+	if err != nil {
+		return 0, err
+	}
+	end := time.Now().Truncate(interval)
+	candles, err := client.GetCandles(symbol, volatility.Granularity, end.Add(-time.Duration(volatility.Period+1)*interval), end)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get candles for %s: %w", symbol, err)
+	}
+	return trading.VolatilityPercent(volatility, candles)
+}
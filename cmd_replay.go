@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"botcoin/config"
+	"botcoin/journal"
+	"botcoin/trading"
+)
+
+// runReplay implements "botcoin replay"
+func runReplay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "path to the configuration the journal was recorded with")
+	journalPath := flags.String("journal", "journal.jsonl", "journal to replay")
+	verbose := flags.Bool("v", false, "log the replayed trading activity")
+	flags.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	entries, err := journal.Read(*journalPath)
+	if err != nil {
+		return err
+	}
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+	player := journal.NewPlayer(entries)
+	bot, err := trading.NewSimulatedBot(cfg, player)
+	if err != nil {
+		return fmt.Errorf("failed to create replay bot: %w", err)
+	}
+	bot.SetClock(player.Clock())
+	if err := bot.Start(); err != nil {
+		return fmt.Errorf("failed to start replay bot: %w", err)
+	}
+	report := player.Replay(bot)
+	bot.Stop()
+
+	fmt.Printf("Replayed %d journal entries: %d calls, %d order updates\n", len(entries), report.Calls, report.OrderUpdates)
+	if report.OK() {
+		fmt.Println("Replay matches the recording")
+		return nil
+	}
+	for _, mismatch := range report.Mismatches {
+		fmt.Println(mismatch)
+	}
+	return fmt.Errorf("replay diverged from the recording in %d calls", len(report.Mismatches))
+}
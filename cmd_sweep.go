@@ -0,0 +1,122 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"botcoin/backtest"
+	"botcoin/config"
+)
+
+// runSweep implements "botcoin sweep"
+func runSweep(args []string) error {
+	flags := flag.NewFlagSet("sweep", flag.ExitOnError)
+	configPath := flags.String("config", "config.json", "path to the base configuration file")
+	dataDir := flags.String("data", "data", "directory of the candle store")
+	granularity := flags.String("granularity", "1m", "candle granularity to replay")
+	rangesPath := flags.String("ranges", "ranges.json", "JSON file with the swept parameter ranges")
+	folds := flags.Int("folds", 0, "walk-forward folds, 0 evaluates on the full data")
+	workers := flags.Int("workers", 0, "parallel backtests, defaults to the number of CPUs")
+	rankBy := flags.String("rank", "return", "rank by return, drawdown or sharpe")
+	out := flags.String("out", "sweep", "output path prefix for the .csv and .json results")
+	options := simFlags(flags)
+	flags.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	ranges, err := backtest.LoadRanges(*rangesPath)
+	if err != nil {
+		return fmt.Errorf("failed to load ranges: %w", err)
+	}
+	candles, err := backtest.LoadCandles(cfg, *dataDir, *granularity)
+	if err != nil {
+		return err
+	}
+
+	log.SetOutput(io.Discard)
+	report, err := backtest.Sweep(cfg, candles, backtest.SweepOptions{
+		Ranges:   ranges,
+		Exchange: *options,
+		Folds:    *folds,
+		Workers:  *workers,
+		RankBy:   *rankBy,
+	})
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(*out+".csv", report.WriteCSV); err != nil {
+		return err
+	}
+	if err := writeFile(*out+".json", report.WriteJSON); err != nil {
+		return err
+	}
+
+	printSweep(report)
+	log.Printf("Wrote %d results to %s.csv and %s.json", len(report.Results), *out, *out)
+	return nil
+}
+
+func writeFile(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func printSweep(report *backtest.SweepReport) {
+	const top = 10
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Rank\tParameters\tReturn %\tMax DD %\tSharpe\tCycles")
+	for i, result := range report.Results {
+		if i == top {
+			break
+		}
+		m := result.InSample
+		fmt.Fprintf(tw, "%d\t%s\t%.2f\t%.2f\t%.2f\t%.1f\n", i+1, formatParams(result.Params), m.Return, m.MaxDrawdown, m.Sharpe, m.CompletedCycles)
+	}
+	tw.Flush()
+
+	for _, fold := range report.WalkForward {
+		period := fold.TestStart.Format("2006-01-02") + " - " + fold.TestEnd.Format("2006-01-02")
+		if fold.Skipped != "" {
+			fmt.Printf("Fold %d (%s): skipped, %s\n", fold.Fold, period, fold.Skipped)
+			continue
+		}
+		fmt.Printf("Fold %d (%s): %s train %.2f%%, test %.2f%%\n", fold.Fold, period,
+			formatParams(fold.Params), fold.Train.Return, fold.Test.Return)
+	}
+	if m := report.OutOfSample; m != nil {
+		fmt.Printf("Walk-forward out-of-sample: return %.2f%%, max drawdown %.2f%%, Sharpe %.2f, %.0f cycles\n", m.Return, m.MaxDrawdown, m.Sharpe, m.CompletedCycles)
+	}
+	if len(report.Skipped) > 0 {
+		fmt.Printf("Skipped %d backtests lacking candles, e.g. %s\n", len(report.Skipped), report.Skipped[0].Reason)
+	}
+}
+
+func formatParams(params backtest.ParamSet) string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%g", name, params[name])
+	}
+	return strings.Join(parts, " ")
+}
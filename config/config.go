@@ -2,6 +2,8 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"os"
 )
 
@@ -13,20 +15,212 @@ type Config struct {
 	HedgeMode        bool                   `json:"hedge_mode"`        // is the account using hedge mode or one way mode
 	IsDemoTrading    bool                   `json:"is_demo_trading"`   // use demo trading
 	TradingProcesses []TradingProcessConfig `json:"trading_processes"` // multiple trading processes
+	Websocket        WebsocketConfig        `json:"websocket"`         // optional connection settings
+	OrderTransport   string                 `json:"order_transport"`   // "rest" (default) or "websocket"
+	PaperTrading     PaperTradingConfig     `json:"paper_trading"`     // trade against a local simulated exchange
+	JournalFile      string                 `json:"journal_file"`      // record exchange calls and websocket messages for replay
+	Risk             RiskConfig             `json:"risk"`              // account wide limits checked before every order
+	KillSwitch       KillSwitchConfig       `json:"kill_switch"`       // emergency stop
+}
+
+// KillSwitchConfig configures the kill switch, which cancels all orders,
+// closes all positions and halts trading until the halt is cleared
+type KillSwitchConfig struct {
+	HaltFile       string `json:"halt_file"`       // persisted halt state, default "halted.json"
+	CloseMethod    string `json:"close_method"`    // "flash_close" (default) or "market"
+	ControlAddress string `json:"control_address"` // serve the control API on this address, e.g. "127.0.0.1:8089"
+	ControlToken   string `json:"control_token"`   // bearer token of the control API, required unless it listens on loopback
+}
+
+// RiskConfig limits the exposure of all trading processes together. Notional
+// values are in the margin coin, zero values disable a limit.
+type RiskConfig struct {
+	MaxTotalNotional  float64 `json:"max_total_notional"`  // positions and resting orders that increase them, all symbols
+	MaxSymbolNotional float64 `json:"max_symbol_notional"` // positions and resting orders that increase them, per symbol
+	MaxOpenPositions  int     `json:"max_open_positions"`  // symbols with a position, resting orders don't count
+	MaxDailyLoss      float64 `json:"max_daily_loss"`      // realized loss and fees since midnight UTC plus unrealized loss
+	Downsize          bool    `json:"downsize"`            // shrink orders to the remaining notional instead of rejecting them
+}
+
+// WebsocketConfig configures reconnects of the websocket connection,
+// zero values fall back to the defaults
+type WebsocketConfig struct {
+	ReconnectInitialDelaySeconds float64 `json:"reconnect_initial_delay_seconds"`
+	ReconnectMaxDelaySeconds     float64 `json:"reconnect_max_delay_seconds"`
+	ReconnectMultiplier          float64 `json:"reconnect_multiplier"`
+	ReconnectJitter              float64 `json:"reconnect_jitter"`       // fraction of the delay, e.g. 0.2 for +/- 20%
+	ReconnectMaxAttempts         int     `json:"reconnect_max_attempts"` // attempts before escalating
+	KeepReconnecting             bool    `json:"keep_reconnecting"`      // keep retrying after max attempts instead of stopping the bot
+}
+
+// PaperTradingConfig configures paper trading, where orders are matched by a
+// local simulated exchange instead of being sent to Bitget
+type PaperTradingConfig struct {
+	Enabled        bool    `json:"enabled"`
+	StateFile      string  `json:"state_file"`      // virtual balances, positions and orders, default "paper_state.json"
+	InitialBalance float64 `json:"initial_balance"` // used when there is no state file yet
+	MakerFee       float64 `json:"maker_fee"`
+	TakerFee       float64 `json:"taker_fee"`
+	FundingRate    float64 `json:"funding_rate"`
+	FillModel      string  `json:"fill_model"`  // "touch" (default) or "trade-through"
+	Source         string  `json:"source"`      // "live" (default) trades or "recorded" candles
+	DataDir        string  `json:"data_dir"`    // candle store of the recorded source
+	Granularity    string  `json:"granularity"` // candle granularity of the recorded source
+	Speed          float64 `json:"speed"`       // replay speed of the recorded source, 0 replays as fast as possible
 }
 
 type TradingProcessConfig struct {
 	Symbol            string           `json:"symbol"`
+	Strategy          string           `json:"strategy"` // registered strategy name, default "ladder"
+	Params            json.RawMessage  `json:"params"`   // strategy specific parameters
 	SellTargetPercent float64          `json:"sell_target_percent"`
 	BuyOrders         []BuyOrderConfig `json:"buy_orders"`
+	// LadderGenerator generates BuyOrders instead of listing them by hand
+	LadderGenerator *LadderGeneratorConfig `json:"ladder_generator"`
+	// Volatility measures the volatility that buy orders with a
+	// VolatilityMultiple are spaced by
+	Volatility *VolatilityConfig `json:"volatility"`
+	// EntryFilters must all pass before a new ladder cycle places orders
+	EntryFilters []EntryFilterConfig `json:"entry_filters"`
+	// Repeg moves the buy orders of a cycle without fills to the new price
+	Repeg *RepegConfig `json:"repeg"`
+	// Funding reacts to funding rates against the position
+	Funding *FundingConfig `json:"funding"`
+	// LiquidationGuard watches the distance of the position to its
+	// liquidation price
+	LiquidationGuard *LiquidationGuardConfig `json:"liquidation_guard"`
 }
 
 type BuyOrderConfig struct {
 	CoinPrice             float64 `json:"coin_price"`
 	CoinPriceBelowPercent float64 `json:"coin_price_below_percent"`
+	VolatilityMultiple    float64 `json:"volatility_multiple"` // distance below the current price in multiples of the volatility
 	OrderAmount           float64 `json:"order_amount"`
 }
 
+// VolatilityConfig describes how the volatility of a symbol is measured from
+// recent candles, zero values fall back to the defaults
+type VolatilityConfig struct {
+	Measure          string  `json:"measure"`            // "atr" (default) or "stddev" of the log returns
+	Granularity      string  `json:"granularity"`        // candle granularity, default "1H"
+	Period           int     `json:"period"`             // number of candles, default 14
+	MinOffsetPercent float64 `json:"min_offset_percent"` // lower bound of a level's distance below the price
+	MaxOffsetPercent float64 `json:"max_offset_percent"` // upper bound of a level's distance below the price
+}
+
+// RepegConfig cancels the unfilled buy orders of a ladder and places them
+// again relative to the current price, as long as no order of the cycle filled
+type RepegConfig struct {
+	DriftPercent   float64 `json:"drift_percent"`   // price rose this much above the price the ladder was placed at
+	TimeoutMinutes float64 `json:"timeout_minutes"` // nothing filled for this long
+}
+
+// FundingConfig delays ladder starts or raises the take-profit while the
+// funding rate, paid by the long position of a ladder if positive, is above a
+// threshold. Thresholds are rates per settlement, e.g. 0.0005 for 0.05%.
+type FundingConfig struct {
+	DelayAboveRate           *float64 `json:"delay_above_rate"`             // don't start new cycles while the rate is above
+	RaiseTakeProfitAboveRate *float64 `json:"raise_take_profit_above_rate"` // raise the take-profit while the rate is above
+	TakeProfitRaisePercent   float64  `json:"take_profit_raise_percent"`    // added to the sell target percent
+}
+
+// LiquidationGuardConfig configures what happens when the mark price comes
+// closer to the liquidation price than the given distances in percent of the
+// mark price. Zero distances disable the action.
+type LiquidationGuardConfig struct {
+	AlertPercent     float64 `json:"alert_percent"`      // log an alert
+	PausePercent     float64 `json:"pause_percent"`      // cancel and stop placing buy orders until the distance recovers
+	AddMarginPercent float64 `json:"add_margin_percent"` // add isolated margin
+	MarginAmount     float64 `json:"margin_amount"`      // margin added per check while below add_margin_percent
+	MaxMargin        float64 `json:"max_margin"`         // upper bound of the margin added to one position, 0 for no bound
+	StateFile        string  `json:"state_file"`         // persists the margin added, defaults to liquidation_<symbol>.json
+}
+
+// EntryFilterConfig is a condition on a technical indicator, computed from
+// recent candles. Either the indicator is compared with Below or Above, or the
+// current price with the indicator.
+type EntryFilterConfig struct {
+	Indicator   string   `json:"indicator"`   // sma, ema, rsi, bollinger_lower, bollinger_middle, bollinger_upper, atr or vwap
+	Period      int      `json:"period"`      // number of candles, default 14 (20 for bollinger bands)
+	Granularity string   `json:"granularity"` // candle granularity, default "1H"
+	StdDev      float64  `json:"std_dev"`     // width of the bollinger bands in standard deviations, default 2
+	Below       *float64 `json:"below"`       // the indicator must be below this value
+	Above       *float64 `json:"above"`       // the indicator must be above this value
+	Price       string   `json:"price"`       // "below" or "above": the current price must be below or above the indicator
+}
+
+// LadderGeneratorConfig describes a ladder of buy orders below the current
+// price. The distance between levels grows by StepMultiplier and the amount
+// per level by SizeMultiplier, the amounts of all levels add up to TotalBudget.
+// With Unit "volatility" offsets and steps are multiples of the volatility
+// instead of percentages.
+type LadderGeneratorConfig struct {
+	Levels             int     `json:"levels"`
+	Unit               string  `json:"unit"`                 // "percent" (default) or "volatility"
+	FirstOffsetPercent float64 `json:"first_offset_percent"` // distance of the first level below the current price
+	StepPercent        float64 `json:"step_percent"`         // distance between the first two levels
+	StepMultiplier     float64 `json:"step_multiplier"`      // growth of the distance per level, default 1
+	SizeMultiplier     float64 `json:"size_multiplier"`      // growth of the amount per level (martingale factor), default 1
+	TotalBudget        float64 `json:"total_budget"`         // amount of all levels together
+}
+
+// BuyOrders expands the generator into buy orders
+func (g *LadderGeneratorConfig) BuyOrders() ([]BuyOrderConfig, error) {
+	if g.Levels < 1 {
+		return nil, fmt.Errorf("ladder generator needs at least 1 level, got %d", g.Levels)
+	}
+	if g.FirstOffsetPercent <= 0 {
+		return nil, fmt.Errorf("ladder generator needs a positive first offset")
+	}
+	if g.Levels > 1 && g.StepPercent <= 0 {
+		return nil, fmt.Errorf("ladder generator needs a positive step")
+	}
+	if g.TotalBudget <= 0 {
+		return nil, fmt.Errorf("ladder generator needs a positive total budget")
+	}
+	stepMultiplier := g.StepMultiplier
+	if stepMultiplier == 0 {
+		stepMultiplier = 1
+	}
+	sizeMultiplier := g.SizeMultiplier
+	if sizeMultiplier == 0 {
+		sizeMultiplier = 1
+	}
+	if stepMultiplier < 0 || sizeMultiplier < 0 {
+		return nil, fmt.Errorf("ladder generator multipliers must not be negative")
+	}
+	if g.Unit != "" && g.Unit != "percent" && g.Unit != "volatility" {
+		return nil, fmt.Errorf("unknown ladder generator unit %q", g.Unit)
+	}
+
+	weights := make([]float64, g.Levels)
+	var totalWeight float64
+	for i := range weights {
+		weights[i] = math.Pow(sizeMultiplier, float64(i))
+		totalWeight += weights[i]
+	}
+
+	buyOrders := make([]BuyOrderConfig, g.Levels)
+	offset := g.FirstOffsetPercent
+	step := g.StepPercent
+	for i := range buyOrders {
+		if i > 0 {
+			offset += step
+			step *= stepMultiplier
+		}
+		buyOrders[i].OrderAmount = g.TotalBudget * weights[i] / totalWeight
+		if g.Unit == "volatility" {
+			buyOrders[i].VolatilityMultiple = offset
+			continue
+		}
+		if offset >= 100 {
+			return nil, fmt.Errorf("ladder level %d is %.2f%% below the price", i+1, offset)
+		}
+		buyOrders[i].CoinPriceBelowPercent = offset
+	}
+	return buyOrders, nil
+}
+
 // LoadConfig loads configuration from a JSON file
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
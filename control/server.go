@@ -0,0 +1,127 @@
+// Package control serves a small HTTP API to control a running bot
+package control
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"botcoin/config"
+	"botcoin/trading"
+)
+
+// Killer is implemented by the trading bot and the paper trader
+type Killer interface {
+	Kill(reason string) error
+}
+
+// Server serves
+//
+//	GET  /status  the halt state of the kill switch
+//	POST /kill    fires the kill switch, with an optional "reason" query parameter
+type Server struct {
+	server   *http.Server
+	killer   Killer
+	haltFile string
+	token    string
+}
+
+// NewServer creates the control API configured by cfg, reporting the halt state
+// of haltFile. A token is required unless the API listens on a loopback address.
+func NewServer(cfg config.KillSwitchConfig, haltFile string, killer Killer) (*Server, error) {
+	host, _, err := net.SplitHostPort(cfg.ControlAddress)
+	if err != nil {
+		return nil, fmt.Errorf("invalid control address: %w", err)
+	}
+	ip := net.ParseIP(host)
+	loopback := host == "localhost" || ip != nil && ip.IsLoopback()
+	if cfg.ControlToken == "" && !loopback {
+		return nil, fmt.Errorf("control API on %s needs a control_token", cfg.ControlAddress)
+	}
+
+	s := &Server{
+		killer:   killer,
+		haltFile: haltFile,
+		token:    cfg.ControlToken,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", s.authorized(s.handleStatus))
+	mux.HandleFunc("POST /kill", s.authorized(s.handleKill))
+	s.server = &http.Server{
+		Addr:              cfg.ControlAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s, nil
+}
+
+// Start listens in the background until Stop is called
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Control API failed: %v", err)
+		}
+	}()
+	log.Printf("Control API listening on %s", listener.Addr())
+	return nil
+}
+
+// Stop shuts the server down
+func (s *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+func (s *Server) authorized(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+s.token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	state, err := trading.LoadHalt(s.haltFile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+func (s *Server) handleKill(w http.ResponseWriter, r *http.Request) {
+	reason := r.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "control API"
+	}
+	log.Printf("Kill switch requested by %s", r.RemoteAddr)
+	if err := s.killer.Kill(reason); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	state, err := trading.LoadHalt(s.haltFile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
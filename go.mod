@@ -2,4 +2,4 @@ module botcoin
 
 go 1.23.4
 
-require github.com/gorilla/websocket v1.5.3 // indirect
+require github.com/gorilla/websocket v1.5.3
@@ -0,0 +1,246 @@
+package indicators
+
+import (
+	"fmt"
+	"math"
+
+	"botcoin/api"
+)
+
+// Indicator is updated with one candle at a time, oldest first
+type Indicator interface {
+	Update(candle api.Candle)
+	// Ready reports whether enough candles were seen for Value to be valid
+	Ready() bool
+	Value() float64
+}
+
+// Compute feeds candles to indicator and returns its value
+func Compute(indicator Indicator, candles []api.Candle) (float64, error) {
+	for _, candle := range candles {
+		indicator.Update(candle)
+	}
+	if !indicator.Ready() {
+		return 0, fmt.Errorf("%w: got %d", ErrNotEnoughData, len(candles))
+	}
+	return indicator.Value(), nil
+}
+
+// window holds the last values up to its capacity
+type window struct {
+	values []float64
+	next   int
+	full   bool
+}
+
+func newWindow(size int) *window {
+	return &window{values: make([]float64, size)}
+}
+
+// push adds a value and returns the one it replaced, if any
+func (w *window) push(value float64) (float64, bool) {
+	old, replaced := w.values[w.next], w.full
+	w.values[w.next] = value
+	w.next = (w.next + 1) % len(w.values)
+	if w.next == 0 {
+		w.full = true
+	}
+	return old, replaced
+}
+
+// SMA is the simple moving average of the closes
+type SMA struct {
+	window *window
+	sum    float64
+}
+
+func NewSMA(period int) *SMA {
+	return &SMA{window: newWindow(period)}
+}
+
+func (s *SMA) Update(candle api.Candle) {
+	s.sum += candle.Close
+	if old, replaced := s.window.push(candle.Close); replaced {
+		s.sum -= old
+	}
+}
+
+func (s *SMA) Ready() bool {
+	return s.window.full
+}
+
+func (s *SMA) Value() float64 {
+	return s.sum / float64(len(s.window.values))
+}
+
+// EMA is the exponential moving average of the closes, seeded by the simple
+// average of the first period closes
+type EMA struct {
+	period int
+	count  int
+	value  float64
+}
+
+func NewEMA(period int) *EMA {
+	return &EMA{period: period}
+}
+
+func (e *EMA) Update(candle api.Candle) {
+	e.count++
+	if e.count <= e.period {
+		e.value += (candle.Close - e.value) / float64(e.count)
+		return
+	}
+	e.value += (candle.Close - e.value) * 2 / float64(e.period+1)
+}
+
+func (e *EMA) Ready() bool {
+	return e.count >= e.period
+}
+
+func (e *EMA) Value() float64 {
+	return e.value
+}
+
+// RSI is the relative strength index of the closes with Wilder's smoothing,
+// between 0 and 100
+type RSI struct {
+	period   int
+	count    int
+	previous float64
+	avgGain  float64
+	avgLoss  float64
+}
+
+func NewRSI(period int) *RSI {
+	return &RSI{period: period}
+}
+
+func (r *RSI) Update(candle api.Candle) {
+	r.count++
+	if r.count == 1 {
+		r.previous = candle.Close
+		return
+	}
+	change := candle.Close - r.previous
+	r.previous = candle.Close
+	gain, loss := math.Max(change, 0), math.Max(-change, 0)
+	if r.count <= r.period+1 {
+		r.avgGain += gain / float64(r.period)
+		r.avgLoss += loss / float64(r.period)
+		return
+	}
+	r.avgGain = (r.avgGain*float64(r.period-1) + gain) / float64(r.period)
+	r.avgLoss = (r.avgLoss*float64(r.period-1) + loss) / float64(r.period)
+}
+
+func (r *RSI) Ready() bool {
+	return r.count > r.period
+}
+
+func (r *RSI) Value() float64 {
+	if r.avgLoss == 0 {
+		if r.avgGain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+r.avgGain/r.avgLoss)
+}
+
+// Bollinger are the Bollinger bands, the simple moving average of the closes
+// plus and minus a multiple of their standard deviation. Value is the middle
+// band.
+type Bollinger struct {
+	sma    *SMA
+	sumSq  float64
+	stdDev float64
+}
+
+func NewBollinger(period int, stdDev float64) *Bollinger {
+	return &Bollinger{sma: NewSMA(period), stdDev: stdDev}
+}
+
+func (b *Bollinger) Update(candle api.Candle) {
+	b.sumSq += candle.Close * candle.Close
+	b.sma.sum += candle.Close
+	if old, replaced := b.sma.window.push(candle.Close); replaced {
+		b.sma.sum -= old
+		b.sumSq -= old * old
+	}
+}
+
+func (b *Bollinger) Ready() bool {
+	return b.sma.Ready()
+}
+
+func (b *Bollinger) Value() float64 {
+	return b.Middle()
+}
+
+func (b *Bollinger) Middle() float64 {
+	return b.sma.Value()
+}
+
+func (b *Bollinger) Upper() float64 {
+	return b.Middle() + b.stdDev*b.deviation()
+}
+
+func (b *Bollinger) Lower() float64 {
+	return b.Middle() - b.stdDev*b.deviation()
+}
+
+// deviation is the population standard deviation of the closes
+func (b *Bollinger) deviation() float64 {
+	mean := b.Middle()
+	return math.Sqrt(math.Max(b.sumSq/float64(len(b.sma.window.values))-mean*mean, 0))
+}
+
+// VWAP is the volume weighted average of the typical prices of the last
+// period candles, or of all candles if period is 0
+type VWAP struct {
+	prices  *window
+	volumes *window
+	value   float64
+	volume  float64
+	count   int
+}
+
+func NewVWAP(period int) *VWAP {
+	v := &VWAP{}
+	if period > 0 {
+		v.prices = newWindow(period)
+		v.volumes = newWindow(period)
+	}
+	return v
+}
+
+func (v *VWAP) Update(candle api.Candle) {
+	v.count++
+	typical := (candle.High + candle.Low + candle.Close) / 3
+	v.value += typical * candle.BaseVolume
+	v.volume += candle.BaseVolume
+	if v.prices == nil {
+		return
+	}
+	if old, replaced := v.prices.push(typical * candle.BaseVolume); replaced {
+		v.value -= old
+	}
+	if old, replaced := v.volumes.push(candle.BaseVolume); replaced {
+		v.volume -= old
+	}
+}
+
+func (v *VWAP) Ready() bool {
+	if v.prices == nil {
+		return v.count > 0
+	}
+	return v.prices.full
+}
+
+func (v *VWAP) Value() float64 {
+	if v.volume <= 0 {
+		return 0
+	}
+	return v.value / v.volume
+}
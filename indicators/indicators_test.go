@@ -0,0 +1,195 @@
+package indicators
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"botcoin/api"
+)
+
+const tolerance = 1e-2
+
+func closes(values ...float64) []api.Candle {
+	candles := make([]api.Candle, len(values))
+	for i, value := range values {
+		candles[i] = api.Candle{Open: value, High: value, Low: value, Close: value}
+	}
+	return candles
+}
+
+// closes of the StockCharts EMA and RSI examples
+var (
+	emaCloses = closes(22.27, 22.19, 22.08, 22.17, 22.18, 22.13, 22.23, 22.43, 22.24, 22.29,
+		22.15, 22.39, 22.38, 22.61, 23.36, 24.05, 23.75, 23.83, 23.95, 23.63)
+	rsiCloses = closes(44.34, 44.09, 44.15, 43.61, 44.33, 44.83, 45.10, 45.42, 45.84, 46.08,
+		45.89, 46.03, 45.61, 46.28, 46.28, 46.00, 46.03, 46.41, 46.22, 45.64)
+)
+
+// hlc returns candles of the given high, low, close and volume quadruples
+func hlc(values ...[4]float64) []api.Candle {
+	candles := make([]api.Candle, len(values))
+	for i, v := range values {
+		candles[i] = api.Candle{High: v[0], Low: v[1], Close: v[2], BaseVolume: v[3]}
+	}
+	return candles
+}
+
+var atrCandles = hlc(
+	[4]float64{10, 8, 9, 0},
+	[4]float64{11, 9, 10, 0},    // true range 2
+	[4]float64{12, 9, 11, 0},    // 3
+	[4]float64{11, 10, 10.5, 0}, // 1
+	[4]float64{14, 11, 13, 0},   // 3.5, gap up from the previous close
+)
+
+// typical prices 10, 12 and 14 with volumes 100, 300 and 100
+var vwapCandles = hlc(
+	[4]float64{12, 9, 9, 100},
+	[4]float64{13, 11, 12, 300},
+	[4]float64{15, 12, 15, 100},
+)
+
+func TestIndicators(t *testing.T) {
+	tests := []struct {
+		name      string
+		indicator func() Indicator
+		candles   []api.Candle
+		want      float64
+		wantErr   error
+	}{
+		{"SMA", func() Indicator { return NewSMA(10) }, emaCloses[:10], 22.221, nil},
+		{"SMA rolling", func() Indicator { return NewSMA(10) }, emaCloses, 23.21, nil},
+		{"SMA too few candles", func() Indicator { return NewSMA(10) }, emaCloses[:9], 0, ErrNotEnoughData},
+
+		{"EMA seeded with SMA", func() Indicator { return NewEMA(10) }, emaCloses[:10], 22.22, nil},
+		{"EMA first smoothed", func() Indicator { return NewEMA(10) }, emaCloses[:11], 22.21, nil},
+		{"EMA", func() Indicator { return NewEMA(10) }, emaCloses[:15], 22.52, nil},
+		{"EMA last", func() Indicator { return NewEMA(10) }, emaCloses, 23.34, nil},
+		{"EMA too few candles", func() Indicator { return NewEMA(10) }, emaCloses[:9], 0, ErrNotEnoughData},
+
+		{"RSI first", func() Indicator { return NewRSI(14) }, rsiCloses[:15], 70.46, nil},
+		{"RSI Wilder smoothed", func() Indicator { return NewRSI(14) }, rsiCloses[:16], 66.25, nil},
+		{"RSI last", func() Indicator { return NewRSI(14) }, rsiCloses, 57.92, nil},
+		{"RSI too few candles", func() Indicator { return NewRSI(14) }, rsiCloses[:14], 0, ErrNotEnoughData},
+		{"RSI only gains", func() Indicator { return NewRSI(3) }, closes(1, 2, 3, 4), 100, nil},
+		{"RSI flat", func() Indicator { return NewRSI(3) }, closes(5, 5, 5, 5), 50, nil},
+
+		{"Bollinger middle", func() Indicator { return NewBollinger(8, 2) }, closes(2, 4, 4, 4, 5, 5, 7, 9), 5, nil},
+		{"Bollinger too few candles", func() Indicator { return NewBollinger(8, 2) }, closes(2, 4, 4, 4, 5, 5, 7), 0, ErrNotEnoughData},
+
+		{"ATR seeded with the average", func() Indicator { return NewATR(3) }, atrCandles[:4], 2, nil},
+		{"ATR Wilder smoothed", func() Indicator { return NewATR(3) }, atrCandles, 2.5, nil},
+		{"ATR too few candles", func() Indicator { return NewATR(3) }, atrCandles[:3], 0, ErrNotEnoughData},
+
+		{"VWAP cumulative", func() Indicator { return NewVWAP(0) }, vwapCandles, 12, nil},
+		{"VWAP window", func() Indicator { return NewVWAP(2) }, vwapCandles, 12.5, nil},
+		{"VWAP too few candles", func() Indicator { return NewVWAP(4) }, vwapCandles, 0, ErrNotEnoughData},
+		{"VWAP no candles", func() Indicator { return NewVWAP(0) }, nil, 0, ErrNotEnoughData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Compute(tt.indicator(), tt.candles)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if math.Abs(got-tt.want) > tolerance {
+				t.Errorf("value = %.4f, want %.4f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndicatorReady(t *testing.T) {
+	tests := []struct {
+		name      string
+		indicator Indicator
+		needed    int
+	}{
+		{"SMA", NewSMA(5), 5},
+		{"EMA", NewEMA(5), 5},
+		{"RSI", NewRSI(5), 6},
+		{"Bollinger", NewBollinger(5, 2), 5},
+		{"ATR", NewATR(5), 6},
+		{"VWAP", NewVWAP(5), 5},
+		{"cumulative VWAP", NewVWAP(0), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 1; i <= tt.needed; i++ {
+				if tt.indicator.Ready() {
+					t.Fatalf("ready after %d candles, needs %d", i-1, tt.needed)
+				}
+				tt.indicator.Update(api.Candle{High: 11, Low: 9, Close: float64(10 + i%2), BaseVolume: 1})
+			}
+			if !tt.indicator.Ready() {
+				t.Errorf("not ready after %d candles", tt.needed)
+			}
+		})
+	}
+}
+
+func TestBollingerBands(t *testing.T) {
+	tests := []struct {
+		name                 string
+		candles              []api.Candle
+		lower, middle, upper float64
+	}{
+		// population standard deviation 2
+		{"full window", closes(2, 4, 4, 4, 5, 5, 7, 9), 1, 5, 9},
+		{"rolled window", closes(2, 4, 4, 4, 5, 5, 7, 9, 13), 0.3802, 6.375, 12.3698},
+		{"flat", closes(3, 3, 3, 3, 3, 3, 3, 3), 3, 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBollinger(8, 2)
+			if _, err := Compute(b, tt.candles); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, band := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"lower", b.Lower(), tt.lower},
+				{"middle", b.Middle(), tt.middle},
+				{"upper", b.Upper(), tt.upper},
+			} {
+				if math.Abs(band.got-band.want) > tolerance {
+					t.Errorf("%s band = %.4f, want %.4f", band.name, band.got, band.want)
+				}
+			}
+		})
+	}
+}
+
+func TestATR(t *testing.T) {
+	if got, err := ATR(atrCandles, 3); err != nil || math.Abs(got-2.5) > tolerance {
+		t.Errorf("ATR = %v, %v, want 2.5", got, err)
+	}
+	if _, err := ATR(atrCandles[:3], 3); !errors.Is(err, ErrNotEnoughData) {
+		t.Errorf("ATR of too few candles: err = %v, want ErrNotEnoughData", err)
+	}
+	if _, err := ATR(atrCandles, 0); err == nil || errors.Is(err, ErrNotEnoughData) {
+		t.Errorf("ATR with period 0: err = %v, want an invalid period", err)
+	}
+}
+
+func TestRealizedVolatility(t *testing.T) {
+	// log returns of +10% and -10% alternate
+	candles := closes(100, 110, 99, 108.9, 98.01)
+	up, down := math.Log(1.1), math.Log(0.9)
+	mean := (2*up + 2*down) / 4
+	want := math.Sqrt((2*(up-mean)*(up-mean) + 2*(down-mean)*(down-mean)) / 3)
+	if got, err := RealizedVolatility(candles, 4); err != nil || math.Abs(got-want) > 1e-9 {
+		t.Errorf("volatility = %v, %v, want %v", got, err, want)
+	}
+	if _, err := RealizedVolatility(candles, 5); !errors.Is(err, ErrNotEnoughData) {
+		t.Errorf("volatility of too few candles: err = %v, want ErrNotEnoughData", err)
+	}
+}
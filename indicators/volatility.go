@@ -0,0 +1,90 @@
+// Package indicators calculates technical indicators from candles
+package indicators
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"botcoin/api"
+)
+
+var ErrNotEnoughData = errors.New("not enough candles")
+
+// TrueRange returns the range of candle including the gap from the close of
+// the previous candle
+func TrueRange(candle, previous api.Candle) float64 {
+	return math.Max(candle.High-candle.Low, math.Max(math.Abs(candle.High-previous.Close), math.Abs(candle.Low-previous.Close)))
+}
+
+// ATRIndicator is the average true range with Wilder's smoothing, seeded by
+// the simple average of the first period true ranges
+type ATRIndicator struct {
+	period   int
+	count    int
+	previous api.Candle
+	value    float64
+}
+
+func NewATR(period int) *ATRIndicator {
+	return &ATRIndicator{period: period}
+}
+
+func (a *ATRIndicator) Update(candle api.Candle) {
+	a.count++
+	previous := a.previous
+	a.previous = candle
+	if a.count == 1 {
+		return
+	}
+	trueRange := TrueRange(candle, previous)
+	if a.count <= a.period+1 {
+		a.value += trueRange / float64(a.period)
+		return
+	}
+	a.value = (a.value*float64(a.period-1) + trueRange) / float64(a.period)
+}
+
+func (a *ATRIndicator) Ready() bool {
+	return a.count > a.period
+}
+
+func (a *ATRIndicator) Value() float64 {
+	return a.value
+}
+
+// ATR returns the average true range of candles. It needs at least period+1
+// candles.
+func ATR(candles []api.Candle, period int) (float64, error) {
+	if period < 1 {
+		return 0, fmt.Errorf("invalid ATR period %d", period)
+	}
+	if len(candles) < period+1 {
+		return 0, fmt.Errorf("%w: ATR(%d) needs %d, got %d", ErrNotEnoughData, period, period+1, len(candles))
+	}
+	return Compute(NewATR(period), candles)
+}
+
+// RealizedVolatility returns the standard deviation of the log returns of
+// the closes of the last period candles, as a fraction per candle
+func RealizedVolatility(candles []api.Candle, period int) (float64, error) {
+	if period < 2 {
+		return 0, fmt.Errorf("invalid volatility period %d", period)
+	}
+	if len(candles) < period+1 {
+		return 0, fmt.Errorf("%w: volatility(%d) needs %d, got %d", ErrNotEnoughData, period, period+1, len(candles))
+	}
+	returns := make([]float64, 0, period)
+	for i := len(candles) - period; i < len(candles); i++ {
+		returns = append(returns, math.Log(candles[i].Close/candles[i-1].Close))
+	}
+	var mean float64
+	for _, r := range returns {
+		mean += r / float64(len(returns))
+	}
+	var variance float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean) / float64(len(returns)-1)
+	}
+	return math.Sqrt(variance), nil
+}
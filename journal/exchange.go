@@ -0,0 +1,181 @@
+package journal
+
+import (
+	"time"
+
+	"botcoin/api"
+)
+
+// Exchange mirrors the exchange interface of the trading package
+type Exchange interface {
+	GetCurrentPrice(symbol string) (float64, error)
+	GetPosition(symbol string) (*api.Position, error)
+	GetPositions(symbol string) ([]api.Position, error)
+	GetPendingOrders(symbol string) ([]api.Order, error)
+	GetOrderHistory(symbol string, since time.Time) ([]api.Order, error)
+	GetFilledOrders(symbol string, since time.Time) ([]api.Order, error)
+	GetCandles(symbol, granularity string, start, end time.Time) ([]api.Candle, error)
+	GetCurrentFundingRate(symbol string) (float64, error)
+	GetNextFundingTime(symbol string) (time.Time, error)
+	GetContract(symbol string) (*api.Contract, error)
+	AddMargin(symbol, holdSide string, amount float64) error
+	PlaceMarketOrder(symbol, side string, size float64, reduceOnly bool) (string, error)
+	FlashClose(symbol, holdSide string) error
+	PlaceOrder(order api.LimitOrder) (string, error)
+	CancelOrder(symbol string, orderId string) error
+}
+
+// OrderPlacer is the part of Exchange orders are sent through
+type OrderPlacer interface {
+	PlaceOrder(order api.LimitOrder) (string, error)
+	CancelOrder(symbol string, orderId string) error
+}
+
+type symbolArgs struct {
+	Symbol string `json:"symbol"`
+}
+
+type historyArgs struct {
+	Symbol string    `json:"symbol"`
+	Since  time.Time `json:"since"`
+}
+
+type candleArgs struct {
+	Symbol      string    `json:"symbol"`
+	Granularity string    `json:"granularity"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+}
+
+type marginArgs struct {
+	Symbol   string  `json:"symbol"`
+	HoldSide string  `json:"hold_side"`
+	Amount   float64 `json:"amount"`
+}
+
+type marketOrderArgs struct {
+	Symbol     string  `json:"symbol"`
+	Side       string  `json:"side"`
+	Size       float64 `json:"size"`
+	ReduceOnly bool    `json:"reduce_only"`
+}
+
+type flashCloseArgs struct {
+	Symbol   string `json:"symbol"`
+	HoldSide string `json:"hold_side"`
+}
+
+type cancelArgs struct {
+	Symbol  string `json:"symbol"`
+	OrderId string `json:"orderId"`
+}
+
+// Exchange returns exchange recording every call
+func (r *Recorder) Exchange(exchange Exchange) Exchange {
+	return &recordingExchange{recordingOrders: recordingOrders{recorder: r, orders: exchange}, exchange: exchange}
+}
+
+// Orders returns orders recording every call
+func (r *Recorder) Orders(orders OrderPlacer) OrderPlacer {
+	return &recordingOrders{recorder: r, orders: orders}
+}
+
+type recordingOrders struct {
+	recorder *Recorder
+	orders   OrderPlacer
+}
+
+func (o *recordingOrders) PlaceOrder(order api.LimitOrder) (string, error) {
+	orderId, err := o.orders.PlaceOrder(order)
+	o.recorder.RecordCall("PlaceOrder", order, orderId, err)
+	return orderId, err
+}
+
+func (o *recordingOrders) CancelOrder(symbol string, orderId string) error {
+	err := o.orders.CancelOrder(symbol, orderId)
+	o.recorder.RecordCall("CancelOrder", cancelArgs{Symbol: symbol, OrderId: orderId}, nil, err)
+	return err
+}
+
+type recordingExchange struct {
+	recordingOrders
+	exchange Exchange
+}
+
+func (e *recordingExchange) GetCurrentPrice(symbol string) (float64, error) {
+	price, err := e.exchange.GetCurrentPrice(symbol)
+	e.recorder.RecordCall("GetCurrentPrice", symbolArgs{Symbol: symbol}, price, err)
+	return price, err
+}
+
+func (e *recordingExchange) GetPosition(symbol string) (*api.Position, error) {
+	position, err := e.exchange.GetPosition(symbol)
+	e.recorder.RecordCall("GetPosition", symbolArgs{Symbol: symbol}, position, err)
+	return position, err
+}
+
+func (e *recordingExchange) GetPositions(symbol string) ([]api.Position, error) {
+	positions, err := e.exchange.GetPositions(symbol)
+	e.recorder.RecordCall("GetPositions", symbolArgs{Symbol: symbol}, positions, err)
+	return positions, err
+}
+
+func (e *recordingExchange) GetPendingOrders(symbol string) ([]api.Order, error) {
+	orders, err := e.exchange.GetPendingOrders(symbol)
+	e.recorder.RecordCall("GetPendingOrders", symbolArgs{Symbol: symbol}, orders, err)
+	return orders, err
+}
+
+func (e *recordingExchange) GetOrderHistory(symbol string, since time.Time) ([]api.Order, error) {
+	orders, err := e.exchange.GetOrderHistory(symbol, since)
+	e.recorder.RecordCall("GetOrderHistory", historyArgs{Symbol: symbol, Since: since}, orders, err)
+	return orders, err
+}
+
+func (e *recordingExchange) GetFilledOrders(symbol string, since time.Time) ([]api.Order, error) {
+	orders, err := e.exchange.GetFilledOrders(symbol, since)
+	e.recorder.RecordCall("GetFilledOrders", historyArgs{Symbol: symbol, Since: since}, orders, err)
+	return orders, err
+}
+
+func (e *recordingExchange) GetCandles(symbol, granularity string, start, end time.Time) ([]api.Candle, error) {
+	candles, err := e.exchange.GetCandles(symbol, granularity, start, end)
+	e.recorder.RecordCall("GetCandles", candleArgs{Symbol: symbol, Granularity: granularity, Start: start, End: end}, candles, err)
+	return candles, err
+}
+
+func (e *recordingExchange) GetCurrentFundingRate(symbol string) (float64, error) {
+	rate, err := e.exchange.GetCurrentFundingRate(symbol)
+	e.recorder.RecordCall("GetCurrentFundingRate", symbolArgs{Symbol: symbol}, rate, err)
+	return rate, err
+}
+
+func (e *recordingExchange) GetNextFundingTime(symbol string) (time.Time, error) {
+	next, err := e.exchange.GetNextFundingTime(symbol)
+	e.recorder.RecordCall("GetNextFundingTime", symbolArgs{Symbol: symbol}, next, err)
+	return next, err
+}
+
+func (e *recordingExchange) GetContract(symbol string) (*api.Contract, error) {
+	contract, err := e.exchange.GetContract(symbol)
+	e.recorder.RecordCall("GetContract", symbolArgs{Symbol: symbol}, contract, err)
+	return contract, err
+}
+
+func (e *recordingExchange) AddMargin(symbol, holdSide string, amount float64) error {
+	err := e.exchange.AddMargin(symbol, holdSide, amount)
+	e.recorder.RecordCall("AddMargin", marginArgs{Symbol: symbol, HoldSide: holdSide, Amount: amount}, nil, err)
+	return err
+}
+
+func (e *recordingExchange) PlaceMarketOrder(symbol, side string, size float64, reduceOnly bool) (string, error) {
+	orderId, err := e.exchange.PlaceMarketOrder(symbol, side, size, reduceOnly)
+	e.recorder.RecordCall("PlaceMarketOrder", marketOrderArgs{Symbol: symbol, Side: side, Size: size, ReduceOnly: reduceOnly}, orderId, err)
+	return orderId, err
+}
+
+func (e *recordingExchange) FlashClose(symbol, holdSide string) error {
+	err := e.exchange.FlashClose(symbol, holdSide)
+	e.recorder.RecordCall("FlashClose", flashCloseArgs{Symbol: symbol, HoldSide: holdSide}, nil, err)
+	return err
+}
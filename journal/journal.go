@@ -0,0 +1,199 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"botcoin/api"
+)
+
+// Kinds of journal entries
+const (
+	KindCall       = "call"        // a call to the exchange api with its result
+	KindWSSent     = "ws_sent"     // a message sent on the websocket
+	KindWSReceived = "ws_received" // a message received on the websocket
+	KindRequest    = "request"     // a raw REST request with its response
+	KindTimer      = "timer"       // a tick of the timer of the bot
+)
+
+const redacted = "[redacted]"
+
+// keys whose values never make it into a journal, compared case-insensitively
+var secretKeys = map[string]bool{
+	"apikey":     true,
+	"api_key":    true,
+	"secretkey":  true,
+	"secret_key": true,
+	"passphrase": true,
+	"sign":       true,
+}
+
+// Entry is one line of a journal
+type Entry struct {
+	Seq     int64           `json:"seq"`
+	Time    time.Time       `json:"time"`
+	Kind    string          `json:"kind"`
+	Method  string          `json:"method,omitempty"`
+	Path    string          `json:"path,omitempty"`
+	Args    json.RawMessage `json:"args,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Message json.RawMessage `json:"message,omitempty"`
+}
+
+// Recorder appends exchange calls, REST requests, websocket messages and timer
+// ticks to a JSONL journal. Credentials are redacted before writing.
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+	seq  int64
+}
+
+// NewRecorder starts a new journal at path, a journal of a previous run is
+// overwritten as replays start from the beginning of a run
+func NewRecorder(path string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	return &Recorder{file: file}, nil
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// RecordCall records a call of method with its arguments and outcome
+func (r *Recorder) RecordCall(method string, args, result interface{}, err error) {
+	entry := Entry{Kind: KindCall, Method: method, Args: marshal(args)}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Result = marshal(result)
+	}
+	r.write(entry)
+}
+
+// RecordRequest records a raw REST request and its response. It is an
+// api.RequestTap.
+func (r *Recorder) RecordRequest(method, path string, body, response []byte, err error) {
+	entry := Entry{Kind: KindRequest, Method: method, Path: path}
+	if len(body) > 0 {
+		entry.Args = redact(body)
+	}
+	if response != nil {
+		entry.Result = redact(response)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	r.write(entry)
+}
+
+// RecordTimer records a tick of the timer of the bot, so a replay calls the
+// timer of the strategies at the same times
+func (r *Recorder) RecordTimer(now time.Time) {
+	r.write(Entry{Kind: KindTimer, Args: marshal(now)})
+}
+
+// RecordMessage records a websocket message. It is an api.TapHandler.
+func (r *Recorder) RecordMessage(direction string, message []byte) {
+	kind := KindWSReceived
+	if direction == api.TapSent {
+		kind = KindWSSent
+	}
+	r.write(Entry{Kind: kind, Message: redact(message)})
+}
+
+func (r *Recorder) write(entry Entry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq++
+	entry.Seq = r.seq
+	entry.Time = time.Now()
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	// written unbuffered, so the journal is complete up to a crash
+	r.file.Write(append(line, '\n'))
+}
+
+func marshal(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return redact(data)
+}
+
+// redact replaces secrets in a JSON document. Messages that are not JSON are
+// stored as JSON strings.
+func redact(message []byte) json.RawMessage {
+	var doc interface{}
+	if err := json.Unmarshal(message, &doc); err != nil {
+		data, _ := json.Marshal(string(message))
+		return data
+	}
+	data, err := json.Marshal(redactValue(doc))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func redactValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if secretKeys[strings.ToLower(key)] {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redactValue(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	}
+	return v
+}
+
+// Read reads all entries of a journal
+func Read(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse journal line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	return entries, nil
+}
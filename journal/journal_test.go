@@ -0,0 +1,197 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"botcoin/api"
+	"botcoin/sim"
+)
+
+const symbol = "BTCUSDT"
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// follower buys one percent below the price on timer ticks while it has no
+// open order and sells every filled buy one percent above its average price
+type follower struct {
+	exchange Exchange
+	open     string
+	seen     []string // what the follower saw and did, compared between runs
+}
+
+func (f *follower) HandleTimer(now time.Time) {
+	if f.open != "" {
+		return
+	}
+	price, err := f.exchange.GetCurrentPrice(symbol)
+	if err != nil {
+		f.seen = append(f.seen, "price error: "+err.Error())
+		return
+	}
+	orderId, err := f.exchange.PlaceOrder(api.LimitOrder{Symbol: symbol, Side: "buy", Price: price * 0.99, Size: 1, ClientOid: now.String()})
+	if err != nil {
+		f.seen = append(f.seen, "buy error: "+err.Error())
+		return
+	}
+	f.open = orderId
+	f.seen = append(f.seen, fmt.Sprintf("buy %s at %.2f", orderId, price*0.99))
+}
+
+func (f *follower) HandleOrderUpdate(order api.Order) {
+	f.seen = append(f.seen, fmt.Sprintf("%s %s %s", order.Side, order.OrderId, order.Status))
+	if order.Side != "buy" || order.Status != "filled" {
+		if order.Side == "sell" && order.Status == "filled" {
+			f.open = ""
+		}
+		return
+	}
+	position, err := f.exchange.GetPosition(symbol)
+	if err != nil {
+		f.seen = append(f.seen, "position error: "+err.Error())
+		return
+	}
+	avgPrice, _ := strconv.ParseFloat(position.OpenPriceAvg, 64)
+	size, _ := strconv.ParseFloat(position.Total, 64)
+	orderId, err := f.exchange.PlaceOrder(api.LimitOrder{Symbol: symbol, Side: "sell", Price: avgPrice * 1.01, Size: size})
+	if err != nil {
+		f.seen = append(f.seen, "sell error: "+err.Error())
+		return
+	}
+	f.seen = append(f.seen, fmt.Sprintf("sell %s at %.2f", orderId, avgPrice*1.01))
+}
+
+func (f *follower) HandlePrice(symbol string, price float64) {}
+
+func candle(minute int, open, high, low, close float64) api.Candle {
+	return api.Candle{Timestamp: start.Add(time.Duration(minute) * time.Minute), Open: open, High: high, Low: low, Close: close}
+}
+
+// record runs a follower against a simulated exchange and journals it like
+// the live bot: timer ticks, exchange calls and pushed order updates
+func record(t *testing.T, path string, candles []api.Candle) *follower {
+	t.Helper()
+	recorder, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recorder.Close()
+
+	exchange := sim.NewExchange(sim.Options{InitialBalance: 10000, CandleInterval: time.Minute})
+	exchange.SetPrice(symbol, 100, start)
+	f := &follower{exchange: recorder.Exchange(exchange)}
+	exchange.OnFill(func(order api.Order) {
+		data, err := json.Marshal([]api.Order{order})
+		if err != nil {
+			t.Fatal(err)
+		}
+		message, err := json.Marshal(api.WSMessage{
+			Action: "snapshot",
+			Arg:    api.WSSubscription{InstType: "USDT-FUTURES", Channel: "orders", InstId: symbol},
+			Data:   data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder.RecordMessage(api.TapReceived, message)
+		f.HandleOrderUpdate(order)
+	})
+	for _, c := range candles {
+		recorder.RecordTimer(c.Timestamp)
+		f.HandleTimer(c.Timestamp)
+		exchange.Step(symbol, c)
+	}
+	return f
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	candles := []api.Candle{
+		candle(0, 100, 100, 100, 100),
+		candle(1, 100, 100, 98, 99), // buy at 99 filled, sell at 99.99
+		candle(2, 99, 99.5, 98.5, 99),
+		candle(3, 99, 101, 99, 100.5),     // sell filled
+		candle(4, 100.5, 100.5, 99, 99.5), // next buy at 99.50 filled
+	}
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	recorded := record(t, path, candles)
+
+	entries, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	for _, entry := range entries {
+		if entry.Kind == KindCall {
+			calls++
+		}
+	}
+
+	player := NewPlayer(entries)
+	replayed := &follower{exchange: player}
+	report := player.Replay(replayed)
+	if !report.OK() {
+		t.Fatalf("mismatches: %v", report.Mismatches)
+	}
+	if report.Calls != calls {
+		t.Errorf("calls = %d, want the %d recorded", report.Calls, calls)
+	}
+	if report.OrderUpdates != 3 {
+		t.Errorf("order updates = %d, want the 3 fills", report.OrderUpdates)
+	}
+	if !reflect.DeepEqual(replayed.seen, recorded.seen) {
+		t.Errorf("replay saw\n%q\nrecording saw\n%q", replayed.seen, recorded.seen)
+	}
+}
+
+func TestReplayReportsDifferentCalls(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	record(t, path, []api.Candle{candle(0, 100, 100, 98, 99)})
+	entries, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the replayed logic buys at another price
+	player := NewPlayer(entries)
+	report := player.Replay(&follower{exchange: shifted{player}})
+	if report.OK() {
+		t.Fatal("replay with another buy price reported no mismatch")
+	}
+	if got := report.Mismatches[0]; got.Method != "PlaceOrder" || got.Reason != "arguments differ" {
+		t.Errorf("mismatch = %v, want differing PlaceOrder arguments", got)
+	}
+}
+
+// shifted places every order one higher
+type shifted struct {
+	*Player
+}
+
+func (s shifted) PlaceOrder(order api.LimitOrder) (string, error) {
+	order.Price++
+	return s.Player.PlaceOrder(order)
+}
+
+func TestNewRecorderStartsANewJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	for run := 0; run < 2; run++ {
+		recorder, err := NewRecorder(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recorder.RecordTimer(start)
+		recorder.Close()
+	}
+	entries, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Seq != 1 {
+		t.Errorf("entries = %+v, want the single tick of the last run", entries)
+	}
+}
@@ -0,0 +1,447 @@
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"botcoin/api"
+	"botcoin/clock"
+)
+
+var ErrNotRecorded = errors.New("call not recorded in journal")
+
+// arguments that differ between runs by design and are not compared
+var volatileArgs = map[string]bool{
+	"ClientOid": true,
+}
+
+// Mismatch is a difference between the recorded and the replayed calls
+type Mismatch struct {
+	Seq      int64           `json:"seq,omitempty"` // of the recorded call
+	Method   string          `json:"method"`
+	Reason   string          `json:"reason"`
+	Expected json.RawMessage `json:"expected,omitempty"`
+	Got      json.RawMessage `json:"got,omitempty"`
+}
+
+func (m Mismatch) String() string {
+	s := fmt.Sprintf("%s: %s", m.Method, m.Reason)
+	if m.Seq != 0 {
+		s = fmt.Sprintf("#%d %s", m.Seq, s)
+	}
+	if m.Expected != nil || m.Got != nil {
+		s += fmt.Sprintf(" (expected %s, got %s)", m.Expected, m.Got)
+	}
+	return s
+}
+
+// Report summarizes a replay
+type Report struct {
+	Calls        int        `json:"calls"`         // calls answered from the journal
+	OrderUpdates int        `json:"order_updates"` // order updates fed to the handler
+	Mismatches   []Mismatch `json:"mismatches"`
+}
+
+// OK reports whether the replay made exactly the recorded calls
+func (r *Report) OK() bool {
+	return len(r.Mismatches) == 0
+}
+
+type positionPush struct {
+	index     int
+	positions map[string]api.WSPosition
+}
+
+// Player replays a journal. It implements the exchange interface of the
+// trading package by answering every call with the next recorded call of the
+// same method, and Replay feeds the recorded order updates to a handler, e.g.
+// trading.Bot.HandleOrderUpdate of a simulated bot. Calls that differ from the
+// recording are reported as mismatches.
+type Player struct {
+	mu             sync.Mutex
+	entries        []Entry
+	calls          map[string][]int // indexes of the recorded calls not replayed yet, by method
+	positionPushes []positionPush
+	orderPushes    []int
+	timerTicks     int        // recorded timer ticks, none in journals recorded before they were
+	cursor         int        // index of the entry being replayed
+	current        *api.Order // order update being handled
+	clock          *clock.Fake
+	report         Report
+}
+
+func NewPlayer(entries []Entry) *Player {
+	p := &Player{
+		entries: entries,
+		calls:   make(map[string][]int),
+		clock:   clock.NewFake(time.Time{}),
+	}
+	if len(entries) > 0 {
+		p.clock.Set(entries[0].Time)
+	}
+	for i, entry := range entries {
+		switch entry.Kind {
+		case KindCall:
+			p.calls[entry.Method] = append(p.calls[entry.Method], i)
+		case KindTimer:
+			p.timerTicks++
+		case KindWSReceived:
+			msg, ok := pushedMessage(entry)
+			if !ok {
+				continue
+			}
+			switch msg.Arg.Channel {
+			case "positions":
+				var positions []api.WSPosition
+				if err := json.Unmarshal(msg.Data, &positions); err != nil {
+					continue
+				}
+				push := positionPush{index: i, positions: make(map[string]api.WSPosition, len(positions))}
+				for _, position := range positions {
+					push.positions[position.InstId] = position
+				}
+				p.positionPushes = append(p.positionPushes, push)
+			case "orders":
+				p.orderPushes = append(p.orderPushes, i)
+			}
+		}
+	}
+	return p
+}
+
+func pushedMessage(entry Entry) (api.WSMessage, bool) {
+	var msg api.WSMessage
+	if err := json.Unmarshal(entry.Message, &msg); err != nil || msg.Event != "" || msg.Data == nil {
+		return msg, false
+	}
+	return msg, true
+}
+
+// Clock returns the clock of the replay, which follows the recorded times
+func (p *Player) Clock() *clock.Fake {
+	return p.clock
+}
+
+// Handler receives the replayed events, e.g. trading.Bot
+type Handler interface {
+	HandleOrderUpdate(order api.Order)
+	HandlePrice(symbol string, price float64)
+	HandleTimer(now time.Time)
+}
+
+// Replay walks the journal and passes every recorded order update, ticker
+// price and timer tick to handler in their recorded order. Recorded filled
+// order requests are replayed like the gap recovery of the bot, i.e. their
+// filled orders are passed to handler as well.
+func (p *Player) Replay(handler Handler) *Report {
+	for i, entry := range p.entries {
+		p.clock.Set(entry.Time)
+		if p.timerTicks == 0 {
+			// older journals lack the ticks, the bot limits the calls to its
+			// timer interval then
+			handler.HandleTimer(entry.Time)
+		}
+		switch {
+		case entry.Kind == KindTimer:
+			var now time.Time
+			if err := json.Unmarshal(entry.Args, &now); err != nil {
+				now = entry.Time
+			}
+			p.setCursor(i)
+			handler.HandleTimer(now)
+
+		case entry.Kind == KindWSReceived:
+			msg, ok := pushedMessage(entry)
+			if !ok {
+				continue
+			}
+			switch msg.Arg.Channel {
+			case "orders":
+				var orders []api.Order
+				if err := json.Unmarshal(msg.Data, &orders); err != nil {
+					continue
+				}
+				for _, order := range orders {
+					p.handle(i, order, handler.HandleOrderUpdate)
+				}
+			case "ticker":
+				var tickers []api.WSTicker
+				if err := json.Unmarshal(msg.Data, &tickers); err != nil {
+					continue
+				}
+				for _, ticker := range tickers {
+					if price, err := strconv.ParseFloat(ticker.LastPr, 64); err == nil {
+						p.setCursor(i)
+						handler.HandlePrice(msg.Arg.InstId, price)
+					}
+				}
+			}
+
+		case entry.Kind == KindCall && entry.Method == "GetFilledOrders":
+			if !p.consume("GetFilledOrders", i) {
+				continue // already answered
+			}
+			var orders []api.Order
+			if err := json.Unmarshal(entry.Result, &orders); err != nil {
+				continue
+			}
+			sort.Slice(orders, func(i, j int) bool {
+				return orders[i].UTime < orders[j].UTime
+			})
+			for _, order := range orders {
+				if order.Status != "filled" {
+					continue
+				}
+				if order.InstId == "" {
+					order.InstId = order.Symbol
+				}
+				p.handle(i, order, handler.HandleOrderUpdate)
+			}
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for method, indexes := range p.calls {
+		for _, i := range indexes {
+			p.report.Mismatches = append(p.report.Mismatches, Mismatch{
+				Seq:      p.entries[i].Seq,
+				Method:   method,
+				Reason:   "recorded call was not replayed",
+				Expected: p.entries[i].Args,
+			})
+		}
+	}
+	sort.SliceStable(p.report.Mismatches, func(i, j int) bool {
+		return p.report.Mismatches[i].Seq < p.report.Mismatches[j].Seq
+	})
+	report := p.report
+	return &report
+}
+
+func (p *Player) setCursor(index int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cursor = index
+}
+
+func (p *Player) handle(index int, order api.Order, handler func(api.Order)) {
+	p.mu.Lock()
+	p.cursor = index
+	p.current = &order
+	p.report.OrderUpdates++
+	p.mu.Unlock()
+
+	handler(order)
+
+	p.mu.Lock()
+	p.current = nil
+	p.mu.Unlock()
+}
+
+// consume removes the recorded call at index from the calls still to replay
+func (p *Player) consume(method string, index int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	indexes := p.calls[method]
+	for i, candidate := range indexes {
+		if candidate == index {
+			p.calls[method] = append(indexes[:i:i], indexes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// call answers a call with the next recorded call of method
+func (p *Player) call(method string, args, result interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	got := marshal(args)
+	indexes := p.calls[method]
+	if len(indexes) == 0 {
+		p.report.Mismatches = append(p.report.Mismatches, Mismatch{Method: method, Reason: "call not recorded", Got: got})
+		return fmt.Errorf("%w: %s %s", ErrNotRecorded, method, got)
+	}
+	entry := p.entries[indexes[0]]
+	p.calls[method] = indexes[1:]
+	p.report.Calls++
+
+	if !equalArgs(entry.Args, got) {
+		p.report.Mismatches = append(p.report.Mismatches, Mismatch{
+			Seq:      entry.Seq,
+			Method:   method,
+			Reason:   "arguments differ",
+			Expected: entry.Args,
+			Got:      got,
+		})
+	}
+	if entry.Error != "" {
+		if entry.Error == api.ErrNoPosition.Error() {
+			return api.ErrNoPosition
+		}
+		return errors.New(entry.Error)
+	}
+	if result != nil && entry.Result != nil {
+		if err := json.Unmarshal(entry.Result, result); err != nil {
+			return fmt.Errorf("failed to parse recorded result of %s: %w", method, err)
+		}
+	}
+	return nil
+}
+
+func equalArgs(expected, got json.RawMessage) bool {
+	var a, b interface{}
+	if json.Unmarshal(expected, &a) != nil || json.Unmarshal(got, &b) != nil {
+		return string(expected) == string(got)
+	}
+	for _, v := range []interface{}{a, b} {
+		if m, ok := v.(map[string]interface{}); ok {
+			for key := range volatileArgs {
+				delete(m, key)
+			}
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func (p *Player) GetCurrentPrice(symbol string) (float64, error) {
+	var price float64
+	err := p.call("GetCurrentPrice", symbolArgs{Symbol: symbol}, &price)
+	return price, err
+}
+
+// GetPosition answers with a recorded position request made while handling
+// the current order update, e.g. when the live bot fell back to polling.
+// Otherwise it answers with the pushed position the live bot waited for.
+func (p *Player) GetPosition(symbol string) (*api.Position, error) {
+	if position, ok := p.pushedPosition(symbol); ok {
+		return position, nil
+	}
+	var position *api.Position
+	err := p.call("GetPosition", symbolArgs{Symbol: symbol}, &position)
+	return position, err
+}
+
+func (p *Player) pushedPosition(symbol string) (*api.Position, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	nextOrderPush := len(p.entries)
+	for _, i := range p.orderPushes {
+		if i > p.cursor {
+			nextOrderPush = i
+			break
+		}
+	}
+	if indexes := p.calls["GetPosition"]; len(indexes) > 0 && indexes[0] < nextOrderPush {
+		return nil, false
+	}
+
+	var since time.Time
+	if p.current != nil {
+		if uTime, err := strconv.ParseInt(p.current.UTime, 10, 64); err == nil {
+			since = time.UnixMilli(uTime)
+		}
+	}
+	// like WaitForPositionUpdate: the cached position if it is recent enough,
+	// else the first push after it that is
+	latest := -1
+	for i, push := range p.positionPushes {
+		if push.index < p.cursor {
+			latest = i
+		}
+	}
+	for i := max(latest, 0); i < len(p.positionPushes); i++ {
+		wsPosition, ok := p.positionPushes[i].positions[symbol]
+		if !ok {
+			continue
+		}
+		uTime, err := strconv.ParseInt(wsPosition.UTime, 10, 64)
+		if err != nil || time.UnixMilli(uTime).Before(since) {
+			continue
+		}
+		position := wsPosition.ToPosition()
+		return &position, true
+	}
+	return nil, false
+}
+
+func (p *Player) GetPositions(symbol string) ([]api.Position, error) {
+	var positions []api.Position
+	err := p.call("GetPositions", symbolArgs{Symbol: symbol}, &positions)
+	return positions, err
+}
+
+func (p *Player) GetPendingOrders(symbol string) ([]api.Order, error) {
+	var orders []api.Order
+	err := p.call("GetPendingOrders", symbolArgs{Symbol: symbol}, &orders)
+	return orders, err
+}
+
+func (p *Player) GetOrderHistory(symbol string, since time.Time) ([]api.Order, error) {
+	var orders []api.Order
+	err := p.call("GetOrderHistory", historyArgs{Symbol: symbol, Since: since}, &orders)
+	return orders, err
+}
+
+func (p *Player) GetFilledOrders(symbol string, since time.Time) ([]api.Order, error) {
+	var orders []api.Order
+	err := p.call("GetFilledOrders", historyArgs{Symbol: symbol, Since: since}, &orders)
+	return orders, err
+}
+
+func (p *Player) GetCandles(symbol, granularity string, start, end time.Time) ([]api.Candle, error) {
+	var candles []api.Candle
+	err := p.call("GetCandles", candleArgs{Symbol: symbol, Granularity: granularity, Start: start, End: end}, &candles)
+	return candles, err
+}
+
+func (p *Player) GetCurrentFundingRate(symbol string) (float64, error) {
+	var rate float64
+	err := p.call("GetCurrentFundingRate", symbolArgs{Symbol: symbol}, &rate)
+	return rate, err
+}
+
+func (p *Player) GetNextFundingTime(symbol string) (time.Time, error) {
+	var next time.Time
+	err := p.call("GetNextFundingTime", symbolArgs{Symbol: symbol}, &next)
+	return next, err
+}
+
+func (p *Player) GetContract(symbol string) (*api.Contract, error) {
+	var contract *api.Contract
+	err := p.call("GetContract", symbolArgs{Symbol: symbol}, &contract)
+	return contract, err
+}
+
+func (p *Player) AddMargin(symbol, holdSide string, amount float64) error {
+	return p.call("AddMargin", marginArgs{Symbol: symbol, HoldSide: holdSide, Amount: amount}, nil)
+}
+
+func (p *Player) PlaceMarketOrder(symbol, side string, size float64, reduceOnly bool) (string, error) {
+	var orderId string
+	err := p.call("PlaceMarketOrder", marketOrderArgs{Symbol: symbol, Side: side, Size: size, ReduceOnly: reduceOnly}, &orderId)
+	return orderId, err
+}
+
+func (p *Player) FlashClose(symbol, holdSide string) error {
+	return p.call("FlashClose", flashCloseArgs{Symbol: symbol, HoldSide: holdSide}, nil)
+}
+
+func (p *Player) PlaceOrder(order api.LimitOrder) (string, error) {
+	var orderId string
+	err := p.call("PlaceOrder", order, &orderId)
+	return orderId, err
+}
+
+func (p *Player) CancelOrder(symbol string, orderId string) error {
+	return p.call("CancelOrder", cancelArgs{Symbol: symbol, OrderId: orderId}, nil)
+}
@@ -8,10 +8,37 @@ import (
 	"syscall"
 
 	"botcoin/config"
+	"botcoin/control"
+	"botcoin/paper"
 	"botcoin/trading"
 )
 
+// runner is implemented by the trading bot and the paper trader
+type runner interface {
+	Start() error
+	Stop() error
+	Failures() <-chan error
+	Kill(reason string) error
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		commands := map[string]func([]string) error{
+			"data":     runData,
+			"backtest": runBacktest,
+			"sweep":    runSweep,
+			"replay":   runReplay,
+			"ladder":   runLadder,
+			"kill":     runKill,
+		}
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	configPath := flag.String("config", "config.json", "path to configuration file")
 	flag.Parse()
 
@@ -21,8 +48,15 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
-	// Create and start the trading bot
-	bot, err := trading.NewBot(cfg)
+	// Create and start the trading bot, or the paper trader which never sends
+	// orders to the exchange
+	var bot runner
+	if cfg.PaperTrading.Enabled {
+		log.Println("Paper trading enabled, orders are simulated locally")
+		bot, err = paper.NewTrader(cfg)
+	} else {
+		bot, err = trading.NewBot(cfg)
+	}
 	if err != nil {
 		log.Fatalf("Failed to create trading bot: %v", err)
 	}
@@ -31,13 +65,43 @@ func main() {
 		log.Fatalf("Failed to start trading bot: %v", err)
 	}
 
-	// Handle graceful shutdown
+	var controlServer *control.Server
+	if cfg.KillSwitch.ControlAddress != "" {
+		haltFile := trading.HaltFile(cfg.KillSwitch)
+		if cfg.PaperTrading.Enabled {
+			haltFile = trading.PaperHaltFile(cfg.KillSwitch)
+		}
+		controlServer, err = control.NewServer(cfg.KillSwitch, haltFile, bot)
+		if err == nil {
+			err = controlServer.Start()
+		}
+		if err != nil {
+			bot.Stop()
+			log.Fatalf("Failed to start control API: %v", err)
+		}
+	}
+
+	// Handle graceful shutdown, SIGUSR1 fires the kill switch
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	killChan := make(chan os.Signal, 1)
+	signal.Notify(killChan, syscall.SIGUSR1)
 
-	<-sigChan
+	select {
+	case <-sigChan:
+	case <-killChan:
+		if err := bot.Kill("signal"); err != nil {
+			log.Printf("Kill switch incomplete, check the account: %v", err)
+		}
+	case err := <-bot.Failures():
+		log.Printf("Trading bot failed: %v", err)
+	}
 	log.Println("Shutting down...")
-	
+
+	if controlServer != nil {
+		controlServer.Stop()
+	}
+
 	if err := bot.Stop(); err != nil {
 		log.Printf("Error during shutdown: %v", err)
 	}
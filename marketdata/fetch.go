@@ -0,0 +1,66 @@
+package marketdata
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"botcoin/api"
+)
+
+const (
+	pageSize     = 200                    // candles per request of the history endpoint
+	pageInterval = 200 * time.Millisecond // between requests, well below the rate limit
+)
+
+// Fetch downloads the closed candles of symbol missing in the store, starting
+// after the last stored candle or at since for an empty store. Every page is
+// stored as it arrives, so an interrupted download resumes where it stopped.
+func Fetch(client *api.Client, store *Store, symbol, granularity string, since time.Time) (int, error) {
+	interval, err := api.GranularityDuration(granularity)
+	if err != nil {
+		return 0, err
+	}
+
+	start := since
+	last, exists, err := store.Last(symbol, granularity)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read stored candles: %w", err)
+	}
+	if exists {
+		start = last.Timestamp.Add(interval)
+	}
+	// only store closed candles, the current one still changes
+	end := time.Now().Truncate(interval)
+	if !start.Before(end) {
+		log.Printf("Candles for %s (%s) are up to date", symbol, granularity)
+		return 0, nil
+	}
+
+	log.Printf("Fetching %s candles for %s from %s", granularity, symbol, start.Format(time.RFC3339))
+	ticker := time.NewTicker(pageInterval)
+	defer ticker.Stop()
+	added := 0
+	for pageStart := start; pageStart.Before(end); pageStart = pageStart.Add(pageSize * interval) {
+		if !pageStart.Equal(start) {
+			<-ticker.C
+		}
+		pageEnd := pageStart.Add(pageSize * interval)
+		if pageEnd.After(end) {
+			pageEnd = end
+		}
+		candles, err := client.GetHistoryCandles(symbol, granularity, pageStart, pageEnd)
+		if err != nil {
+			return added, fmt.Errorf("failed to fetch candles for %s from %s: %w", symbol, pageStart.Format(time.RFC3339), err)
+		}
+		n, err := store.appendAfter(symbol, granularity, last, exists, candles)
+		added += n
+		if err != nil {
+			return added, fmt.Errorf("failed to store candles for %s: %w", symbol, err)
+		}
+		if n := len(candles); n > 0 && (!exists || candles[n-1].Timestamp.After(last.Timestamp)) {
+			last, exists = candles[n-1], true
+		}
+	}
+	return added, nil
+}
@@ -0,0 +1,167 @@
+package marketdata
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"botcoin/api"
+)
+
+var csvHeader = []string{"timestamp", "open", "high", "low", "close", "base_volume", "quote_volume"}
+
+// Store keeps candles as one CSV file per symbol and granularity
+type Store struct {
+	Dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+// Path returns the file holding the candles of symbol and granularity
+func (s *Store) Path(symbol, granularity string) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("%s_%s.csv", symbol, granularity))
+}
+
+// Load reads all stored candles of symbol and granularity, oldest first
+func (s *Store) Load(symbol, granularity string) ([]api.Candle, error) {
+	return LoadCSV(s.Path(symbol, granularity))
+}
+
+// LoadCSV reads candles from a CSV file written by the store
+func LoadCSV(path string) ([]api.Candle, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	if _, err := reader.Read(); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read header of %s: %w", path, err)
+	}
+
+	var candles []api.Candle
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return candles, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		candle, err := parseRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		candles = append(candles, candle)
+	}
+}
+
+// Last returns the newest stored candle of symbol and granularity
+func (s *Store) Last(symbol, granularity string) (api.Candle, bool, error) {
+	candles, err := s.Load(symbol, granularity)
+	if errors.Is(err, os.ErrNotExist) {
+		return api.Candle{}, false, nil
+	}
+	if err != nil || len(candles) == 0 {
+		return api.Candle{}, false, err
+	}
+	return candles[len(candles)-1], true, nil
+}
+
+// Append adds candles newer than the last stored one, so overlapping
+// downloads don't produce duplicates. It returns the number of added candles.
+func (s *Store) Append(symbol, granularity string, candles []api.Candle) (int, error) {
+	last, exists, err := s.Last(symbol, granularity)
+	if err != nil {
+		return 0, err
+	}
+	return s.appendAfter(symbol, granularity, last, exists, candles)
+}
+
+// appendAfter is Append with the last stored candle already known, so
+// appending page by page doesn't read the file again for every page
+func (s *Store) appendAfter(symbol, granularity string, last api.Candle, exists bool, candles []api.Candle) (int, error) {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(s.Path(symbol, granularity), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if !exists {
+		if info, err := file.Stat(); err == nil && info.Size() == 0 {
+			if err := writer.Write(csvHeader); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	added := 0
+	for _, candle := range candles {
+		if exists && !candle.Timestamp.After(last.Timestamp) {
+			continue
+		}
+		if err := writer.Write(formatRecord(candle)); err != nil {
+			return added, err
+		}
+		last, exists = candle, true
+		added++
+	}
+	writer.Flush()
+	return added, writer.Error()
+}
+
+func formatRecord(candle api.Candle) []string {
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return []string{
+		strconv.FormatInt(candle.Timestamp.UnixMilli(), 10),
+		format(candle.Open),
+		format(candle.High),
+		format(candle.Low),
+		format(candle.Close),
+		format(candle.BaseVolume),
+		format(candle.QuoteVolume),
+	}
+}
+
+func parseRecord(record []string) (api.Candle, error) {
+	if len(record) != len(csvHeader) {
+		return api.Candle{}, fmt.Errorf("expected %d fields, got %d", len(csvHeader), len(record))
+	}
+	ts, err := strconv.ParseInt(record[0], 10, 64)
+	if err != nil {
+		return api.Candle{}, err
+	}
+	var values [6]float64
+	for i := range values {
+		if values[i], err = strconv.ParseFloat(record[i+1], 64); err != nil {
+			return api.Candle{}, err
+		}
+	}
+	return api.Candle{
+		Timestamp:   time.UnixMilli(ts),
+		Open:        values[0],
+		High:        values[1],
+		Low:         values[2],
+		Close:       values[3],
+		BaseVolume:  values[4],
+		QuoteVolume: values[5],
+	}, nil
+}
@@ -0,0 +1,281 @@
+package paper
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"botcoin/api"
+	"botcoin/clock"
+	"botcoin/config"
+	"botcoin/marketdata"
+	"botcoin/sim"
+	"botcoin/trading"
+)
+
+var ErrSourceExhausted = errors.New("recorded market data exhausted")
+
+// Source feeds market data into the simulated exchange
+type Source interface {
+	// Seed sets the current price of every symbol before trading starts
+	Seed(exchange *sim.Exchange, symbols []string) error
+	// Start keeps stepping the exchange until Stop is called. Errors the
+	// source cannot recover from are sent to failures.
+	Start(exchange *sim.Exchange, symbols []string, failures chan<- error) error
+	Stop() error
+}
+
+func newSource(cfg *config.Config) (Source, error) {
+	switch cfg.PaperTrading.Source {
+	case "", "live":
+		return &LiveSource{client: api.NewClient(cfg.APIKey, cfg.SecretKey, cfg.PassPhrase, cfg.IsDemoTrading), isDemoTrading: cfg.IsDemoTrading}, nil
+	case "recorded":
+		granularity := cfg.PaperTrading.Granularity
+		if granularity == "" {
+			granularity = "1m"
+		}
+		dir := cfg.PaperTrading.DataDir
+		if dir == "" {
+			dir = "data"
+		}
+		var warmup time.Duration
+		for _, process := range cfg.TradingProcesses {
+			warmup = max(warmup, trading.LadderWarmup(process))
+		}
+		return &RecordedSource{Store: marketdata.NewStore(dir), Granularity: granularity, Speed: cfg.PaperTrading.Speed, Warmup: warmup, Clock: clock.NewFake(time.Time{})}, nil
+	}
+	return nil, fmt.Errorf("unknown paper trading source: %s", cfg.PaperTrading.Source)
+}
+
+func notify(failures chan<- error, err error) {
+	select {
+	case failures <- err:
+	default:
+	}
+}
+
+// LiveSource matches orders against the public trades of Bitget. Every trade
+// push is applied as one candle spanning the pushed trades.
+type LiveSource struct {
+	client        *api.Client
+	isDemoTrading bool
+	ws            *api.PublicWebsocketClient
+}
+
+func (s *LiveSource) Seed(exchange *sim.Exchange, symbols []string) error {
+	for _, symbol := range symbols {
+		price, err := s.client.GetCurrentPrice(symbol)
+		if err != nil {
+			return fmt.Errorf("failed to get current price for %s: %w", symbol, err)
+		}
+		exchange.SetPrice(symbol, price, time.Now())
+	}
+	return nil
+}
+
+func (s *LiveSource) Start(exchange *sim.Exchange, symbols []string, failures chan<- error) error {
+	ws, err := api.NewPublicWebsocketClient(s.isDemoTrading)
+	if err != nil {
+		return fmt.Errorf("failed to create public websocket client: %w", err)
+	}
+	s.ws = ws
+	ws.OnStateChange(func(event api.ConnEvent) {
+		if event.State == api.StateFailed {
+			notify(failures, fmt.Errorf("market data connection failed: %w", event.Err))
+		}
+	})
+
+	for _, symbol := range symbols {
+		// pushes of a symbol are handled one at a time
+		last := exchange.Now()
+		err := ws.SubscribeTrades(symbol, func(trades []api.WSTrade) {
+			if candle, ok := tradeCandle(trades, last); ok {
+				last = candle.Timestamp
+				exchange.Step(symbol, candle)
+			}
+		})
+		if err != nil {
+			ws.Close()
+			return fmt.Errorf("failed to subscribe to trades of %s: %w", symbol, err)
+		}
+	}
+	log.Printf("Paper trading against live trades of %v", symbols)
+	return nil
+}
+
+func (s *LiveSource) Stop() error {
+	if s.ws == nil {
+		return nil
+	}
+	return s.ws.Close()
+}
+
+// tradeCandle aggregates the trades newer than since, the time of the last
+// trade applied before. The recent trades of the initial snapshot are skipped.
+func tradeCandle(trades []api.WSTrade, since time.Time) (api.Candle, bool) {
+	type trade struct {
+		ts    time.Time
+		price float64
+		size  float64
+	}
+	var parsed []trade
+	for _, t := range trades {
+		ms, err := strconv.ParseInt(t.Ts, 10, 64)
+		if err != nil {
+			continue
+		}
+		price, err := strconv.ParseFloat(t.Price, 64)
+		if err != nil {
+			continue
+		}
+		size, _ := strconv.ParseFloat(t.Size, 64)
+		ts := time.UnixMilli(ms)
+		if !ts.After(since) {
+			continue
+		}
+		parsed = append(parsed, trade{ts: ts, price: price, size: size})
+	}
+	if len(parsed) == 0 {
+		return api.Candle{}, false
+	}
+	// pushes are newest first
+	sort.SliceStable(parsed, func(i, j int) bool {
+		return parsed[i].ts.Before(parsed[j].ts)
+	})
+
+	candle := api.Candle{
+		Timestamp: parsed[len(parsed)-1].ts,
+		Open:      parsed[0].price,
+		High:      parsed[0].price,
+		Low:       parsed[0].price,
+		Close:     parsed[len(parsed)-1].price,
+	}
+	for _, t := range parsed {
+		candle.High = max(candle.High, t.price)
+		candle.Low = min(candle.Low, t.price)
+		candle.BaseVolume += t.size
+		candle.QuoteVolume += t.size * t.price
+	}
+	return candle, true
+}
+
+// liveHistory answers candle and contract requests from Bitget, as the
+// simulated exchange only knows the candles since the live source started and
+// has no size rules
+type liveHistory struct {
+	*sim.Exchange
+	client *api.Client
+}
+
+func (e liveHistory) GetCandles(symbol, granularity string, start, end time.Time) ([]api.Candle, error) {
+	return e.client.GetCandles(symbol, granularity, start, end)
+}
+
+func (e liveHistory) GetContract(symbol string) (*api.Contract, error) {
+	return e.client.GetContract(symbol)
+}
+
+// RecordedSource replays stored candles. Candles before the time of the
+// exchange are skipped, so a restored paper account continues where it stopped,
+// and added to the candle history of the exchange.
+type RecordedSource struct {
+	Store       *marketdata.Store
+	Granularity string
+	Speed       float64       // multiple of real time, 0 replays as fast as possible
+	Warmup      time.Duration // history before the first replayed candle of a new account
+	Clock       *clock.Fake   // follows the replayed candles
+
+	steps []recordedStep
+	stop  chan struct{}
+	once  sync.Once
+}
+
+type recordedStep struct {
+	symbol string
+	candle api.Candle
+}
+
+// Seed loads the candles to replay, seeds the prices with the first of them
+// and adds the skipped ones to the history
+func (s *RecordedSource) Seed(exchange *sim.Exchange, symbols []string) error {
+	since := exchange.Now()
+	var steps []recordedStep
+	for _, symbol := range symbols {
+		candles, err := s.Store.Load(symbol, s.Granularity)
+		if err != nil {
+			return fmt.Errorf("failed to load candles for %s: %w", symbol, err)
+		}
+		skipUntil := since
+		if since.IsZero() && s.Warmup > 0 && len(candles) > 0 {
+			skipUntil = candles[0].Timestamp.Add(s.Warmup)
+		}
+		var history []api.Candle
+		first := true
+		for _, candle := range candles {
+			// the time of a restored exchange is the close of its last candle
+			if candle.Timestamp.Before(skipUntil) || candle.Timestamp.Before(since) {
+				history = append(history, candle)
+				continue
+			}
+			if first {
+				exchange.SetPrice(symbol, candle.Open, candle.Timestamp)
+				first = false
+			}
+			steps = append(steps, recordedStep{symbol: symbol, candle: candle})
+		}
+		if first {
+			return fmt.Errorf("no candles stored for %s after %s", symbol, skipUntil.Format(time.DateTime))
+		}
+		exchange.AddHistory(symbol, history)
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].candle.Timestamp.Before(steps[j].candle.Timestamp)
+	})
+	if s.Clock != nil {
+		s.Clock.Set(steps[0].candle.Timestamp)
+	}
+	s.steps = steps
+	return nil
+}
+
+func (s *RecordedSource) Start(exchange *sim.Exchange, symbols []string, failures chan<- error) error {
+	if len(s.steps) == 0 {
+		return fmt.Errorf("no recorded candles seeded for %v", symbols)
+	}
+	s.stop = make(chan struct{})
+	go s.replay(exchange, s.steps, failures)
+	log.Printf("Paper trading against %d recorded candles of %v", len(s.steps), symbols)
+	return nil
+}
+
+func (s *RecordedSource) replay(exchange *sim.Exchange, steps []recordedStep, failures chan<- error) {
+	var previous time.Time
+	for _, step := range steps {
+		if s.Speed > 0 && !previous.IsZero() {
+			select {
+			case <-time.After(time.Duration(float64(step.candle.Timestamp.Sub(previous)) / s.Speed)):
+			case <-s.stop:
+				return
+			}
+		}
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		exchange.Step(step.symbol, step.candle)
+		previous = step.candle.Timestamp
+	}
+	notify(failures, ErrSourceExhausted)
+}
+
+func (s *RecordedSource) Stop() error {
+	if s.stop != nil {
+		s.once.Do(func() { close(s.stop) })
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package paper
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"botcoin/api"
+	"botcoin/config"
+	"botcoin/sim"
+	"botcoin/trading"
+)
+
+const (
+	defaultStateFile      = "paper_state.json"
+	defaultInitialBalance = 10000
+	saveInterval          = 30 * time.Second
+)
+
+// Trader runs the trading bot against a local simulated exchange fed by live
+// or recorded market data. Orders never reach the exchange. Virtual balances,
+// positions and orders are persisted, so paper trading survives restarts.
+type Trader struct {
+	config    *config.Config
+	exchange  *sim.Exchange
+	source    Source
+	bot       *trading.Bot
+	stateFile string
+	saveMu    sync.Mutex
+	failures  chan error
+	done      chan struct{}
+	mu        sync.Mutex
+	isRunning bool
+}
+
+func NewTrader(cfg *config.Config) (*Trader, error) {
+	paperCfg := cfg.PaperTrading
+	options := sim.Options{
+		InitialBalance: paperCfg.InitialBalance,
+		Fees:           sim.Fees{Maker: paperCfg.MakerFee, Taker: paperCfg.TakerFee},
+		FillModel:      sim.FillModel(paperCfg.FillModel),
+		FundingRate:    paperCfg.FundingRate,
+	}
+	if paperCfg.Source == "recorded" {
+		granularity := paperCfg.Granularity
+		if granularity == "" {
+			granularity = "1m"
+		}
+		interval, err := api.GranularityDuration(granularity)
+		if err != nil {
+			return nil, err
+		}
+		options.CandleInterval = interval
+	}
+	if options.InitialBalance <= 0 {
+		options.InitialBalance = defaultInitialBalance
+	}
+	switch options.FillModel {
+	case "", sim.FillOnTouch, sim.FillOnTradeThrough:
+	default:
+		return nil, fmt.Errorf("unknown fill model: %s", paperCfg.FillModel)
+	}
+
+	stateFile := paperCfg.StateFile
+	if stateFile == "" {
+		stateFile = defaultStateFile
+	}
+	exchange := sim.NewExchange(options)
+	state, found, err := sim.LoadState(stateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load paper trading state: %w", err)
+	}
+	if found {
+		if err := exchange.Restore(state); err != nil {
+			return nil, fmt.Errorf("failed to restore paper trading state: %w", err)
+		}
+		log.Printf("Restored paper trading state from %s: balance %.2f, %d open orders, %d positions",
+			stateFile, state.Balance, len(state.Orders), len(state.Positions))
+	}
+
+	source, err := newSource(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Trader{
+		config:    cfg,
+		exchange:  exchange,
+		source:    source,
+		stateFile: stateFile,
+		failures:  make(chan error, 1),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// Exchange returns the simulated exchange
+func (t *Trader) Exchange() *sim.Exchange {
+	return t.exchange
+}
+
+func (t *Trader) Start() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.isRunning {
+		return fmt.Errorf("Paper trader is already running")
+	}
+
+	symbols := make([]string, 0, len(t.config.TradingProcesses))
+	for _, process := range t.config.TradingProcesses {
+		symbols = append(symbols, process.Symbol)
+	}
+	if err := t.source.Seed(t.exchange, symbols); err != nil {
+		return err
+	}
+
+	// the bot syncs its trading processes from the restored open orders
+	var exchange trading.Exchange = t.exchange
+	if live, ok := t.source.(*LiveSource); ok {
+		exchange = liveHistory{Exchange: t.exchange, client: live.client}
+	}
+	bot, err := trading.NewSimulatedBot(t.config, exchange)
+	if err != nil {
+		return fmt.Errorf("failed to create paper trading bot: %w", err)
+	}
+	t.bot = bot
+	bot.SetHaltFile(trading.PaperHaltFile(t.config.KillSwitch))
+	if recorded, ok := t.source.(*RecordedSource); ok && recorded.Clock != nil {
+		bot.SetClock(recorded.Clock)
+		t.exchange.SetClock(recorded.Clock)
+	}
+	t.exchange.OnFill(func(order api.Order) {
+		log.Printf("Paper order %s %s %s filled at %s", order.OrderId, order.Side, order.InstId, order.PriceAvg)
+		bot.HandleOrderUpdate(order)
+		t.save()
+	})
+	if err := bot.Start(); err != nil {
+		return fmt.Errorf("failed to start paper trading bot: %w", err)
+	}
+	t.exchange.OnStep(func(symbol string, candle api.Candle) {
+		bot.HandlePrice(symbol, candle.Close)
+		bot.HandleTimer(t.exchange.Now())
+	})
+	t.save()
+
+	// the source starts stepping the exchange once everything listens
+	if err := t.source.Start(t.exchange, symbols, t.failures); err != nil {
+		bot.Stop()
+		return err
+	}
+
+	t.isRunning = true
+	go t.saveRegularly()
+	go t.forwardFailures()
+	return nil
+}
+
+// Kill fires the kill switch of the bot against the simulated exchange
+func (t *Trader) Kill(reason string) error {
+	t.mu.Lock()
+	bot := t.bot
+	t.mu.Unlock()
+	if bot == nil {
+		return fmt.Errorf("Paper trader is not running")
+	}
+	err := bot.Kill(reason)
+	t.save()
+	return err
+}
+
+// forwardFailures passes failures of the bot on, e.g. once the kill switch
+// halted it
+func (t *Trader) forwardFailures() {
+	select {
+	case err := <-t.bot.Failures():
+		notify(t.failures, err)
+	case <-t.done:
+	}
+}
+
+func (t *Trader) Stop() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.isRunning {
+		return nil
+	}
+	t.isRunning = false
+	close(t.done)
+
+	err := t.source.Stop()
+	t.bot.Stop()
+	t.save()
+	log.Printf("Paper trading stopped: balance %.2f, equity %.2f", t.exchange.Balance(), t.exchange.Equity())
+	return err
+}
+
+// Failures delivers errors of the market data source, e.g. ErrSourceExhausted
+// once a recorded source has replayed all candles, and trading.ErrHalted once
+// the kill switch fired
+func (t *Trader) Failures() <-chan error {
+	return t.failures
+}
+
+func (t *Trader) saveRegularly() {
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.save()
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func (t *Trader) save() {
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+	if err := sim.SaveState(t.stateFile, t.exchange.Snapshot()); err != nil {
+		log.Printf("Failed to save paper trading state: %v", err)
+	}
+}
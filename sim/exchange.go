@@ -0,0 +1,642 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"botcoin/api"
+	"botcoin/clock"
+)
+
+// FillModel decides when a resting limit order counts as filled
+type FillModel string
+
+const (
+	// FillOnTouch fills as soon as the price reaches the limit price
+	FillOnTouch FillModel = "touch"
+	// FillOnTradeThrough only fills once the price moved beyond the limit
+	// price, i.e. the order would have been at the front of the queue
+	FillOnTradeThrough FillModel = "trade-through"
+)
+
+const fundingInterval = 8 * time.Hour
+
+var ErrUnknownOrder = errors.New("unknown order")
+
+// Fees are charged on the notional of every fill
+type Fees struct {
+	Maker float64 // fee rate of resting limit orders, e.g. 0.0002
+	Taker float64 // fee rate of orders that fill immediately
+}
+
+// Options configure the simulated exchange
+type Options struct {
+	InitialBalance float64
+	Fees           Fees
+	FillModel      FillModel
+	FundingRate    float64 // rate charged every 8 hours on the position notional, longs pay if positive
+	// CandleInterval is the duration of the stepped candles. Fills of a step
+	// happen at the candle's open, orders placed in reaction to it at its close.
+	CandleInterval time.Duration
+}
+
+type order struct {
+	api.Order
+	price float64
+	size  float64
+	taker bool // marketable on placement
+}
+
+type position struct {
+	size     float64 // positive for long, negative for short
+	avgPrice float64
+	opened   time.Time
+	updated  time.Time
+	funding  float64 // paid since the position was opened
+}
+
+// Stats accumulates what happened on the exchange
+type Stats struct {
+	Fills           int
+	FeesPaid        float64
+	FundingPaid     float64
+	RealizedPnL     float64 // excluding fees and funding
+	ClosedPositions int     // positions that went back to zero, i.e. completed cycles
+}
+
+// Exchange is a simulated futures exchange matching limit orders against
+// candles. It implements the Exchange interface of the trading package.
+type Exchange struct {
+	mu          sync.Mutex
+	options     Options
+	now         time.Time
+	prices      map[string]float64
+	orders      map[string]*order
+	positions   map[string]*position
+	history     []api.Order
+	candles     map[string][]api.Candle // stepped candles by symbol
+	balance     float64
+	nextOrderId int
+	lastFunding time.Time
+	stats       Stats
+	onFill      []func(api.Order)
+	onStep      []func(symbol string, candle api.Candle)
+	clock       *clock.Fake // follows the simulated time, if set
+}
+
+func NewExchange(options Options) *Exchange {
+	if options.FillModel == "" {
+		options.FillModel = FillOnTouch
+	}
+	return &Exchange{
+		options:   options,
+		prices:    make(map[string]float64),
+		orders:    make(map[string]*order),
+		positions: make(map[string]*position),
+		candles:   make(map[string][]api.Candle),
+		balance:   options.InitialBalance,
+	}
+}
+
+// OnFill registers a handler receiving every filled order. Handlers are
+// called without holding the exchange lock and may place or cancel orders.
+func (e *Exchange) OnFill(handler func(api.Order)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onFill = append(e.onFill, handler)
+}
+
+// OnStep registers a handler called after every step, once the fills of the
+// step have been handled
+func (e *Exchange) OnStep(handler func(symbol string, candle api.Candle)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.onStep = append(e.onStep, handler)
+}
+
+// SetClock makes clock follow the simulated time, so the trading logic sees
+// the time of the fill or candle close it reacts to
+func (e *Exchange) SetClock(clock *clock.Fake) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.clock = clock
+}
+
+// SetPrice sets the current price of symbol without matching orders, e.g. to
+// seed the exchange before the first candle
+func (e *Exchange) SetPrice(symbol string, price float64, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.prices[symbol] = price
+	e.advance(now)
+}
+
+// Now returns the simulated time
+func (e *Exchange) Now() time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.now
+}
+
+func (e *Exchange) advance(now time.Time) {
+	if now.After(e.now) {
+		e.now = now
+	}
+	if e.lastFunding.IsZero() {
+		e.lastFunding = e.now.Truncate(fundingInterval)
+	}
+}
+
+// Step matches the resting orders of symbol against candle and moves the
+// current price to its close
+func (e *Exchange) Step(symbol string, candle api.Candle) {
+	e.mu.Lock()
+	e.advance(candle.Timestamp)
+	e.now = candle.Timestamp
+	e.applyFunding()
+	if e.clock != nil {
+		e.clock.Set(e.now)
+	}
+
+	var candidates []*order
+	for _, o := range e.orders {
+		if o.InstId == symbol && e.touches(o, candle) {
+			candidates = append(candidates, o)
+		}
+	}
+	// orders closer to the open are reached first
+	sort.Slice(candidates, func(i, j int) bool {
+		di, dj := math.Abs(candidates[i].price-candle.Open), math.Abs(candidates[j].price-candle.Open)
+		if di != dj {
+			return di < dj
+		}
+		return candidates[i].OrderId < candidates[j].OrderId
+	})
+
+	var filled []api.Order
+	for _, o := range candidates {
+		fillPrice := o.price
+		if o.Side == "buy" && candle.Open < o.price || o.Side == "sell" && candle.Open > o.price {
+			fillPrice = candle.Open // gapped through the limit, filled at the better open
+		}
+		filled = append(filled, e.fill(o, fillPrice))
+	}
+
+	// the close is only known at the end of the candle
+	e.now = candle.Timestamp.Add(e.options.CandleInterval)
+	if e.clock != nil {
+		e.clock.Set(e.now)
+	}
+	e.prices[symbol] = candle.Close
+	e.candles[symbol] = append(e.candles[symbol], candle)
+	handlers := append([]func(api.Order){}, e.onFill...)
+	stepHandlers := append([]func(string, api.Candle){}, e.onStep...)
+	e.mu.Unlock()
+
+	for _, order := range filled {
+		for _, handler := range handlers {
+			handler(order)
+		}
+	}
+	for _, handler := range stepHandlers {
+		handler(symbol, candle)
+	}
+}
+
+func (e *Exchange) touches(o *order, candle api.Candle) bool {
+	if o.taker {
+		return true
+	}
+	if o.Side == "buy" {
+		if e.options.FillModel == FillOnTradeThrough {
+			return candle.Low < o.price
+		}
+		return candle.Low <= o.price
+	}
+	if e.options.FillModel == FillOnTradeThrough {
+		return candle.High > o.price
+	}
+	return candle.High >= o.price
+}
+
+func (e *Exchange) fill(o *order, fillPrice float64) api.Order {
+	delete(e.orders, o.OrderId)
+
+	feeRate := e.options.Fees.Maker
+	if o.taker {
+		feeRate = e.options.Fees.Taker
+	}
+	fee := fillPrice * o.size * feeRate
+	e.balance -= fee
+	e.stats.FeesPaid += fee
+	e.stats.Fills++
+
+	signed := o.size
+	if o.Side == "sell" {
+		signed = -signed
+	}
+	pnl := e.updatePosition(o.InstId, signed, fillPrice)
+
+	o.Status = "filled"
+	o.PriceAvg = strconv.FormatFloat(fillPrice, 'f', -1, 64)
+	o.BaseVolume = o.Size
+	o.FillFee = strconv.FormatFloat(-fee, 'f', -1, 64)
+	o.Pnl = strconv.FormatFloat(pnl, 'f', -1, 64)
+	o.FillTime = strconv.FormatInt(e.now.UnixMilli(), 10)
+	o.UTime = o.FillTime
+	e.history = append(e.history, o.Order)
+	return o.Order
+}
+
+// updatePosition applies a fill to the position of symbol and returns the
+// realized PnL
+func (e *Exchange) updatePosition(symbol string, signed, price float64) float64 {
+	p, ok := e.positions[symbol]
+	if !ok {
+		p = &position{opened: e.now}
+		e.positions[symbol] = p
+	}
+	p.updated = e.now
+
+	switch {
+	case p.size == 0 || sameSign(p.size, signed):
+		// opening or increasing
+		p.avgPrice = (p.avgPrice*math.Abs(p.size) + price*math.Abs(signed)) / (math.Abs(p.size) + math.Abs(signed))
+		if p.size == 0 {
+			p.opened = e.now
+		}
+		p.size += signed
+		return 0
+	default:
+		// reducing, closing or flipping
+		closed := math.Min(math.Abs(signed), math.Abs(p.size))
+		pnl := (price - p.avgPrice) * closed
+		if p.size < 0 {
+			pnl = -pnl
+		}
+		e.balance += pnl
+		e.stats.RealizedPnL += pnl
+		p.size += signed
+		if math.Abs(p.size) < 1e-12 {
+			delete(e.positions, symbol)
+			e.stats.ClosedPositions++
+		} else if !sameSign(p.size, p.size-signed) {
+			p.avgPrice = price
+			p.opened = e.now
+			p.funding = 0
+		}
+		return pnl
+	}
+}
+
+func sameSign(a, b float64) bool {
+	return (a > 0) == (b > 0)
+}
+
+// applyFunding charges funding for every funding interval passed since the
+// last one
+func (e *Exchange) applyFunding() {
+	for next := e.lastFunding.Add(fundingInterval); !next.After(e.now); next = next.Add(fundingInterval) {
+		for symbol, p := range e.positions {
+			funding := p.size * e.prices[symbol] * e.options.FundingRate
+			e.balance -= funding
+			e.stats.FundingPaid += funding
+			p.funding += funding
+		}
+		e.lastFunding = next
+	}
+}
+
+// Equity returns the balance plus the unrealized PnL of all positions
+func (e *Exchange) Equity() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	equity := e.balance
+	for symbol, p := range e.positions {
+		equity += (e.prices[symbol] - p.avgPrice) * p.size
+	}
+	return equity
+}
+
+// Balance returns the wallet balance excluding unrealized PnL
+func (e *Exchange) Balance() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.balance
+}
+
+// HasPosition reports whether symbol has an open position
+func (e *Exchange) HasPosition(symbol string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, ok := e.positions[symbol]
+	return ok
+}
+
+// Stats returns the accumulated statistics
+func (e *Exchange) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+func (e *Exchange) GetCurrentPrice(symbol string) (float64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	price, ok := e.prices[symbol]
+	if !ok {
+		return 0, fmt.Errorf("no price data available for %s", symbol)
+	}
+	return price, nil
+}
+
+func (e *Exchange) GetPosition(symbol string) (*api.Position, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	p, ok := e.positions[symbol]
+	if !ok {
+		return nil, api.ErrNoPosition
+	}
+	holdSide := "long"
+	if p.size < 0 {
+		holdSide = "short"
+	}
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return &api.Position{
+		Symbol:       symbol,
+		HoldSide:     holdSide,
+		Total:        format(math.Abs(p.size)),
+		Available:    format(math.Abs(p.size)),
+		OpenPriceAvg: format(p.avgPrice),
+		MarkPrice:    format(e.prices[symbol]),
+		UnrealizedPL: format((e.prices[symbol] - p.avgPrice) * p.size),
+		TotalFee:     format(-p.funding),
+		PosMode:      "one_way_mode",
+		CTime:        strconv.FormatInt(p.opened.UnixMilli(), 10),
+		UTime:        strconv.FormatInt(p.updated.UnixMilli(), 10),
+	}, nil
+}
+
+// GetPositions returns the position of symbol, the simulated exchange trades
+// in one-way mode
+func (e *Exchange) GetPositions(symbol string) ([]api.Position, error) {
+	position, err := e.GetPosition(symbol)
+	if errors.Is(err, api.ErrNoPosition) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []api.Position{*position}, nil
+}
+
+func (e *Exchange) GetPendingOrders(symbol string) ([]api.Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var orders []api.Order
+	for _, o := range e.orders {
+		if o.InstId == symbol {
+			orders = append(orders, o.Order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].OrderId < orders[j].OrderId
+	})
+	return orders, nil
+}
+
+func (e *Exchange) GetOrderHistory(symbol string, since time.Time) ([]api.Order, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var orders []api.Order
+	for _, o := range e.history {
+		uTime, _ := strconv.ParseInt(o.UTime, 10, 64)
+		if o.InstId == symbol && !time.UnixMilli(uTime).Before(since) {
+			orders = append(orders, o)
+		}
+	}
+	return orders, nil
+}
+
+// GetFilledOrders returns the orders of symbol filled since the given time
+// in the order they were filled
+func (e *Exchange) GetFilledOrders(symbol string, since time.Time) ([]api.Order, error) {
+	orders, err := e.GetOrderHistory(symbol, since)
+	if err != nil {
+		return nil, err
+	}
+	filled := orders[:0]
+	for _, o := range orders {
+		if o.Status == "filled" {
+			filled = append(filled, o)
+		}
+	}
+	sort.SliceStable(filled, func(i, j int) bool {
+		return filled[i].UTime < filled[j].UTime
+	})
+	return filled, nil
+}
+
+// AddHistory stores candles from before the simulation starts, e.g. to warm
+// up indicators, without matching orders against them
+func (e *Exchange) AddHistory(symbol string, candles []api.Candle) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.candles[symbol] = append(e.candles[symbol], candles...)
+}
+
+// GetCandles returns the stepped candles of symbol between start and end,
+// aggregated to granularity
+func (e *Exchange) GetCandles(symbol, granularity string, start, end time.Time) ([]api.Candle, error) {
+	interval, err := api.GranularityDuration(granularity)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var candles []api.Candle
+	for _, candle := range e.candles[symbol] {
+		if candle.Timestamp.Before(start) || !candle.Timestamp.Before(end) {
+			continue
+		}
+		bucket := candle.Timestamp.Truncate(interval)
+		if n := len(candles); n > 0 && candles[n-1].Timestamp.Equal(bucket) {
+			last := &candles[n-1]
+			last.High = math.Max(last.High, candle.High)
+			last.Low = math.Min(last.Low, candle.Low)
+			last.Close = candle.Close
+			last.BaseVolume += candle.BaseVolume
+			last.QuoteVolume += candle.QuoteVolume
+			continue
+		}
+		candle.Timestamp = bucket
+		candles = append(candles, candle)
+	}
+	return candles, nil
+}
+
+// GetCurrentFundingRate returns the configured funding rate
+func (e *Exchange) GetCurrentFundingRate(symbol string) (float64, error) {
+	return e.options.FundingRate, nil
+}
+
+// GetNextFundingTime returns the next settlement, every 8 hours
+func (e *Exchange) GetNextFundingTime(symbol string) (time.Time, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.now.Truncate(fundingInterval).Add(fundingInterval), nil
+}
+
+// GetContract returns a contract without size rules, the simulated exchange
+// accepts any order size
+func (e *Exchange) GetContract(symbol string) (*api.Contract, error) {
+	return &api.Contract{Symbol: symbol}, nil
+}
+
+// AddMargin has no effect, positions are not leveraged and never liquidated
+// on the simulated exchange
+func (e *Exchange) AddMargin(symbol, holdSide string, amount float64) error {
+	return nil
+}
+
+// PlaceMarketOrder fills an order immediately at the current price paying
+// the taker fee
+func (e *Exchange) PlaceMarketOrder(symbol, side string, size float64, reduceOnly bool) (string, error) {
+	e.mu.Lock()
+	if reduceOnly {
+		p, ok := e.positions[symbol]
+		if !ok || side == "buy" && p.size > 0 || side == "sell" && p.size < 0 {
+			e.mu.Unlock()
+			return "", fmt.Errorf("market order placement failed: no position of %s to reduce", symbol)
+		}
+		size = math.Min(size, math.Abs(p.size))
+	}
+	filled, err := e.marketOrder(symbol, side, size)
+	handlers := append([]func(api.Order){}, e.onFill...)
+	e.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	for _, handler := range handlers {
+		handler(filled)
+	}
+	return filled.OrderId, nil
+}
+
+// FlashClose closes the position of symbol with a market order
+func (e *Exchange) FlashClose(symbol, holdSide string) error {
+	e.mu.Lock()
+	p, ok := e.positions[symbol]
+	if !ok {
+		e.mu.Unlock()
+		return fmt.Errorf("flash close failed: no position of %s", symbol)
+	}
+	side := "sell"
+	if p.size < 0 {
+		side = "buy"
+	}
+	filled, err := e.marketOrder(symbol, side, math.Abs(p.size))
+	handlers := append([]func(api.Order){}, e.onFill...)
+	e.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, handler := range handlers {
+		handler(filled)
+	}
+	return nil
+}
+
+func (e *Exchange) marketOrder(symbol, side string, size float64) (api.Order, error) {
+	price, ok := e.prices[symbol]
+	if !ok || size <= 0 {
+		return api.Order{}, fmt.Errorf("market order placement failed: no price of %s or invalid size %f", symbol, size)
+	}
+	e.nextOrderId++
+	orderId := fmt.Sprintf("sim-%08d", e.nextOrderId)
+	now := strconv.FormatInt(e.now.UnixMilli(), 10)
+	o := &order{
+		Order: api.Order{
+			OrderId:   orderId,
+			InstId:    symbol,
+			Symbol:    symbol,
+			Side:      side,
+			Price:     strconv.FormatFloat(price, 'f', -1, 64),
+			Size:      strconv.FormatFloat(size, 'f', -1, 64),
+			OrderType: "market",
+			CTime:     now,
+		},
+		price: price,
+		size:  size,
+		taker: true,
+	}
+	return e.fill(o, price), nil
+}
+
+func (e *Exchange) PlaceOrder(limitOrder api.LimitOrder) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if limitOrder.Price <= 0 || limitOrder.Size <= 0 {
+		return "", fmt.Errorf("order placement failed: invalid price %f or size %f", limitOrder.Price, limitOrder.Size)
+	}
+	if limitOrder.Side != "buy" && limitOrder.Side != "sell" {
+		return "", fmt.Errorf("order placement failed: invalid side %s", limitOrder.Side)
+	}
+
+	e.nextOrderId++
+	orderId := fmt.Sprintf("sim-%08d", e.nextOrderId)
+	now := strconv.FormatInt(e.now.UnixMilli(), 10)
+	current, hasPrice := e.prices[limitOrder.Symbol]
+	e.orders[orderId] = &order{
+		Order: api.Order{
+			OrderId:   orderId,
+			ClientOId: limitOrder.ClientOid,
+			InstId:    limitOrder.Symbol,
+			Symbol:    limitOrder.Symbol,
+			Side:      limitOrder.Side,
+			Price:     strconv.FormatFloat(limitOrder.Price, 'f', -1, 64),
+			Size:      strconv.FormatFloat(limitOrder.Size, 'f', -1, 64),
+			OrderType: "limit",
+			Force:     "gtc",
+			Status:    "live",
+			CTime:     now,
+			UTime:     now,
+		},
+		price: limitOrder.Price,
+		size:  limitOrder.Size,
+		taker: hasPrice && (limitOrder.Side == "buy" && limitOrder.Price >= current || limitOrder.Side == "sell" && limitOrder.Price <= current),
+	}
+	return orderId, nil
+}
+
+func (e *Exchange) CancelOrder(symbol string, orderId string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	o, ok := e.orders[orderId]
+	if !ok || o.InstId != symbol {
+		return fmt.Errorf("order cancellation failed: %w %s", ErrUnknownOrder, orderId)
+	}
+	delete(e.orders, orderId)
+	o.Status = "canceled"
+	o.UTime = strconv.FormatInt(e.now.UnixMilli(), 10)
+	e.history = append(e.history, o.Order)
+	return nil
+}
@@ -0,0 +1,221 @@
+package sim
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"botcoin/api"
+)
+
+const symbol = "BTCUSDT"
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func candle(open, high, low, close float64) api.Candle {
+	return api.Candle{Timestamp: start.Add(time.Minute), Open: open, High: high, Low: low, Close: close}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestFillModels(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     FillModel
+		side      string
+		limit     float64
+		candle    api.Candle
+		filled    bool
+		fillPrice float64
+	}{
+		{"buy touched", FillOnTouch, "buy", 99, candle(100, 100, 99, 99.5), true, 99},
+		{"buy not reached", FillOnTouch, "buy", 99, candle(100, 100, 99.1, 99.5), false, 0},
+		{"buy touched, trade-through", FillOnTradeThrough, "buy", 99, candle(100, 100, 99, 99.5), false, 0},
+		{"buy traded through", FillOnTradeThrough, "buy", 99, candle(100, 100, 98.9, 99.5), true, 99},
+		{"buy gapped through", FillOnTouch, "buy", 99, candle(97, 98, 96, 97), true, 97},
+		{"sell touched", FillOnTouch, "sell", 101, candle(100, 101, 100, 100.5), true, 101},
+		{"sell touched, trade-through", FillOnTradeThrough, "sell", 101, candle(100, 101, 100, 100.5), false, 0},
+		{"sell traded through", FillOnTradeThrough, "sell", 101, candle(100, 101.1, 100, 100.5), true, 101},
+		{"sell gapped through", FillOnTradeThrough, "sell", 101, candle(103, 104, 102, 103), true, 103},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExchange(Options{InitialBalance: 1000, FillModel: tt.model})
+			e.SetPrice(symbol, 100, start)
+			var fills []api.Order
+			e.OnFill(func(order api.Order) { fills = append(fills, order) })
+			if _, err := e.PlaceOrder(api.LimitOrder{Symbol: symbol, Side: tt.side, Price: tt.limit, Size: 1}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			e.Step(symbol, tt.candle)
+			if got := len(fills) == 1; got != tt.filled {
+				t.Fatalf("filled = %v, want %v", got, tt.filled)
+			}
+			if !tt.filled {
+				if orders, _ := e.GetPendingOrders(symbol); len(orders) != 1 {
+					t.Errorf("pending orders = %d, want the unfilled order", len(orders))
+				}
+				return
+			}
+			if price, _ := strconv.ParseFloat(fills[0].PriceAvg, 64); price != tt.fillPrice {
+				t.Errorf("fill price = %v, want %v", price, tt.fillPrice)
+			}
+			if fills[0].Status != "filled" {
+				t.Errorf("status = %s, want filled", fills[0].Status)
+			}
+		})
+	}
+}
+
+func TestFees(t *testing.T) {
+	fees := Fees{Maker: 0.0002, Taker: 0.0006}
+	tests := []struct {
+		name  string
+		place func(e *Exchange) error
+		want  float64
+	}{
+		{"resting limit order pays maker", func(e *Exchange) error {
+			_, err := e.PlaceOrder(api.LimitOrder{Symbol: symbol, Side: "buy", Price: 99, Size: 2})
+			e.Step(symbol, candle(100, 100, 98, 99))
+			return err
+		}, 99 * 2 * 0.0002},
+		{"marketable limit order pays taker", func(e *Exchange) error {
+			_, err := e.PlaceOrder(api.LimitOrder{Symbol: symbol, Side: "buy", Price: 101, Size: 2})
+			e.Step(symbol, candle(100, 100, 100, 100))
+			return err
+		}, 100 * 2 * 0.0006},
+		{"market order pays taker", func(e *Exchange) error {
+			_, err := e.PlaceMarketOrder(symbol, "sell", 2, false)
+			return err
+		}, 100 * 2 * 0.0006},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExchange(Options{InitialBalance: 1000, Fees: fees})
+			e.SetPrice(symbol, 100, start)
+			var fills []api.Order
+			e.OnFill(func(order api.Order) { fills = append(fills, order) })
+			if err := tt.place(e); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(fills) != 1 {
+				t.Fatalf("fills = %d, want 1", len(fills))
+			}
+			if got := e.Stats().FeesPaid; !near(got, tt.want) {
+				t.Errorf("fees paid = %v, want %v", got, tt.want)
+			}
+			if got := e.Balance(); !near(got, 1000-tt.want) {
+				t.Errorf("balance = %v, want %v", got, 1000-tt.want)
+			}
+			if fee, _ := strconv.ParseFloat(fills[0].FillFee, 64); !near(fee, -tt.want) {
+				t.Errorf("fill fee = %v, want %v", fee, -tt.want)
+			}
+		})
+	}
+}
+
+func TestFunding(t *testing.T) {
+	tests := []struct {
+		name    string
+		side    string
+		rate    float64
+		elapsed time.Duration
+		want    float64 // paid, negative if received
+	}{
+		{"long pays positive rate", "buy", 0.0001, 8 * time.Hour, 0.01},
+		{"short receives positive rate", "sell", 0.0001, 8 * time.Hour, -0.01},
+		{"long receives negative rate", "buy", -0.0001, 8 * time.Hour, -0.01},
+		{"before the funding time", "buy", 0.0001, 8*time.Hour - time.Minute, 0},
+		{"every interval", "buy", 0.0001, 16 * time.Hour, 0.02},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExchange(Options{InitialBalance: 1000, FundingRate: tt.rate})
+			e.SetPrice(symbol, 100, start)
+			if _, err := e.PlaceMarketOrder(symbol, tt.side, 1, false); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			e.Step(symbol, api.Candle{Timestamp: start.Add(tt.elapsed), Open: 100, High: 100, Low: 100, Close: 100})
+			if got := e.Stats().FundingPaid; !near(got, tt.want) {
+				t.Errorf("funding paid = %v, want %v", got, tt.want)
+			}
+			if got := e.Balance(); !near(got, 1000-tt.want) {
+				t.Errorf("balance = %v, want %v", got, 1000-tt.want)
+			}
+			position, err := e.GetPosition(symbol)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if fee, _ := strconv.ParseFloat(position.TotalFee, 64); !near(fee, -tt.want) {
+				t.Errorf("position fee = %v, want %v", fee, -tt.want)
+			}
+		})
+	}
+}
+
+type fill struct {
+	side  string
+	size  float64
+	price float64
+}
+
+func TestPositionAccounting(t *testing.T) {
+	tests := []struct {
+		name     string
+		fills    []fill
+		holdSide string // empty if no position is left
+		size     float64
+		avgPrice float64
+		pnl      float64
+		closed   int
+	}{
+		{"opened", []fill{{"buy", 1, 100}}, "long", 1, 100, 0, 0},
+		{"increased", []fill{{"buy", 1, 100}, {"buy", 3, 120}}, "long", 4, 115, 0, 0},
+		{"reduced", []fill{{"buy", 2, 100}, {"sell", 1, 110}}, "long", 1, 100, 10, 0},
+		{"closed at a loss", []fill{{"buy", 1, 100}, {"sell", 1, 90}}, "", 0, 0, -10, 1},
+		{"short closed", []fill{{"sell", 2, 100}, {"buy", 2, 90}}, "", 0, 0, 20, 1},
+		{"flipped", []fill{{"buy", 1, 100}, {"sell", 3, 110}}, "short", 2, 110, 10, 0},
+		{"closed twice", []fill{{"buy", 1, 100}, {"sell", 1, 105}, {"buy", 1, 100}, {"sell", 1, 105}}, "", 0, 0, 10, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewExchange(Options{InitialBalance: 1000})
+			for i, f := range tt.fills {
+				e.SetPrice(symbol, f.price, start.Add(time.Duration(i)*time.Minute))
+				if _, err := e.PlaceMarketOrder(symbol, f.side, f.size, false); err != nil {
+					t.Fatalf("fill %d: %v", i, err)
+				}
+			}
+
+			stats := e.Stats()
+			if !near(stats.RealizedPnL, tt.pnl) || !near(e.Balance(), 1000+tt.pnl) {
+				t.Errorf("realized pnl = %v, balance %v, want %v", stats.RealizedPnL, e.Balance(), tt.pnl)
+			}
+			if stats.ClosedPositions != tt.closed {
+				t.Errorf("closed positions = %d, want %d", stats.ClosedPositions, tt.closed)
+			}
+			position, err := e.GetPosition(symbol)
+			if tt.holdSide == "" {
+				if !errors.Is(err, api.ErrNoPosition) {
+					t.Errorf("position = %+v, %v, want ErrNoPosition", position, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			size, _ := strconv.ParseFloat(position.Total, 64)
+			avgPrice, _ := strconv.ParseFloat(position.OpenPriceAvg, 64)
+			if position.HoldSide != tt.holdSide || !near(size, tt.size) || !near(avgPrice, tt.avgPrice) {
+				t.Errorf("position = %s %v at %v, want %s %v at %v", position.HoldSide, size, avgPrice, tt.holdSide, tt.size, tt.avgPrice)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"botcoin/api"
+)
+
+// State is the persistable state of an exchange, i.e. virtual balance,
+// positions and orders
+type State struct {
+	Time        time.Time                `json:"time"`
+	Balance     float64                  `json:"balance"`
+	Prices      map[string]float64       `json:"prices"`
+	Orders      []OrderState             `json:"orders"`
+	Positions   map[string]PositionState `json:"positions"`
+	History     []api.Order              `json:"history"`
+	NextOrderId int                      `json:"next_order_id"`
+	LastFunding time.Time                `json:"last_funding"`
+	Stats       Stats                    `json:"stats"`
+}
+
+// OrderState is a resting order
+type OrderState struct {
+	Order api.Order `json:"order"`
+	Taker bool      `json:"taker"`
+}
+
+// PositionState is an open position, Size is negative for shorts
+type PositionState struct {
+	Size     float64   `json:"size"`
+	AvgPrice float64   `json:"avg_price"`
+	Opened   time.Time `json:"opened"`
+	Updated  time.Time `json:"updated"`
+	Funding  float64   `json:"funding"`
+}
+
+// Snapshot returns the current state of the exchange
+func (e *Exchange) Snapshot() State {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	state := State{
+		Time:        e.now,
+		Balance:     e.balance,
+		Prices:      make(map[string]float64, len(e.prices)),
+		Positions:   make(map[string]PositionState, len(e.positions)),
+		History:     append([]api.Order{}, e.history...),
+		NextOrderId: e.nextOrderId,
+		LastFunding: e.lastFunding,
+		Stats:       e.stats,
+	}
+	for symbol, price := range e.prices {
+		state.Prices[symbol] = price
+	}
+	for _, o := range e.orders {
+		state.Orders = append(state.Orders, OrderState{Order: o.Order, Taker: o.taker})
+	}
+	for symbol, p := range e.positions {
+		state.Positions[symbol] = PositionState{Size: p.size, AvgPrice: p.avgPrice, Opened: p.opened, Updated: p.updated, Funding: p.funding}
+	}
+	return state
+}
+
+// Restore replaces the state of the exchange with a snapshot
+func (e *Exchange) Restore(state State) error {
+	orders := make(map[string]*order, len(state.Orders))
+	for _, o := range state.Orders {
+		price, err := strconv.ParseFloat(o.Order.Price, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse price of order %s: %w", o.Order.OrderId, err)
+		}
+		size, err := strconv.ParseFloat(o.Order.Size, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse size of order %s: %w", o.Order.OrderId, err)
+		}
+		orders[o.Order.OrderId] = &order{Order: o.Order, price: price, size: size, taker: o.Taker}
+	}
+	positions := make(map[string]*position, len(state.Positions))
+	for symbol, p := range state.Positions {
+		positions[symbol] = &position{size: p.Size, avgPrice: p.AvgPrice, opened: p.Opened, updated: p.Updated, funding: p.Funding}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.now = state.Time
+	e.balance = state.Balance
+	e.prices = make(map[string]float64, len(state.Prices))
+	for symbol, price := range state.Prices {
+		e.prices[symbol] = price
+	}
+	e.orders = orders
+	e.positions = positions
+	e.history = append([]api.Order{}, state.History...)
+	e.nextOrderId = state.NextOrderId
+	e.lastFunding = state.LastFunding
+	e.stats = state.Stats
+	return nil
+}
+
+// LoadState reads a state written by SaveState. It reports false if the file
+// does not exist.
+func LoadState(path string) (State, bool, error) {
+	var state State
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, false, nil
+	}
+	if err != nil {
+		return state, false, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, false, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	return state, true, nil
+}
+
+// SaveState writes state to path, replacing the file atomically
+func SaveState(path string, state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -2,56 +2,74 @@ package trading
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
 	"sync"
 	"time"
 
 	"botcoin/api"
+	"botcoin/clock"
 	"botcoin/config"
+	"botcoin/journal"
 )
 
+// TradingProcess trades one symbol with its strategy
 type TradingProcess struct {
-	alreadyInitialized bool
-	mu                 sync.Mutex
-	Symbol             string
-	SellTargetPercent  float64
-	BuyOrders          []BuyOrder
-	SellOrder          *SellOrder
-}
-
-func (tp *TradingProcess) OrderWithIdExists(orderId string) bool {
-	for _, buyOrder := range tp.BuyOrders {
-		if buyOrder.OrderId == orderId {
-			return true
-		}
-		if tp.SellOrder != nil && tp.SellOrder.OrderId == orderId {
-			return true
-		}
-	}
-	return false
+	mu       sync.Mutex
+	Symbol   string
+	Strategy Strategy
+	ctx      *Context
+	guard    *liquidationGuard // nil unless configured
 }
 
-type BuyOrder struct {
-	OrderId     string
-	CoinPrice   float64
-	OrderAmount float64
-}
+const (
+	positionUpdateTimeout = 10 * time.Second
+	gapRecoveryMargin     = time.Minute // replay a little more history than strictly missed
+	timerInterval         = time.Minute // interval of the OnTimer calls of the strategies
+)
 
-type SellOrder struct {
-	OrderId     string
-	CoinPrice   float64
-	OrderAmount float64
+// Exchange is the part of the exchange api the trading logic depends on. It is
+// implemented by api.Client and by simulated exchanges.
+type Exchange interface {
+	GetCurrentPrice(symbol string) (float64, error)
+	GetPosition(symbol string) (*api.Position, error)
+	GetPositions(symbol string) ([]api.Position, error)
+	GetPendingOrders(symbol string) ([]api.Order, error)
+	GetOrderHistory(symbol string, since time.Time) ([]api.Order, error)
+	GetFilledOrders(symbol string, since time.Time) ([]api.Order, error)
+	GetCandles(symbol, granularity string, start, end time.Time) ([]api.Candle, error)
+	GetCurrentFundingRate(symbol string) (float64, error)
+	GetNextFundingTime(symbol string) (time.Time, error)
+	GetContract(symbol string) (*api.Contract, error)
+	AddMargin(symbol, holdSide string, amount float64) error
+	PlaceMarketOrder(symbol, side string, size float64, reduceOnly bool) (string, error)
+	FlashClose(symbol, holdSide string) error
+	PlaceOrder(order api.LimitOrder) (string, error)
+	CancelOrder(symbol string, orderId string) error
 }
 
 type Bot struct {
-	client           *api.Client
-	ws               *api.WebsocketClient
+	client           Exchange
+	ws               *api.WebsocketClient       // nil when trading against a simulated exchange
+	public           *api.PublicWebsocketClient // ticker feed, nil when trading against a simulated exchange
+	orders           orderPlacer
+	recorder         *journal.Recorder // nil unless a journal is configured
+	clock            clock.Clock
 	config           *config.Config
 	tradingProcesses map[string]*TradingProcess
+	orderUpdates     chan api.Order // handled one by one outside the websocket read loop
+	failures         chan error
+	done             chan struct{}
 	mu               sync.Mutex
 	isRunning        bool
+	lastTimer        time.Time
+	risk             *riskManager
+	haltFile         string // halt state of the kill switch, none in backtests and replays
+	halted           bool   // strategies get no more events once the kill switch fired
+	repeatCycles     bool   // completed ladders start over, only in backtests
 }
 
 func NewBot(cfg *config.Config) (*Bot, error) {
@@ -61,122 +79,144 @@ func NewBot(cfg *config.Config) (*Bot, error) {
 		return nil, fmt.Errorf("failed to create websocket client: %w", err)
 	}
 
-	bot := &Bot{
-		client:           client,
-		ws:               ws,
-		config:           cfg,
-		tradingProcesses: make(map[string]*TradingProcess),
+	orders, err := newOrderPlacer(cfg.OrderTransport, client, ws)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, tradingProcessConfig := range cfg.TradingProcesses {
-		var tradingProcess *TradingProcess
-		var alreadyInitialized bool
-		tradingProcess, alreadyInitialized, err = bot.syncCurrentTradingProcess(&tradingProcessConfig)
+	var exchange Exchange = client
+	var recorder *journal.Recorder
+	if cfg.JournalFile != "" {
+		recorder, err = journal.NewRecorder(cfg.JournalFile)
 		if err != nil {
-			return nil, fmt.Errorf("failed to sync trading process for %s: %w", tradingProcessConfig.Symbol, err)
+			return nil, err
+		}
+		client.SetTap(recorder.RecordRequest)
+		exchange = recorder.Exchange(client)
+		orders = recorder.Orders(orders)
+		ws.Tap(recorder.RecordMessage)
+		log.Printf("Recording exchange traffic to %s", cfg.JournalFile)
+	}
+
+	public, err := api.NewPublicWebsocketClient(cfg.IsDemoTrading)
+	if err != nil {
+		ws.Close()
+		return nil, fmt.Errorf("failed to create public websocket client: %w", err)
+	}
+	if recorder != nil {
+		public.Tap(recorder.RecordMessage)
+	}
+
+	bot := newBot(cfg, exchange, orders, ws)
+	bot.recorder = recorder
+	bot.haltFile = HaltFile(cfg.KillSwitch)
+	bot.public = public
+	ws.SetReconnectPolicy(reconnectPolicy(cfg.Websocket))
+	ws.OnStateChange(bot.handleConnEvent)
+	ws.OnReconnect(func(lastReceived time.Time) {
+		go bot.recoverGap(lastReceived)
+	})
+	public.SetReconnectPolicy(reconnectPolicy(cfg.Websocket))
+	public.OnStateChange(bot.handleConnEvent)
+
+	if err := bot.initTradingProcesses(); err != nil {
+		return nil, err
+	}
+	for _, process := range bot.tradingProcesses {
+		if p, ok := process.Strategy.(persister); ok {
+			p.persist()
 		}
-		if alreadyInitialized {
-			bot.tradingProcesses[tradingProcessConfig.Symbol] = tradingProcess
+		if process.guard == nil {
 			continue
 		}
-		tradingProcess, err = bot.initializeNewTradingProcess(&tradingProcessConfig)
-		if err != nil {
-			return nil, fmt.Errorf("failed to initialize trading process for %s: %w", tradingProcessConfig.Symbol, err)
+		if err := process.guard.persist(liquidationStateFile(process.guard.config, process.Symbol)); err != nil {
+			return nil, err
 		}
-		bot.tradingProcesses[tradingProcessConfig.Symbol] = tradingProcess
 	}
-
 	return bot, nil
 }
 
-func (b *Bot) syncCurrentTradingProcess(tradingProcessConfig *config.TradingProcessConfig) (*TradingProcess, bool, error) {
-	allOrders, err := b.client.GetPendingOrders(tradingProcessConfig.Symbol)
-	if err != nil {
-		return nil, false, fmt.Errorf("failed to get all orders: %w", err)
-	}
-	if allOrders == nil || len(allOrders) == 0 {
-		log.Printf("no existing orders found for %s", tradingProcessConfig.Symbol)
-		return nil, false, nil
-	}
-	var buyOrders []BuyOrder
-	var sellOrder *SellOrder
-	for _, order := range allOrders {
-		if order.Side == "buy" {
-			price, err := strconv.ParseFloat(order.Price, 64)
-			if err != nil {
-				return nil, false, fmt.Errorf("failed to parse order price: %w", err)
-			}
-			size, err := strconv.ParseFloat(order.Size, 64)
-			if err != nil {
-				return nil, false, fmt.Errorf("failed to parse order size: %w", err)
-			}
-			buyOrders = append(buyOrders, BuyOrder{
-				OrderId:     order.OrderId,
-				CoinPrice:   price,
-				OrderAmount: size,
-			})
-		}
-		if order.Side == "sell" {
-			price, err := strconv.ParseFloat(order.Price, 64)
-			if err != nil {
-				return nil, false, fmt.Errorf("failed to parse order price: %w", err)
-			}
-			size, err := strconv.ParseFloat(order.Size, 64)
-			if err != nil {
-				return nil, false, fmt.Errorf("failed to parse order size: %w", err)
-			}
-			sellOrder = &SellOrder{
-				OrderId:     order.OrderId,
-				CoinPrice:   price,
-				OrderAmount: size,
-			}
-		}
+// NewSimulatedBot creates a bot trading against the given exchange without a
+// websocket connection. Order updates, prices and timers have to be passed to
+// HandleOrderUpdate, HandlePrice and HandleTimer.
+func NewSimulatedBot(cfg *config.Config, exchange Exchange) (*Bot, error) {
+	bot := newBot(cfg, exchange, exchange, nil)
+	if err := bot.initTradingProcesses(); err != nil {
+		return nil, err
 	}
+	return bot, nil
+}
 
-	// extra guard just to be safe
-	if len(buyOrders) == 0 && sellOrder == nil {
-		log.Print("Got orders from api but neither buy nor sell orders found")
-		return nil, false, nil
+func newBot(cfg *config.Config, client Exchange, orders orderPlacer, ws *api.WebsocketClient) *Bot {
+	return &Bot{
+		client:           client,
+		ws:               ws,
+		orders:           orders,
+		clock:            clock.Real,
+		config:           cfg,
+		tradingProcesses: make(map[string]*TradingProcess),
+		orderUpdates:     make(chan api.Order, 100),
+		failures:         make(chan error, 1),
+		done:             make(chan struct{}),
+		risk:             newRiskManager(cfg.Risk, client, cfg.TradingProcesses),
 	}
+}
 
-	tradingProcess := &TradingProcess{
-		alreadyInitialized: true,
-		Symbol:             tradingProcessConfig.Symbol,
-		SellTargetPercent:  tradingProcessConfig.SellTargetPercent,
-		BuyOrders:          buyOrders,
-		SellOrder:          sellOrder,
+// SetClock replaces the wall clock, e.g. with simulated time in backtests and
+// replays. It has to be called before Start.
+func (b *Bot) SetClock(clock clock.Clock) {
+	b.clock = clock
+	if b.ws != nil {
+		b.ws.SetClock(clock)
 	}
+	if b.public != nil {
+		b.public.SetClock(clock)
+	}
+}
 
-	log.Printf("Synced existing trading process for %s", tradingProcess.Symbol)
-
-	return tradingProcess, true, nil
+func (b *Bot) initTradingProcesses() error {
+	for _, tradingProcessConfig := range b.config.TradingProcesses {
+		strategy, err := NewStrategy(tradingProcessConfig)
+		if err != nil {
+			return err
+		}
+		process := &TradingProcess{
+			Symbol:   tradingProcessConfig.Symbol,
+			Strategy: strategy,
+			ctx:      &Context{Symbol: tradingProcessConfig.Symbol, bot: b},
+		}
+		if guardConfig := tradingProcessConfig.LiquidationGuard; guardConfig != nil {
+			process.guard = &liquidationGuard{config: *guardConfig}
+		}
+		b.tradingProcesses[tradingProcessConfig.Symbol] = process
+	}
+	return nil
 }
 
-func (b *Bot) initializeNewTradingProcess(tradingProcessConfig *config.TradingProcessConfig) (*TradingProcess, error) {
-	log.Printf("Initializing new trading process for %s", tradingProcessConfig.Symbol)
-	tradingProcess := &TradingProcess{
-		Symbol:            tradingProcessConfig.Symbol,
-		SellTargetPercent: tradingProcessConfig.SellTargetPercent,
+func reconnectPolicy(cfg config.WebsocketConfig) api.ReconnectPolicy {
+	policy := api.DefaultReconnectPolicy()
+	if cfg.ReconnectInitialDelaySeconds > 0 {
+		policy.InitialDelay = time.Duration(cfg.ReconnectInitialDelaySeconds * float64(time.Second))
 	}
-	for _, buyOrderConfig := range tradingProcessConfig.BuyOrders {
-		coinPrice := buyOrderConfig.CoinPrice
-		if buyOrderConfig.CoinPriceBelowPercent > 0 {
-			// Get current price for symbol
-			currentPrice, err := b.client.GetCurrentPrice(tradingProcess.Symbol)
-			if err != nil {
-				return nil, fmt.Errorf("Failed to get current price for %s: %w", tradingProcess.Symbol, err)
-			}
-			coinPrice = currentPrice * (1 - buyOrderConfig.CoinPriceBelowPercent/100)
-		}
-		tradingProcess.BuyOrders = append(tradingProcess.BuyOrders, BuyOrder{
-			CoinPrice:   coinPrice,
-			OrderAmount: buyOrderConfig.OrderAmount,
-		})
+	if cfg.ReconnectMaxDelaySeconds > 0 {
+		policy.MaxDelay = time.Duration(cfg.ReconnectMaxDelaySeconds * float64(time.Second))
 	}
-	return tradingProcess, nil
+	if cfg.ReconnectMultiplier > 0 {
+		policy.Multiplier = cfg.ReconnectMultiplier
+	}
+	if cfg.ReconnectJitter > 0 {
+		policy.Jitter = cfg.ReconnectJitter
+	}
+	if cfg.ReconnectMaxAttempts > 0 {
+		policy.MaxAttempts = cfg.ReconnectMaxAttempts
+	}
+	policy.KeepTrying = cfg.KeepReconnecting
+	return policy
 }
 
-func (b *Bot) Start() error {
+// Start syncs the trading processes with the exchange and starts trading. If
+// it fails, the bot is stopped again and has to be recreated.
+func (b *Bot) Start() (err error) {
 	b.mu.Lock()
 	if b.isRunning {
 		b.mu.Unlock()
@@ -185,21 +225,97 @@ func (b *Bot) Start() error {
 	b.isRunning = true
 	b.mu.Unlock()
 
-	// Register handler dealing with order updates for all trading pairs
-	b.ws.RegisterHandler(b.handleOrderUpdate)
-	log.Println("Registered order update handler")
+	if b.haltFile != "" {
+		state, err := LoadHalt(b.haltFile)
+		if err == nil && state.Halted {
+			err = fmt.Errorf("%w since %s: %s, clear it with \"botcoin kill -clear\"", ErrHalted, state.Time.Format(time.DateTime), state.Reason)
+		}
+		if err != nil {
+			b.mu.Lock()
+			b.isRunning = false
+			b.mu.Unlock()
+			return err
+		}
+	}
+
+	defer func() {
+		if err != nil {
+			b.Stop()
+		}
+	}()
+
+	if b.ws != nil {
+		if err := b.subscribe(); err != nil {
+			return err
+		}
+		// updates pushed in the meantime wait in the buffered channel
+		go b.processOrderUpdates()
+	}
 
-	// Start trading for all pairs
-	for symbol, process := range b.tradingProcesses {
-		if process.alreadyInitialized {
-			log.Printf("Trading process for %s already initialized", symbol)
+	// Start trading for all pairs, in config order
+	for _, tradingProcessConfig := range b.config.TradingProcesses {
+		symbol := tradingProcessConfig.Symbol
+		process, exists := b.tradingProcess(symbol)
+		if !exists {
 			continue
 		}
-		if err := b.placeBuyOrders(symbol, process); err != nil {
-			log.Printf("Failed to place initial buy order for %s: %v", symbol, err)
+		openOrders, err := b.client.GetPendingOrders(symbol)
+		if err != nil {
+			return fmt.Errorf("failed to get open orders for %s: %w", symbol, err)
+		}
+		process.mu.Lock()
+		err = process.Strategy.OnStart(process.ctx, openOrders)
+		process.mu.Unlock()
+		if err != nil {
+			return fmt.Errorf("failed to start trading process for %s: %w", symbol, err)
 		}
 	}
 
+	if b.ws != nil {
+		if err := b.subscribeTickers(); err != nil {
+			return err
+		}
+		go b.runTimers()
+	}
+	return nil
+}
+
+func (b *Bot) subscribe() error {
+	// Keep positions and account balances up to date from pushes
+	if err := b.ws.SubscribeAccountState(); err != nil {
+		return fmt.Errorf("failed to subscribe to account state: %w", err)
+	}
+	log.Println("Subscribed to positions and account updates")
+
+	// Subscribe to order updates for all trading pairs
+	ordersArg := api.WSSubscription{
+		InstType: b.ws.InstType(),
+		Channel:  "orders",
+		InstId:   "default", // all trading pairs
+	}
+	if err := b.ws.Subscribe(ordersArg, b.handleOrderUpdate); err != nil {
+		return fmt.Errorf("failed to subscribe to order updates: %w", err)
+	}
+	log.Println("Subscribed to order updates")
+	return nil
+}
+
+// subscribeTickers passes the prices of all trading pairs to their strategies
+func (b *Bot) subscribeTickers() error {
+	for _, tradingProcessConfig := range b.config.TradingProcesses {
+		symbol := tradingProcessConfig.Symbol
+		err := b.public.SubscribeTicker(symbol, func(tickers []api.WSTicker) {
+			for _, ticker := range tickers {
+				if price, err := strconv.ParseFloat(ticker.LastPr, 64); err == nil {
+					b.HandlePrice(symbol, price)
+				}
+			}
+		})
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to ticker of %s: %w", symbol, err)
+		}
+	}
+	log.Println("Subscribed to tickers")
 	return nil
 }
 
@@ -212,33 +328,93 @@ func (b *Bot) Stop() error {
 	}
 
 	b.isRunning = false
-	return b.ws.Close()
+	close(b.done)
+	if b.ws == nil {
+		return nil
+	}
+	err := b.ws.Close()
+	b.public.Close()
+	if b.recorder != nil {
+		b.recorder.Close()
+	}
+	return err
 }
 
-func (b *Bot) placeBuyOrders(symbol string, process *TradingProcess) error {
-	process.mu.Lock()
-	defer process.mu.Unlock()
+// Failures delivers errors the bot cannot recover from, e.g. a websocket
+// connection that could not be restored
+func (b *Bot) Failures() <-chan error {
+	return b.failures
+}
 
-	for i, buyOrder := range process.BuyOrders {
-		if buyOrder.OrderId != "" {
-			log.Printf("Buy order for %s already placed with id %s", symbol, buyOrder.OrderId)
+func (b *Bot) handleConnEvent(event api.ConnEvent) {
+	switch event.State {
+	case api.StateReconnecting:
+		if errors.Is(event.Err, api.ErrReconnectExhausted) {
+			log.Printf("WARNING: websocket still down, order updates are not being received: %v", event.Err)
 		}
-		price := buyOrder.CoinPrice
-		size := buyOrder.OrderAmount / price // Convert EUR amount to crypto amount
-		orderId, err := b.client.PlaceLimitOrder(
-			symbol,
-			"buy",
-			price,
-			size,
-		)
+	case api.StateSubscribed:
+		log.Print("Websocket connection established")
+	case api.StateFailed:
+		log.Printf("Websocket connection lost for good: %v", event.Err)
+		select {
+		case b.failures <- fmt.Errorf("websocket connection failed: %w", event.Err):
+		default:
+		}
+	}
+}
+
+// recoverGap replays the orders filled since the last received websocket
+// message for all tracked trading processes, so fills missed while
+// disconnected are handled. Orders are looked up by their fills, as most of
+// them were created long before the gap.
+func (b *Bot) recoverGap(lastReceived time.Time) {
+	since := lastReceived.Add(-gapRecoveryMargin)
+	for _, symbol := range b.trackedSymbols() {
+		orders, err := b.client.GetFilledOrders(symbol, since)
 		if err != nil {
-			return fmt.Errorf("failed to place buy order: %w", err)
+			log.Printf("Failed to get filled orders for %s: %v", symbol, err)
+			continue
+		}
+		log.Printf("Replaying %d orders filled for %s since %s", len(orders), symbol, since.Format(time.RFC3339))
+
+		sort.SliceStable(orders, func(i, j int) bool {
+			return orders[i].UTime < orders[j].UTime
+		})
+		for _, order := range orders {
+			if order.Status != "filled" {
+				continue
+			}
+			if order.InstId == "" {
+				order.InstId = order.Symbol
+			}
+			select {
+			case b.orderUpdates <- order:
+			case <-b.done:
+				return
+			}
 		}
-		process.BuyOrders[i].OrderId = orderId
-		log.Printf("Placed buy order %s for %s at price %.2f", orderId, symbol, price)
 	}
+}
 
-	return nil
+func (b *Bot) trackedSymbols() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	symbols := make([]string, 0, len(b.tradingProcesses))
+	for symbol := range b.tradingProcesses {
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+func (b *Bot) tradingProcess(symbol string) (*TradingProcess, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.halted {
+		return nil, false
+	}
+	process, exists := b.tradingProcesses[symbol]
+	return process, exists
 }
 
 func (b *Bot) handleOrderUpdate(data []byte) {
@@ -250,14 +426,55 @@ func (b *Bot) handleOrderUpdate(data []byte) {
 
 	for _, order := range orders {
 		log.Printf("Received order update: status %s for order with id %s", order.Status, order.OrderId)
-		b.handleSingleOrderUpdate(&order)
+		select {
+		case b.orderUpdates <- order:
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// HandleOrderUpdate handles a single order update synchronously. It is used
+// by simulated exchanges, which deliver fills themselves.
+func (b *Bot) HandleOrderUpdate(order api.Order) {
+	b.handleSingleOrderUpdate(&order)
+}
+
+// processOrderUpdates handles queued order updates sequentially. Handling may
+// wait for position pushes, so it must not run on the websocket read loop.
+func (b *Bot) processOrderUpdates() {
+	for {
+		select {
+		case order := <-b.orderUpdates:
+			b.handleSingleOrderUpdate(&order)
+		case <-b.done:
+			return
+		}
 	}
 }
 
+// currentPosition returns the position of symbol after the given order was
+// filled, preferring the pushed position over polling the REST api
+func (b *Bot) currentPosition(order *api.Order) (*api.Position, error) {
+	if b.ws == nil {
+		return b.client.GetPosition(order.InstId)
+	}
+	since := b.clock.Now()
+	if uTime, err := strconv.ParseInt(order.UTime, 10, 64); err == nil {
+		since = time.UnixMilli(uTime)
+	}
+	position, err := b.ws.WaitForPositionUpdate(order.InstId, since, positionUpdateTimeout)
+	if err == nil {
+		return position, nil
+	}
+	log.Printf("Falling back to polling the position: %v", err)
+	return b.client.GetPosition(order.InstId)
+}
+
 func (b *Bot) handleSingleOrderUpdate(order *api.Order) {
-	// ToDo(ME-07.02.25): Handle cancellation
 	log.Print("Handling order update")
-	process, exists := b.tradingProcesses[order.InstId]
+	b.risk.invalidate()
+	process, exists := b.tradingProcess(order.InstId)
 	if !exists {
 		log.Printf("Received order update for unknown symbol: %s", order.InstId)
 		return
@@ -265,76 +482,166 @@ func (b *Bot) handleSingleOrderUpdate(order *api.Order) {
 
 	process.mu.Lock()
 	defer process.mu.Unlock()
+	if err := process.Strategy.OnOrderUpdate(process.ctx, *order); err != nil {
+		log.Printf("Failed to handle order update of %s: %v", order.InstId, err)
+	}
+}
 
-	// Handle filled buy orders
-	price, err := strconv.ParseFloat(order.Price, 64)
-	if err != nil {
-		log.Printf("Failed to parse order price: %v", err)
+// HandlePrice passes the latest price of symbol to its strategy
+func (b *Bot) HandlePrice(symbol string, price float64) {
+	process, exists := b.tradingProcess(symbol)
+	if !exists {
 		return
 	}
-	log.Printf("Dealing with order with id %s, status %s and side %s", order.OrderId, order.Status, order.Side)
-	if !process.OrderWithIdExists(order.OrderId) {
-		log.Printf("Order with id %s is not in configured orders for trading process with symbol %s", order.OrderId, order.InstId)
+
+	process.mu.Lock()
+	defer process.mu.Unlock()
+	if err := process.Strategy.OnPrice(process.ctx, price); err != nil {
+		log.Printf("Failed to handle price of %s: %v", symbol, err)
+	}
+}
+
+// HandleTimer calls OnTimer of all strategies if the timer interval passed
+// since the last call. Simulations call it after every step.
+func (b *Bot) HandleTimer(now time.Time) {
+	b.mu.Lock()
+	if !b.lastTimer.IsZero() && now.Sub(b.lastTimer) < timerInterval {
+		b.mu.Unlock()
 		return
 	}
-	if order.Status == "filled" && order.Side == "buy" {
-		log.Print("Buy order filled, waiting shortly to ensure the position is updated...")
-		time.Sleep(3 * time.Second) // Wait for position to be updated
-		position, err := b.client.GetPosition(order.InstId)
-		if err != nil || position == nil {
-			log.Printf("Failed to get position: %v", err)
-			return
-		}
-		if previousSellOrder := process.SellOrder; previousSellOrder != nil {
-			log.Printf("Attempting to cancel existing sell order %s for %s (price: %2.f)", previousSellOrder.OrderId, order.InstId, previousSellOrder.CoinPrice)
-			err := b.client.CancelOrder(order.InstId, previousSellOrder.OrderId)
-			if err != nil {
-				log.Printf("Failed to cancel previous sell order: %v", err)
-				return
-			}
-			log.Print("Successfully cancelled previous sell order")
+	b.lastTimer = now
+	b.mu.Unlock()
+	b.checkHalt()
+	// positions change with the price and may be changed by hand
+	b.risk.invalidate()
+
+	for _, tradingProcessConfig := range b.config.TradingProcesses {
+		process, exists := b.tradingProcess(tradingProcessConfig.Symbol)
+		if !exists {
+			continue
 		}
-		avgPrice, err := strconv.ParseFloat(position.OpenPriceAvg, 64)
-		if err != nil {
-			log.Printf("Failed to parse average price: %v", err)
-			return
+		process.mu.Lock()
+		if process.guard != nil {
+			process.guard.check(process.ctx, process.Strategy)
 		}
-		size, err := strconv.ParseFloat(position.Total, 64)
+		err := process.Strategy.OnTimer(process.ctx, now)
+		process.mu.Unlock()
 		if err != nil {
-			log.Printf("Failed to parse position size: %v", err)
-			return
+			log.Printf("Failed to handle timer of %s: %v", process.Symbol, err)
 		}
-		log.Printf("Current position for %s: average price %.2f", order.InstId, avgPrice)
-		sellPrice := avgPrice * (1 + process.SellTargetPercent/100)
-		log.Printf("Attempting to place sell order for %s at price %.2f", order.InstId, sellPrice)
-		// Place sell order
-		sellOrderId, err := b.client.PlaceLimitOrder(
-			order.InstId,
-			"sell",
-			sellPrice,
-			size,
-		)
-		if err != nil {
-			log.Printf("Failed to place sell order: %v", err)
-			return
+	}
+}
+
+// SetHaltFile makes the bot refuse to start while the kill switch halted
+// trading and stop once it is halted from outside, e.g. by "botcoin kill"
+func (b *Bot) SetHaltFile(path string) {
+	b.haltFile = path
+}
+
+// SetRepeatCycles makes ladders start a new cycle after their take-profit
+// instead of completing, so a backtest covers more than the first cycle
+func (b *Bot) SetRepeatCycles(repeat bool) {
+	b.repeatCycles = repeat
+}
+
+// Kill fires the kill switch: trading is halted persistently, the strategies
+// get no more events, and all orders are cancelled and positions closed. The
+// bot reports ErrHalted as failure once that is done.
+func (b *Bot) Kill(reason string) error {
+	var errs []error
+	if b.haltFile != "" {
+		if err := SaveHalt(b.haltFile, HaltState{Halted: true, Reason: reason, Time: b.clock.Now()}); err != nil {
+			errs = append(errs, fmt.Errorf("failed to save halt state: %w", err))
 		}
+	}
+	if err := b.flatten(reason); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// flatten halts the strategies, cancels all orders and closes all positions.
+// Only then ErrHalted is reported as failure, as the owner of the bot shuts
+// down on it.
+func (b *Bot) flatten(reason string) error {
+	log.Printf("Kill switch fired: %s", reason)
+	b.halt()
+	err := KillSwitch(b.client, b.symbols(), b.config.KillSwitch.CloseMethod)
+	failure := ErrHalted
+	if err != nil {
+		failure = fmt.Errorf("%w, kill switch incomplete, check the account: %w", ErrHalted, err)
+	}
+	select {
+	case b.failures <- failure:
+	default:
+	}
+	return err
+}
 
-		log.Printf("Placed sell order %s for %s at price %.2f", sellOrderId, order.InstId, sellPrice)
-		// Update order tracking
-		sellOrder := &SellOrder{
-			OrderId:     sellOrderId,
-			CoinPrice:   sellPrice,
-			OrderAmount: size,
+// halt stops dispatching events to the strategies and waits for the ones in
+// progress
+func (b *Bot) halt() {
+	b.mu.Lock()
+	if b.halted {
+		b.mu.Unlock()
+		return
+	}
+	b.halted = true
+	processes := make([]*TradingProcess, 0, len(b.tradingProcesses))
+	for _, process := range b.tradingProcesses {
+		processes = append(processes, process)
+	}
+	b.mu.Unlock()
+
+	for _, process := range processes {
+		process.mu.Lock()
+		process.mu.Unlock()
+	}
+}
+
+func (b *Bot) symbols() []string {
+	symbols := make([]string, 0, len(b.config.TradingProcesses))
+	for _, process := range b.config.TradingProcesses {
+		symbols = append(symbols, process.Symbol)
+	}
+	return symbols
+}
+
+// checkHalt fires the kill switch once trading was halted from outside
+func (b *Bot) checkHalt() {
+	if b.haltFile == "" {
+		return
+	}
+	b.mu.Lock()
+	halted := b.halted
+	b.mu.Unlock()
+	if halted {
+		return
+	}
+	state, err := LoadHalt(b.haltFile)
+	if err != nil {
+		log.Printf("Failed to check halt state: %v", err)
+		return
+	}
+	if state.Halted {
+		if err := b.flatten(state.Reason); err != nil {
+			log.Printf("Kill switch failed: %v", err)
 		}
-		process.SellOrder = sellOrder
-		log.Printf("Updated sell order in order process")
 	}
+}
 
-	// Handle filled sell orders
-	if order.Status == "filled" && order.Side == "sell" {
-		log.Printf("Sell order %s for %s filled at price %.2f filled", order.OrderId, order.InstId, price)
-		// Remove the completed order process
-		delete(b.tradingProcesses, order.InstId)
-		log.Printf("Trading process for %s completed!", order.InstId)
+func (b *Bot) runTimers() {
+	ticker := b.clock.NewTicker(timerInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C():
+			if b.recorder != nil {
+				b.recorder.RecordTimer(now)
+			}
+			b.HandleTimer(now)
+		case <-b.done:
+			return
+		}
 	}
 }
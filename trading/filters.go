@@ -0,0 +1,166 @@
+package trading
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"botcoin/api"
+	"botcoin/config"
+	"botcoin/indicators"
+)
+
+// entryFilter is an entry filter of a trading process with defaults applied
+type entryFilter struct {
+	config.EntryFilterConfig
+	interval time.Duration
+}
+
+func newEntryFilter(cfg config.EntryFilterConfig) (entryFilter, error) {
+	switch cfg.Indicator {
+	case "sma", "ema", "rsi", "atr", "vwap":
+		if cfg.Period == 0 {
+			cfg.Period = 14
+		}
+	case "bollinger_lower", "bollinger_middle", "bollinger_upper":
+		if cfg.Period == 0 {
+			cfg.Period = 20
+		}
+		if cfg.StdDev == 0 {
+			cfg.StdDev = 2
+		}
+	default:
+		return entryFilter{}, fmt.Errorf("unknown entry filter indicator %q", cfg.Indicator)
+	}
+	if cfg.Period < 1 {
+		return entryFilter{}, fmt.Errorf("invalid period %d of %s entry filter", cfg.Period, cfg.Indicator)
+	}
+	if cfg.Granularity == "" {
+		cfg.Granularity = "1H"
+	}
+	interval, err := api.GranularityDuration(cfg.Granularity)
+	if err != nil {
+		return entryFilter{}, err
+	}
+	conditions := 0
+	if cfg.Below != nil {
+		conditions++
+	}
+	if cfg.Above != nil {
+		conditions++
+	}
+	switch cfg.Price {
+	case "":
+	case "below", "above":
+		conditions++
+	default:
+		return entryFilter{}, fmt.Errorf("price of %s entry filter must be below or above, got %q", cfg.Indicator, cfg.Price)
+	}
+	if conditions == 0 {
+		return entryFilter{}, fmt.Errorf("%s entry filter needs below, above or price", cfg.Indicator)
+	}
+	return entryFilter{EntryFilterConfig: cfg, interval: interval}, nil
+}
+
+func newEntryFilters(configs []config.EntryFilterConfig) ([]entryFilter, error) {
+	filters := make([]entryFilter, 0, len(configs))
+	for _, cfg := range configs {
+		filter, err := newEntryFilter(cfg)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// lookback is the number of candles the indicator is computed from. Smoothed
+// indicators get more candles than they need to settle.
+func (f entryFilter) lookback() int {
+	switch f.Indicator {
+	case "ema", "rsi", "atr":
+		return 3*f.Period + 1
+	}
+	return f.Period
+}
+
+func (f entryFilter) indicator() indicators.Indicator {
+	switch f.Indicator {
+	case "sma":
+		return indicators.NewSMA(f.Period)
+	case "ema":
+		return indicators.NewEMA(f.Period)
+	case "rsi":
+		return indicators.NewRSI(f.Period)
+	case "atr":
+		return indicators.NewATR(f.Period)
+	case "vwap":
+		return indicators.NewVWAP(f.Period)
+	}
+	return indicators.NewBollinger(f.Period, f.StdDev)
+}
+
+func (f entryFilter) value(candles []api.Candle) (float64, error) {
+	indicator := f.indicator()
+	value, err := indicators.Compute(indicator, candles)
+	if err != nil {
+		return 0, err
+	}
+	if bands, ok := indicator.(*indicators.Bollinger); ok {
+		switch f.Indicator {
+		case "bollinger_lower":
+			return bands.Lower(), nil
+		case "bollinger_upper":
+			return bands.Upper(), nil
+		}
+	}
+	return value, nil
+}
+
+// String describes the filter for logs, e.g. "rsi(14, 1H)"
+func (f entryFilter) String() string {
+	return fmt.Sprintf("%s(%d, %s)", f.Indicator, f.Period, f.Granularity)
+}
+
+// passes evaluates the filter with the latest closed candles
+func (f entryFilter) passes(ctx *Context, price float64) (bool, error) {
+	candles, err := ctx.Candles(f.Granularity, f.lookback())
+	if err != nil {
+		return false, fmt.Errorf("failed to get candles for %s: %w", ctx.Symbol, err)
+	}
+	value, err := f.value(candles)
+	if err != nil {
+		return false, fmt.Errorf("failed to compute %s for %s: %w", f, ctx.Symbol, err)
+	}
+	if f.Below != nil && value >= *f.Below {
+		log.Printf("Entry filter %s of %s is %.2f, not below %.2f", f, ctx.Symbol, value, *f.Below)
+		return false, nil
+	}
+	if f.Above != nil && value <= *f.Above {
+		log.Printf("Entry filter %s of %s is %.2f, not above %.2f", f, ctx.Symbol, value, *f.Above)
+		return false, nil
+	}
+	if f.Price == "below" && price >= value || f.Price == "above" && price <= value {
+		log.Printf("Price %.2f of %s is not %s %s %.2f", price, ctx.Symbol, f.Price, f, value)
+		return false, nil
+	}
+	return true, nil
+}
+
+// entryFiltersPass reports whether all filters pass at the current price
+func entryFiltersPass(ctx *Context, filters []entryFilter) (bool, error) {
+	if len(filters) == 0 {
+		return true, nil
+	}
+	price, err := ctx.CurrentPrice()
+	if err != nil {
+		return false, fmt.Errorf("failed to get current price for %s: %w", ctx.Symbol, err)
+	}
+	for _, filter := range filters {
+		passes, err := filter.passes(ctx, price)
+		if err != nil || !passes {
+			return false, err
+		}
+	}
+	return true, nil
+}
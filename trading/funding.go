@@ -0,0 +1,125 @@
+package trading
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"botcoin/api"
+)
+
+// fundingDelays reports whether the funding rate is too high to start a new
+// cycle
+func (l *Ladder) fundingDelays(ctx *Context) (bool, error) {
+	funding := l.params.Funding
+	if funding == nil || funding.DelayAboveRate == nil {
+		return false, nil
+	}
+	rate, err := ctx.FundingRate()
+	if err != nil {
+		return false, err
+	}
+	if rate <= *funding.DelayAboveRate {
+		return false, nil
+	}
+	log.Printf("Funding rate %.4f%% of %s is above %.4f%%", rate*100, ctx.Symbol, *funding.DelayAboveRate*100)
+	return true, nil
+}
+
+// sellTargetPercent returns the take-profit above the average entry price,
+// raised while the funding rate is high
+func (l *Ladder) sellTargetPercent(ctx *Context) float64 {
+	target := l.params.SellTargetPercent
+	funding := l.params.Funding
+	if funding == nil || funding.RaiseTakeProfitAboveRate == nil {
+		return target
+	}
+	rate, err := ctx.FundingRate()
+	if err != nil {
+		log.Printf("Failed to get funding rate for %s, keeping the take-profit: %v", ctx.Symbol, err)
+		return target
+	}
+	if rate > *funding.RaiseTakeProfitAboveRate {
+		log.Printf("Funding rate %.4f%% of %s is high, raising the take-profit by %.2f%%", rate*100, ctx.Symbol, funding.TakeProfitRaisePercent)
+		target += funding.TakeProfitRaisePercent
+	}
+	return target
+}
+
+// cycleAccounting adds up the PnL of a ladder cycle including fees and
+// funding. Amounts paid are positive.
+type cycleAccounting struct {
+	entryPrice  float64
+	fees        float64
+	funding     float64
+	nextFunding time.Time
+}
+
+// orderFee returns the fee paid for an order
+func orderFee(order api.Order) float64 {
+	if fee, err := strconv.ParseFloat(order.FillFee, 64); err == nil {
+		return -fee
+	}
+	var paid float64
+	for _, detail := range order.FeeDetail {
+		if fee, err := strconv.ParseFloat(detail.Fee, 64); err == nil {
+			paid -= fee
+		}
+	}
+	return paid
+}
+
+func (a *cycleAccounting) addBuy(order api.Order, position *api.Position) {
+	a.fees += orderFee(order)
+	if avgPrice, err := strconv.ParseFloat(position.OpenPriceAvg, 64); err == nil {
+		a.entryPrice = avgPrice
+	}
+	a.setFunding(position)
+}
+
+// setFunding takes the funding paid for the position since it was opened
+func (a *cycleAccounting) setFunding(position *api.Position) {
+	if funding, err := strconv.ParseFloat(position.TotalFee, 64); err == nil {
+		a.funding = -funding
+	}
+}
+
+// refreshFunding updates the funding paid once a settlement passed
+func (a *cycleAccounting) refreshFunding(ctx *Context, now time.Time) {
+	if !a.nextFunding.IsZero() && now.Before(a.nextFunding) {
+		return
+	}
+	if !a.nextFunding.IsZero() {
+		position, err := ctx.Position()
+		if err != nil {
+			log.Printf("Failed to get position of %s for funding: %v", ctx.Symbol, err)
+			return
+		}
+		a.setFunding(position)
+	}
+	next, err := ctx.NextFundingTime()
+	if err != nil {
+		log.Printf("Failed to get next funding time of %s: %v", ctx.Symbol, err)
+		return
+	}
+	a.nextFunding = next
+}
+
+// close logs the PnL of the cycle once its sell order filled
+func (a *cycleAccounting) close(symbol string, order api.Order) {
+	price, err := strconv.ParseFloat(order.PriceAvg, 64)
+	if err != nil {
+		price, _ = strconv.ParseFloat(order.Price, 64)
+	}
+	size, err := strconv.ParseFloat(order.BaseVolume, 64)
+	if err != nil {
+		size, _ = strconv.ParseFloat(order.Size, 64)
+	}
+	if a.entryPrice == 0 {
+		log.Printf("Entry price of the cycle of %s unknown, no PnL", symbol)
+		return
+	}
+	a.fees += orderFee(order)
+	pnl := (price - a.entryPrice) * size
+	log.Printf("Cycle of %s closed: PnL %.2f, fees %.2f, funding %.2f, net %.2f", symbol, pnl, a.fees, a.funding, pnl-a.fees-a.funding)
+}
@@ -0,0 +1,375 @@
+package trading
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"botcoin/api"
+	"botcoin/config"
+)
+
+func init() {
+	RegisterStrategy("grid", newGrid)
+}
+
+// GridParams configure the grid strategy
+type GridParams struct {
+	LowerPrice float64 `json:"lower_price"`
+	UpperPrice float64 `json:"upper_price"`
+	GridLines  int     `json:"grid_lines"` // number of price levels including both bounds
+	Spacing    string  `json:"spacing"`    // "arithmetic" (default, equal distance) or "geometric" (equal ratio)
+	Size       float64 `json:"size"`       // order size per grid line in the base coin
+	StateFile  string  `json:"state_file"` // optional, persists the grid orders across restarts of the live bot
+}
+
+// gridOrder is the order resting on a grid line. An empty OrderId marks an
+// order that still has to be placed, e.g. because placing it failed.
+type gridOrder struct {
+	OrderId string  `json:"order_id"`
+	Side    string  `json:"side"`
+	Price   float64 `json:"price"`
+}
+
+type gridState struct {
+	Symbol  string            `json:"symbol"`
+	Updated time.Time         `json:"updated"`
+	Orders  map[int]gridOrder `json:"orders"` // by grid line
+}
+
+// Grid trades a fixed price range: buys rest on the grid lines below the
+// price, every filled buy places a sell one line above and every filled sell
+// a buy one line below. It only ever holds long positions.
+type Grid struct {
+	params    GridParams
+	prices    []float64
+	orders    map[int]gridOrder // by grid line
+	stateFile string            // none in backtests, replays and paper trading
+}
+
+func newGrid(cfg config.TradingProcessConfig) (Strategy, error) {
+	var params GridParams
+	if len(cfg.Params) > 0 {
+		if err := json.Unmarshal(cfg.Params, &params); err != nil {
+			return nil, fmt.Errorf("failed to parse params: %w", err)
+		}
+	}
+	prices, err := gridPrices(params)
+	if err != nil {
+		return nil, err
+	}
+	if params.Size <= 0 {
+		return nil, errors.New("size must be positive")
+	}
+	return &Grid{params: params, prices: prices, orders: make(map[int]gridOrder)}, nil
+}
+
+func gridPrices(params GridParams) ([]float64, error) {
+	if params.LowerPrice <= 0 || params.UpperPrice <= params.LowerPrice {
+		return nil, fmt.Errorf("invalid price range %v - %v", params.LowerPrice, params.UpperPrice)
+	}
+	if params.GridLines < 2 {
+		return nil, fmt.Errorf("at least 2 grid lines required, got %d", params.GridLines)
+	}
+	prices := make([]float64, params.GridLines)
+	steps := float64(params.GridLines - 1)
+	for i := range prices {
+		switch params.Spacing {
+		case "", "arithmetic":
+			prices[i] = params.LowerPrice + float64(i)*(params.UpperPrice-params.LowerPrice)/steps
+		case "geometric":
+			prices[i] = params.LowerPrice * math.Pow(params.UpperPrice/params.LowerPrice, float64(i)/steps)
+		default:
+			return nil, fmt.Errorf("unknown grid spacing: %s", params.Spacing)
+		}
+	}
+	return prices, nil
+}
+
+// lineAt returns the grid line of price, tolerating the rounding of order prices
+func (g *Grid) lineAt(price float64) (int, bool) {
+	i := sort.SearchFloat64s(g.prices, price)
+	best := -1
+	for _, candidate := range []int{i - 1, i} {
+		if candidate < 0 || candidate >= len(g.prices) {
+			continue
+		}
+		if best < 0 || math.Abs(g.prices[candidate]-price) < math.Abs(g.prices[best]-price) {
+			best = candidate
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	tolerance := (g.prices[1] - g.prices[0]) / 4
+	return best, math.Abs(g.prices[best]-price) <= tolerance
+}
+
+func (g *Grid) lineWithOrder(orderId string) (int, bool) {
+	for line, order := range g.orders {
+		if order.OrderId == orderId {
+			return line, true
+		}
+	}
+	return 0, false
+}
+
+// OnStart reconciles the persisted grid with the open orders of the exchange.
+// Persisted orders that are no longer open are looked up in the order
+// history: fills are handled as if they were pushed, cancelled orders are
+// placed again. Open orders on grid lines are adopted. Without any known
+// order the grid is set up from scratch.
+func (g *Grid) OnStart(ctx *Context, openOrders []api.Order) error {
+	state, err := g.loadState()
+	if err != nil {
+		return err
+	}
+
+	open := make(map[string]api.Order, len(openOrders))
+	for _, order := range openOrders {
+		open[order.OrderId] = order
+	}
+
+	var missing []int
+	for line, order := range state.Orders {
+		if line < 0 || line >= len(g.prices) {
+			log.Printf("Ignoring persisted grid order %s of %s on unknown line %d", order.OrderId, ctx.Symbol, line)
+			continue
+		}
+		if _, ok := open[order.OrderId]; ok || order.OrderId == "" {
+			g.orders[line] = order
+			continue
+		}
+		missing = append(missing, line)
+	}
+	if len(missing) > 0 {
+		if err := g.reconcileMissing(ctx, state, missing); err != nil {
+			return err
+		}
+	}
+
+	for _, order := range openOrders {
+		if _, known := g.lineWithOrder(order.OrderId); known {
+			continue
+		}
+		price, err := strconv.ParseFloat(order.Price, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse order price: %w", err)
+		}
+		line, ok := g.lineAt(price)
+		if _, taken := g.orders[line]; !ok || taken {
+			log.Printf("Open order %s of %s at %.2f is not part of the grid", order.OrderId, ctx.Symbol, price)
+			continue
+		}
+		log.Printf("Adopting open %s order %s of %s on grid line %d", order.Side, order.OrderId, ctx.Symbol, line)
+		g.orders[line] = gridOrder{OrderId: order.OrderId, Side: order.Side, Price: g.prices[line]}
+	}
+
+	if len(g.orders) == 0 {
+		if err := g.initialize(ctx); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("Synced grid of %s with %d orders", ctx.Symbol, len(g.orders))
+	}
+	g.placeMissing(ctx)
+	g.saveState(ctx)
+	return nil
+}
+
+// reconcileMissing handles the persisted orders that were filled or
+// cancelled while the bot was not running
+func (g *Grid) reconcileMissing(ctx *Context, state *gridState, lines []int) error {
+	history, err := ctx.FilledOrders(state.Updated.Add(-gapRecoveryMargin))
+	if err != nil {
+		return fmt.Errorf("failed to get filled orders: %w", err)
+	}
+	byId := make(map[string]api.Order, len(history))
+	for _, order := range history {
+		byId[order.OrderId] = order
+	}
+
+	sort.Ints(lines)
+	for _, line := range lines {
+		g.orders[line] = state.Orders[line]
+	}
+	for _, line := range lines {
+		order := state.Orders[line]
+		if historic, ok := byId[order.OrderId]; ok && historic.Status == "filled" {
+			log.Printf("Grid %s order %s of %s was filled while offline", order.Side, order.OrderId, ctx.Symbol)
+			g.handleFill(ctx, line)
+			continue
+		}
+		log.Printf("Grid %s order %s of %s is gone, placing it again", order.Side, order.OrderId, ctx.Symbol)
+		order.OrderId = ""
+		g.orders[line] = order
+	}
+	return nil
+}
+
+func (g *Grid) initialize(ctx *Context) error {
+	price, err := ctx.CurrentPrice()
+	if err != nil {
+		return fmt.Errorf("Failed to get current price for %s: %w", ctx.Symbol, err)
+	}
+	log.Printf("Initializing grid for %s with %d lines from %.2f to %.2f at price %.2f", ctx.Symbol, len(g.prices), g.prices[0], g.prices[len(g.prices)-1], price)
+	for line, linePrice := range g.prices {
+		if linePrice < price {
+			g.orders[line] = gridOrder{Side: "buy", Price: linePrice}
+		}
+	}
+	return nil
+}
+
+// placeMissing places the orders of all lines without an order id. While
+// buying is paused the buy lines wait for ResumeBuying.
+func (g *Grid) placeMissing(ctx *Context) {
+	lines := make([]int, 0, len(g.orders))
+	for line, order := range g.orders {
+		if order.OrderId == "" && !(order.Side == "buy" && ctx.BuyingPaused()) {
+			lines = append(lines, line)
+		}
+	}
+	sort.Ints(lines)
+	for _, line := range lines {
+		order := g.orders[line]
+		orderId, err := ctx.PlaceOrder(order.Side, order.Price, g.params.Size)
+		if err != nil {
+			log.Printf("Failed to place grid %s order for %s at %.2f: %v", order.Side, ctx.Symbol, order.Price, err)
+			continue
+		}
+		order.OrderId = orderId
+		g.orders[line] = order
+		log.Printf("Placed grid %s order %s for %s at price %.2f", order.Side, orderId, ctx.Symbol, order.Price)
+	}
+}
+
+// handleFill replaces the filled order of line with the opposite order one
+// line further
+func (g *Grid) handleFill(ctx *Context, line int) {
+	filled := g.orders[line]
+	delete(g.orders, line)
+
+	next, side := line+1, "sell"
+	if filled.Side == "sell" {
+		next, side = line-1, "buy"
+	}
+	if next < 0 || next >= len(g.prices) {
+		log.Printf("Grid %s order of %s filled at the edge of the grid", filled.Side, ctx.Symbol)
+		return
+	}
+	if existing, taken := g.orders[next]; taken {
+		log.Printf("Grid line %d of %s already has %s order %s", next, ctx.Symbol, existing.Side, existing.OrderId)
+		return
+	}
+	g.orders[next] = gridOrder{Side: side, Price: g.prices[next]}
+}
+
+func (g *Grid) OnOrderUpdate(ctx *Context, order api.Order) error {
+	line, ok := g.lineWithOrder(order.OrderId)
+	if !ok {
+		return nil
+	}
+	switch order.Status {
+	case "filled":
+		log.Printf("Grid %s order %s of %s filled at line %d", order.Side, order.OrderId, ctx.Symbol, line)
+		g.handleFill(ctx, line)
+		g.placeMissing(ctx)
+	case "canceled", "cancelled":
+		log.Printf("Grid %s order %s of %s was cancelled, removing it from the grid", order.Side, order.OrderId, ctx.Symbol)
+		delete(g.orders, line)
+	default:
+		return nil
+	}
+	g.saveState(ctx)
+	return nil
+}
+
+// PauseBuying cancels the resting buy orders, their lines stay part of the
+// grid and are placed again by ResumeBuying
+func (g *Grid) PauseBuying(ctx *Context) error {
+	var cancelErr error
+	for line, order := range g.orders {
+		if order.Side != "buy" || order.OrderId == "" {
+			continue
+		}
+		if err := ctx.CancelOrder(order.OrderId); err != nil {
+			cancelErr = fmt.Errorf("failed to cancel grid buy order %s: %w", order.OrderId, err)
+			continue
+		}
+		order.OrderId = ""
+		g.orders[line] = order
+	}
+	g.saveState(ctx)
+	return cancelErr
+}
+
+func (g *Grid) ResumeBuying(ctx *Context) error {
+	g.placeMissing(ctx)
+	g.saveState(ctx)
+	return nil
+}
+
+func (g *Grid) OnPrice(ctx *Context, price float64) error {
+	return nil
+}
+
+// OnTimer retries placing orders that failed before
+func (g *Grid) OnTimer(ctx *Context, now time.Time) error {
+	for _, order := range g.orders {
+		if order.OrderId == "" && !(order.Side == "buy" && ctx.BuyingPaused()) {
+			g.placeMissing(ctx)
+			g.saveState(ctx)
+			break
+		}
+	}
+	return nil
+}
+
+// persist makes the grid load and save its state_file
+func (g *Grid) persist() {
+	g.stateFile = g.params.StateFile
+}
+
+func (g *Grid) loadState() (*gridState, error) {
+	state := &gridState{}
+	if g.stateFile == "" {
+		return state, nil
+	}
+	data, err := os.ReadFile(g.stateFile)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read grid state: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse grid state %s: %w", g.stateFile, err)
+	}
+	return state, nil
+}
+
+func (g *Grid) saveState(ctx *Context) {
+	if g.stateFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(gridState{Symbol: ctx.Symbol, Updated: ctx.Now(), Orders: g.orders}, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode grid state of %s: %v", ctx.Symbol, err)
+		return
+	}
+	tmp := g.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("Failed to save grid state of %s: %v", ctx.Symbol, err)
+		return
+	}
+	if err := os.Rename(tmp, g.stateFile); err != nil {
+		log.Printf("Failed to save grid state of %s: %v", ctx.Symbol, err)
+	}
+}
@@ -0,0 +1,143 @@
+package trading
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"botcoin/api"
+	"botcoin/config"
+)
+
+var ErrHalted = errors.New("trading is halted by the kill switch")
+
+// HaltState is persisted by the kill switch and keeps the bot from trading
+// until it is cleared
+type HaltState struct {
+	Halted bool      `json:"halted"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"`
+}
+
+// HaltFile returns the configured halt file
+func HaltFile(cfg config.KillSwitchConfig) string {
+	if cfg.HaltFile == "" {
+		return "halted.json"
+	}
+	return cfg.HaltFile
+}
+
+// PaperHaltFile returns the halt file of the paper trader, the halt file of
+// the live bot with a "paper_" prefix, so halting one doesn't stop the other
+func PaperHaltFile(cfg config.KillSwitchConfig) string {
+	path := HaltFile(cfg)
+	return filepath.Join(filepath.Dir(path), "paper_"+filepath.Base(path))
+}
+
+// LoadHalt reads the halt state, a missing file means trading isn't halted
+func LoadHalt(path string) (HaltState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return HaltState{}, nil
+	}
+	if err != nil {
+		return HaltState{}, fmt.Errorf("failed to read halt state: %w", err)
+	}
+	var state HaltState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return HaltState{}, fmt.Errorf("failed to parse halt state: %w", err)
+	}
+	return state, nil
+}
+
+// SaveHalt persists the halt state
+func SaveHalt(path string, state HaltState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ClearHalt allows trading again
+func ClearHalt(path string) error {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to clear halt state: %w", err)
+	}
+	return nil
+}
+
+// KillSwitch cancels the pending orders and closes the positions of all
+// symbols, with the flash close endpoint or reduce only market orders. Both
+// sides of a hedge mode position are closed with the flash close endpoint, as
+// reduce only orders apply to one-way mode only. It keeps going on errors and
+// returns all of them.
+func KillSwitch(client Exchange, symbols []string, closeMethod string) error {
+	if closeMethod != "" && closeMethod != "flash_close" && closeMethod != "market" {
+		return fmt.Errorf("unknown close method %q", closeMethod)
+	}
+	var errs []error
+	for _, symbol := range symbols {
+		orders, err := client.GetPendingOrders(symbol)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get pending orders of %s: %w", symbol, err))
+		}
+		for _, order := range orders {
+			if err := client.CancelOrder(symbol, order.OrderId); err != nil {
+				errs = append(errs, fmt.Errorf("failed to cancel order %s of %s: %w", order.OrderId, symbol, err))
+				continue
+			}
+			log.Printf("Kill switch cancelled %s order %s of %s", order.Side, order.OrderId, symbol)
+		}
+
+		positions, err := client.GetPositions(symbol)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get positions of %s: %w", symbol, err))
+			continue
+		}
+		for _, position := range positions {
+			if err := closePosition(client, symbol, position, closeMethod); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func closePosition(client Exchange, symbol string, position api.Position, closeMethod string) error {
+	size, err := strconv.ParseFloat(position.Total, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse size of %s position of %s: %w", position.HoldSide, symbol, err)
+	}
+	if size <= 0 {
+		return nil
+	}
+	if closeMethod == "market" && position.PosMode != "hedge_mode" {
+		side := "sell"
+		if position.HoldSide == "short" {
+			side = "buy"
+		}
+		_, err = client.PlaceMarketOrder(symbol, side, size, true)
+	} else {
+		err = client.FlashClose(symbol, position.HoldSide)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to close %s position of %s: %w", position.HoldSide, symbol, err)
+	}
+	log.Printf("Kill switch closed %s position of %.6f %s", position.HoldSide, size, symbol)
+	return nil
+}
@@ -0,0 +1,118 @@
+package trading
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"botcoin/api"
+	"botcoin/config"
+)
+
+func TestKillSwitch(t *testing.T) {
+	hedge := []api.Position{
+		{HoldSide: "long", Total: "2", PosMode: "hedge_mode"},
+		{HoldSide: "short", Total: "1", PosMode: "hedge_mode"},
+	}
+	tests := []struct {
+		name        string
+		exchange    stubExchange
+		closeMethod string
+		sent        []string
+		errs        []string // parts of the returned error
+	}{
+		{"market close", stubExchange{
+			pending:   map[string][]api.Order{"BTCUSDT": {buyOrder("1", "90", "1")}},
+			positions: map[string][]api.Position{"BTCUSDT": long("2", "100")},
+		}, "market", []string{"cancel BTCUSDT 1", "market BTCUSDT sell 2 reduce only true"}, nil},
+		{"flash close", stubExchange{
+			positions: map[string][]api.Position{"BTCUSDT": long("2", "100")},
+		}, "flash_close", []string{"flash close BTCUSDT long"}, nil},
+		{"both hedge sides closed", stubExchange{
+			positions: map[string][]api.Position{"BTCUSDT": hedge},
+		}, "market", []string{"flash close BTCUSDT long", "flash close BTCUSDT short"}, nil},
+		{"position error collected", stubExchange{
+			pending:     map[string][]api.Order{"BTCUSDT": {buyOrder("1", "90", "1")}},
+			positionErr: map[string]error{"BTCUSDT": errors.New("timeout")},
+			positions:   map[string][]api.Position{"ETHUSDT": long("3", "10")},
+		}, "market", []string{"cancel BTCUSDT 1", "market ETHUSDT sell 3 reduce only true"},
+			[]string{"failed to get positions of BTCUSDT: timeout"}},
+		{"parse error collected", stubExchange{
+			positions: map[string][]api.Position{"BTCUSDT": {
+				{HoldSide: "long", Total: "invalid", PosMode: "hedge_mode"},
+				{HoldSide: "short", Total: "1", PosMode: "hedge_mode"},
+			}},
+		}, "market", []string{"flash close BTCUSDT short"},
+			[]string{"failed to parse size of long position of BTCUSDT"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := KillSwitch(&tt.exchange, []string{"BTCUSDT", "ETHUSDT"}, tt.closeMethod)
+			if !reflect.DeepEqual(tt.exchange.sent, tt.sent) {
+				t.Errorf("sent %q, want %q", tt.exchange.sent, tt.sent)
+			}
+			if len(tt.errs) == 0 && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, part := range tt.errs {
+				if err == nil || !strings.Contains(err.Error(), part) {
+					t.Errorf("err = %v, want it to contain %q", err, part)
+				}
+			}
+		})
+	}
+}
+
+func TestKillSwitchUnknownCloseMethod(t *testing.T) {
+	exchange := &stubExchange{positions: map[string][]api.Position{"BTCUSDT": long("2", "100")}}
+	if err := KillSwitch(exchange, []string{"BTCUSDT"}, "limit"); err == nil {
+		t.Error("unknown close method accepted")
+	}
+	if len(exchange.sent) != 0 {
+		t.Errorf("sent %q with an unknown close method", exchange.sent)
+	}
+}
+
+func TestHaltFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		haltFile string
+		live     string
+		paper    string
+	}{
+		{"defaults", "", "halted.json", "paper_halted.json"},
+		{"configured", "state/halt.json", "state/halt.json", filepath.Join("state", "paper_halt.json")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.KillSwitchConfig{HaltFile: tt.haltFile}
+			if got := HaltFile(cfg); got != tt.live {
+				t.Errorf("halt file = %s, want %s", got, tt.live)
+			}
+			if got := PaperHaltFile(cfg); got != tt.paper {
+				t.Errorf("paper halt file = %s, want %s", got, tt.paper)
+			}
+		})
+	}
+}
+
+func TestSaveAndLoadHalt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "halted.json")
+	if state, err := LoadHalt(path); err != nil || state.Halted {
+		t.Fatalf("state of a missing file = %+v, %v, want not halted", state, err)
+	}
+	if err := SaveHalt(path, HaltState{Halted: true, Reason: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := LoadHalt(path); err != nil || !state.Halted || state.Reason != "test" {
+		t.Errorf("state = %+v, %v, want halted for test", state, err)
+	}
+	if err := ClearHalt(path); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := LoadHalt(path); err != nil || state.Halted {
+		t.Errorf("state after clearing = %+v, %v, want not halted", state, err)
+	}
+}
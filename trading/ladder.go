@@ -0,0 +1,671 @@
+package trading
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"botcoin/api"
+	"botcoin/config"
+	"botcoin/indicators"
+)
+
+func init() {
+	RegisterStrategy("ladder", newLadder)
+}
+
+// LadderParams configure the ladder strategy. They default to the fields of
+// the trading process config of the same names.
+type LadderParams struct {
+	SellTargetPercent float64                       `json:"sell_target_percent"`
+	BuyOrders         []config.BuyOrderConfig       `json:"buy_orders"`
+	LadderGenerator   *config.LadderGeneratorConfig `json:"ladder_generator"`
+	Volatility        *config.VolatilityConfig      `json:"volatility"`
+	EntryFilters      []config.EntryFilterConfig    `json:"entry_filters"`
+	Repeg             *config.RepegConfig           `json:"repeg"`
+	Funding           *config.FundingConfig         `json:"funding"`
+}
+
+// ladderParams resolves the parameters of a trading process, expanding a
+// ladder generator into buy orders
+func ladderParams(cfg config.TradingProcessConfig) (LadderParams, error) {
+	params := LadderParams{
+		SellTargetPercent: cfg.SellTargetPercent,
+		BuyOrders:         cfg.BuyOrders,
+		LadderGenerator:   cfg.LadderGenerator,
+		Volatility:        cfg.Volatility,
+		EntryFilters:      cfg.EntryFilters,
+		Repeg:             cfg.Repeg,
+		Funding:           cfg.Funding,
+	}
+	if len(cfg.Params) > 0 {
+		if err := json.Unmarshal(cfg.Params, &params); err != nil {
+			return params, fmt.Errorf("failed to parse params: %w", err)
+		}
+	}
+	if params.LadderGenerator != nil {
+		if len(params.BuyOrders) > 0 {
+			return params, fmt.Errorf("either buy_orders or ladder_generator can be configured, not both")
+		}
+		buyOrders, err := params.LadderGenerator.BuyOrders()
+		if err != nil {
+			return params, err
+		}
+		params.BuyOrders = buyOrders
+	}
+	if params.Volatility != nil {
+		volatility := *params.Volatility
+		if volatility.Measure == "" {
+			volatility.Measure = "atr"
+		}
+		if volatility.Measure != "atr" && volatility.Measure != "stddev" {
+			return params, fmt.Errorf("unknown volatility measure %q", volatility.Measure)
+		}
+		if volatility.Granularity == "" {
+			volatility.Granularity = "1H"
+		}
+		if _, err := api.GranularityDuration(volatility.Granularity); err != nil {
+			return params, err
+		}
+		if volatility.Period == 0 {
+			volatility.Period = 14
+		}
+		params.Volatility = &volatility
+	}
+	if params.Repeg != nil && (params.Repeg.DriftPercent < 0 || params.Repeg.TimeoutMinutes < 0) {
+		return params, fmt.Errorf("repeg drift and timeout must not be negative")
+	}
+	for _, buyOrder := range params.BuyOrders {
+		if buyOrder.VolatilityMultiple > 0 && params.Volatility == nil {
+			return params, fmt.Errorf("buy orders with a volatility_multiple need a volatility configuration")
+		}
+	}
+	return params, nil
+}
+
+// usesVolatility reports whether any buy order is spaced by volatility
+func (p LadderParams) usesVolatility() bool {
+	for _, buyOrder := range p.BuyOrders {
+		if buyOrder.VolatilityMultiple > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// belowPercent returns the distance of a buy order below the current price,
+// or 0 for orders at a fixed price
+func (p LadderParams) belowPercent(buyOrder config.BuyOrderConfig, volatilityPercent float64) float64 {
+	if buyOrder.VolatilityMultiple <= 0 {
+		return buyOrder.CoinPriceBelowPercent
+	}
+	offset := buyOrder.VolatilityMultiple * volatilityPercent
+	if p.Volatility.MinOffsetPercent > 0 {
+		offset = math.Max(offset, p.Volatility.MinOffsetPercent)
+	}
+	if p.Volatility.MaxOffsetPercent > 0 {
+		offset = math.Min(offset, p.Volatility.MaxOffsetPercent)
+	}
+	return offset
+}
+
+// LadderVolatility returns the volatility configuration, with defaults
+// applied, of a ladder spaced by volatility and nil otherwise
+func LadderVolatility(cfg config.TradingProcessConfig) (*config.VolatilityConfig, error) {
+	params, err := ladderParams(cfg)
+	if err != nil || !params.usesVolatility() {
+		return nil, err
+	}
+	return params.Volatility, nil
+}
+
+// LadderWarmup returns how much candle history the ladder of a trading
+// process needs before its first cycle to measure volatility and evaluate
+// entry filters
+func LadderWarmup(cfg config.TradingProcessConfig) time.Duration {
+	var warmup time.Duration
+	if volatility, err := LadderVolatility(cfg); err == nil && volatility != nil {
+		interval, _ := api.GranularityDuration(volatility.Granularity)
+		warmup = time.Duration(volatility.Period+1) * interval
+	}
+	params, err := ladderParams(cfg)
+	if err != nil {
+		return warmup
+	}
+	filters, err := newEntryFilters(params.EntryFilters)
+	if err != nil {
+		return warmup
+	}
+	for _, filter := range filters {
+		warmup = max(warmup, time.Duration(filter.lookback())*filter.interval)
+	}
+	return warmup
+}
+
+// VolatilityPercent measures the volatility of candles as configured, in
+// percent of the last close
+func VolatilityPercent(volatility config.VolatilityConfig, candles []api.Candle) (float64, error) {
+	if volatility.Measure == "stddev" {
+		stddev, err := indicators.RealizedVolatility(candles, volatility.Period)
+		return stddev * 100, err
+	}
+	atr, err := indicators.ATR(candles, volatility.Period)
+	if err != nil {
+		return 0, err
+	}
+	return atr / candles[len(candles)-1].Close * 100, nil
+}
+
+// volatilityPercent measures the current volatility of the symbol, 0 if no
+// buy order is spaced by volatility
+func (l *Ladder) volatilityPercent(ctx *Context) (float64, error) {
+	if !l.params.usesVolatility() {
+		return 0, nil
+	}
+	candles, err := ctx.Candles(l.params.Volatility.Granularity, l.params.Volatility.Period+1)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get candles for %s: %w", ctx.Symbol, err)
+	}
+	volatility, err := VolatilityPercent(*l.params.Volatility, candles)
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure volatility of %s: %w", ctx.Symbol, err)
+	}
+	log.Printf("Volatility of %s is %.3f%% (%s, %d x %s)", ctx.Symbol, volatility,
+		l.params.Volatility.Measure, l.params.Volatility.Period, l.params.Volatility.Granularity)
+	return volatility, nil
+}
+
+// LadderLevel is one buy order of a planned ladder
+type LadderLevel struct {
+	BelowPercent     float64 // distance below the current price
+	Price            float64
+	Amount           float64 // in the quote coin
+	Size             float64 // in the base coin
+	CumulativeAmount float64
+	AveragePrice     float64 // average entry price once this and all previous levels filled
+	SellPrice        float64 // take-profit price at that point
+}
+
+// PlanLadder returns the buy orders the ladder strategy of a trading process
+// would place at the given current price and volatility in percent
+func PlanLadder(cfg config.TradingProcessConfig, currentPrice, volatilityPercent float64) ([]LadderLevel, error) {
+	params, err := ladderParams(cfg)
+	if err != nil {
+		return nil, err
+	}
+	levels := make([]LadderLevel, 0, len(params.BuyOrders))
+	var amount, size float64
+	for _, buyOrder := range params.BuyOrders {
+		price := buyOrder.CoinPrice
+		if belowPercent := params.belowPercent(buyOrder, volatilityPercent); belowPercent > 0 {
+			price = currentPrice * (1 - belowPercent/100)
+		}
+		if price <= 0 {
+			return nil, fmt.Errorf("invalid buy order price %.2f", price)
+		}
+		amount += buyOrder.OrderAmount
+		size += buyOrder.OrderAmount / price
+		levels = append(levels, LadderLevel{
+			BelowPercent:     (1 - price/currentPrice) * 100,
+			Price:            price,
+			Amount:           buyOrder.OrderAmount,
+			Size:             buyOrder.OrderAmount / price,
+			CumulativeAmount: amount,
+			AveragePrice:     amount / size,
+			SellPrice:        amount / size * (1 + params.SellTargetPercent/100),
+		})
+	}
+	return levels, nil
+}
+
+type BuyOrder struct {
+	OrderId     string
+	CoinPrice   float64
+	OrderAmount float64 // in the quote coin, the size is OrderAmount / CoinPrice
+	Filled      bool    // the fill has been handled, e.g. when replaying missed updates
+}
+
+type SellOrder struct {
+	OrderId     string
+	CoinPrice   float64
+	OrderAmount float64 // in the base coin
+}
+
+// Ladder places limit buy orders at configured prices and keeps a single
+// take-profit sell order for the whole position at its average entry price
+// plus SellTargetPercent, replaced after every buy fill
+type Ladder struct {
+	params    LadderParams
+	filters   []entryFilter
+	BuyOrders []BuyOrder
+	SellOrder *SellOrder
+	completed bool
+	waiting   bool // the entry filters didn't pass, retried on every timer
+
+	// price and time the buy orders of the cycle were placed at, to repeg
+	anchorPrice float64
+	anchoredAt  time.Time
+	accounting  cycleAccounting
+}
+
+func newLadder(cfg config.TradingProcessConfig) (Strategy, error) {
+	params, err := ladderParams(cfg)
+	if err != nil {
+		return nil, err
+	}
+	filters, err := newEntryFilters(params.EntryFilters)
+	if err != nil {
+		return nil, err
+	}
+	return &Ladder{params: params, filters: filters}, nil
+}
+
+func (l *Ladder) orderWithIdExists(orderId string) bool {
+	if l.SellOrder != nil && l.SellOrder.OrderId == orderId {
+		return true
+	}
+	return l.buyOrderWithId(orderId) != nil
+}
+
+func (l *Ladder) buyOrderWithId(orderId string) *BuyOrder {
+	for i := range l.BuyOrders {
+		if l.BuyOrders[i].OrderId == orderId {
+			return &l.BuyOrders[i]
+		}
+	}
+	return nil
+}
+
+func (l *Ladder) OnStart(ctx *Context, openOrders []api.Order) error {
+	synced, err := l.sync(ctx.Symbol, openOrders)
+	if err != nil {
+		return fmt.Errorf("failed to sync trading process: %w", err)
+	}
+	if synced {
+		log.Printf("Trading process for %s already initialized", ctx.Symbol)
+		return nil
+	}
+
+	if err := l.startCycle(ctx); err != nil {
+		return fmt.Errorf("failed to initialize trading process: %w", err)
+	}
+	return nil
+}
+
+// startCycle places the buy orders of a new cycle once the entry filters
+// pass, otherwise the ladder waits for them on the next timers
+func (l *Ladder) startCycle(ctx *Context) error {
+	l.BuyOrders = nil
+	l.SellOrder = nil
+	l.accounting = cycleAccounting{}
+	passes, err := entryFiltersPass(ctx, l.filters)
+	if err != nil {
+		return err
+	}
+	if passes {
+		delay, err := l.fundingDelays(ctx)
+		if err != nil {
+			return err
+		}
+		passes = !delay
+	}
+	if !passes {
+		if !l.waiting {
+			log.Printf("Waiting for the entry filters of %s to pass", ctx.Symbol)
+		}
+		l.waiting = true
+		return nil
+	}
+	l.waiting = false
+	if err := l.initialize(ctx); err != nil {
+		return err
+	}
+	if err := l.placeBuyOrders(ctx); err != nil {
+		log.Printf("Failed to place buy orders for %s: %v", ctx.Symbol, err)
+	}
+	return nil
+}
+
+// sync adopts the open orders of a previous run
+func (l *Ladder) sync(symbol string, openOrders []api.Order) (bool, error) {
+	if len(openOrders) == 0 {
+		log.Printf("no existing orders found for %s", symbol)
+		return false, nil
+	}
+	var buyOrders []BuyOrder
+	var sellOrder *SellOrder
+	for _, order := range openOrders {
+		if order.Side != "buy" && order.Side != "sell" {
+			continue
+		}
+		price, err := strconv.ParseFloat(order.Price, 64)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse order price: %w", err)
+		}
+		size, err := strconv.ParseFloat(order.Size, 64)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse order size: %w", err)
+		}
+		if order.Side == "buy" {
+			buyOrders = append(buyOrders, BuyOrder{
+				OrderId:     order.OrderId,
+				CoinPrice:   price,
+				OrderAmount: size * price,
+			})
+			continue
+		}
+		sellOrder = &SellOrder{
+			OrderId:     order.OrderId,
+			CoinPrice:   price,
+			OrderAmount: size,
+		}
+	}
+
+	// extra guard just to be safe
+	if len(buyOrders) == 0 && sellOrder == nil {
+		log.Print("Got orders from api but neither buy nor sell orders found")
+		return false, nil
+	}
+
+	l.BuyOrders = buyOrders
+	l.SellOrder = sellOrder
+	log.Printf("Synced existing trading process for %s", symbol)
+	return true, nil
+}
+
+// initialize sets up the buy orders of a new cycle
+func (l *Ladder) initialize(ctx *Context) error {
+	log.Printf("Initializing new trading process for %s", ctx.Symbol)
+	l.BuyOrders = nil
+	l.SellOrder = nil
+	l.anchorPrice = 0
+	volatilityPercent, err := l.volatilityPercent(ctx)
+	if err != nil {
+		return err
+	}
+	for _, buyOrderConfig := range l.params.BuyOrders {
+		coinPrice := buyOrderConfig.CoinPrice
+		if belowPercent := l.params.belowPercent(buyOrderConfig, volatilityPercent); belowPercent > 0 {
+			if l.anchorPrice == 0 {
+				currentPrice, err := ctx.CurrentPrice()
+				if err != nil {
+					return fmt.Errorf("Failed to get current price for %s: %w", ctx.Symbol, err)
+				}
+				l.anchorPrice = currentPrice
+				l.anchoredAt = ctx.Now()
+			}
+			currentPrice := l.anchorPrice
+			if belowPercent >= 100 {
+				return fmt.Errorf("buy order for %s would be %.2f%% below the price", ctx.Symbol, belowPercent)
+			}
+			coinPrice = currentPrice * (1 - belowPercent/100)
+		}
+		l.BuyOrders = append(l.BuyOrders, BuyOrder{
+			CoinPrice:   coinPrice,
+			OrderAmount: buyOrderConfig.OrderAmount,
+		})
+	}
+	return nil
+}
+
+func (l *Ladder) placeBuyOrders(ctx *Context) error {
+	for i, buyOrder := range l.BuyOrders {
+		if buyOrder.OrderId != "" {
+			log.Printf("Buy order for %s already placed with id %s", ctx.Symbol, buyOrder.OrderId)
+		}
+		price := buyOrder.CoinPrice
+		size := buyOrder.OrderAmount / price // Convert EUR amount to crypto amount
+		orderId, err := ctx.PlaceOrder("buy", price, size)
+		if err != nil {
+			return fmt.Errorf("failed to place buy order: %w", err)
+		}
+		l.BuyOrders[i].OrderId = orderId
+		log.Printf("Placed buy order %s for %s at price %.2f", orderId, ctx.Symbol, price)
+	}
+	return nil
+}
+
+func (l *Ladder) OnOrderUpdate(ctx *Context, order api.Order) error {
+	// ToDo(ME-07.02.25): Handle cancellation
+	price, err := strconv.ParseFloat(order.Price, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse order price: %w", err)
+	}
+	log.Printf("Dealing with order with id %s, status %s and side %s", order.OrderId, order.Status, order.Side)
+	if l.completed {
+		log.Printf("Trading process for %s already completed", ctx.Symbol)
+		return nil
+	}
+	if !l.orderWithIdExists(order.OrderId) {
+		log.Printf("Order with id %s is not in configured orders for trading process with symbol %s", order.OrderId, ctx.Symbol)
+		return nil
+	}
+
+	if order.Status == "filled" && order.Side == "buy" {
+		return l.handleBuyFill(ctx, order)
+	}
+
+	if order.Status == "filled" && order.Side == "sell" {
+		log.Printf("Sell order %s for %s filled at price %.2f filled", order.OrderId, ctx.Symbol, price)
+		l.accounting.close(ctx.Symbol, order)
+		log.Printf("Trading process for %s completed!", ctx.Symbol)
+		if !ctx.RepeatCycles() {
+			l.completed = true
+			return nil
+		}
+		l.restart(ctx)
+	}
+	return nil
+}
+
+// restart cancels the unfilled buy orders of the completed cycle and starts
+// a new one
+func (l *Ladder) restart(ctx *Context) {
+	for _, buyOrder := range l.BuyOrders {
+		if buyOrder.OrderId == "" || buyOrder.Filled {
+			continue
+		}
+		if err := ctx.CancelOrder(buyOrder.OrderId); err != nil {
+			log.Printf("Failed to cancel unfilled buy order %s: %v", buyOrder.OrderId, err)
+		}
+	}
+
+	log.Printf("Starting new cycle for %s", ctx.Symbol)
+	if err := l.startCycle(ctx); err != nil {
+		log.Printf("Failed to initialize new cycle for %s: %v", ctx.Symbol, err)
+		l.completed = true
+	}
+}
+
+func (l *Ladder) handleBuyFill(ctx *Context, order api.Order) error {
+	buyOrder := l.buyOrderWithId(order.OrderId)
+	if buyOrder != nil && buyOrder.Filled {
+		log.Printf("Fill of buy order %s already handled", order.OrderId)
+		return nil
+	}
+	log.Print("Buy order filled, waiting for the position update...")
+	position, err := ctx.PositionAfter(order)
+	if err != nil || position == nil {
+		return fmt.Errorf("failed to get position: %v", err)
+	}
+	if previousSellOrder := l.SellOrder; previousSellOrder != nil {
+		log.Printf("Attempting to cancel existing sell order %s for %s (price: %2.f)", previousSellOrder.OrderId, ctx.Symbol, previousSellOrder.CoinPrice)
+		if err := ctx.CancelOrder(previousSellOrder.OrderId); err != nil {
+			return fmt.Errorf("failed to cancel previous sell order: %w", err)
+		}
+		log.Print("Successfully cancelled previous sell order")
+	}
+	avgPrice, err := strconv.ParseFloat(position.OpenPriceAvg, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse average price: %w", err)
+	}
+	size, err := strconv.ParseFloat(position.Total, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse position size: %w", err)
+	}
+	log.Printf("Current position for %s: average price %.2f", ctx.Symbol, avgPrice)
+	sellPrice := avgPrice * (1 + l.sellTargetPercent(ctx)/100)
+	log.Printf("Attempting to place sell order for %s at price %.2f", ctx.Symbol, sellPrice)
+	sellOrderId, err := ctx.PlaceOrder("sell", sellPrice, size)
+	if err != nil {
+		return fmt.Errorf("failed to place sell order: %w", err)
+	}
+
+	log.Printf("Placed sell order %s for %s at price %.2f", sellOrderId, ctx.Symbol, sellPrice)
+	l.SellOrder = &SellOrder{
+		OrderId:     sellOrderId,
+		CoinPrice:   sellPrice,
+		OrderAmount: size,
+	}
+	if buyOrder != nil {
+		buyOrder.Filled = true
+	}
+	l.accounting.addBuy(order, position)
+	log.Printf("Updated sell order in order process")
+	return nil
+}
+
+// filledInCycle reports whether an order of the current cycle filled
+func (l *Ladder) filledInCycle() bool {
+	if l.SellOrder != nil {
+		return true
+	}
+	for _, buyOrder := range l.BuyOrders {
+		if buyOrder.Filled {
+			return true
+		}
+	}
+	return false
+}
+
+// repegReason returns why the buy orders should be placed again relative to
+// price, or "" if they should stay
+func (l *Ladder) repegReason(price float64, now time.Time) string {
+	repeg := l.params.Repeg
+	if repeg == nil || l.completed || l.waiting || len(l.BuyOrders) == 0 || l.filledInCycle() {
+		return ""
+	}
+	if repeg.DriftPercent > 0 && l.anchorPrice > 0 && price >= l.anchorPrice*(1+repeg.DriftPercent/100) {
+		return fmt.Sprintf("price %.2f drifted %.2f%% above %.2f", price, (price/l.anchorPrice-1)*100, l.anchorPrice)
+	}
+	timeout := time.Duration(repeg.TimeoutMinutes * float64(time.Minute))
+	if timeout > 0 && !l.anchoredAt.IsZero() && now.Sub(l.anchoredAt) >= timeout {
+		return fmt.Sprintf("nothing filled since %s", l.anchoredAt.Format(time.DateTime))
+	}
+	return ""
+}
+
+// repeg cancels the unfilled buy orders and starts the cycle again at the
+// current price
+func (l *Ladder) repeg(ctx *Context, reason string) error {
+	log.Printf("Repegging buy orders of %s: %s", ctx.Symbol, reason)
+	var remaining []BuyOrder
+	var cancelErr error
+	for _, buyOrder := range l.BuyOrders {
+		if buyOrder.OrderId == "" {
+			continue
+		}
+		if err := ctx.CancelOrder(buyOrder.OrderId); err != nil {
+			// the order may just have filled, keep it and the ones not
+			// cancelled yet so the fill is handled
+			remaining = append(remaining, buyOrder)
+			cancelErr = fmt.Errorf("failed to cancel buy order %s: %w", buyOrder.OrderId, err)
+		}
+	}
+	if cancelErr != nil {
+		l.BuyOrders = remaining
+		return cancelErr
+	}
+	return l.startCycle(ctx)
+}
+
+// PauseBuying cancels the unfilled buy orders, they stay part of the cycle
+// and are placed again by ResumeBuying
+func (l *Ladder) PauseBuying(ctx *Context) error {
+	var cancelErr error
+	for i, buyOrder := range l.BuyOrders {
+		if buyOrder.OrderId == "" || buyOrder.Filled {
+			continue
+		}
+		if err := ctx.CancelOrder(buyOrder.OrderId); err != nil {
+			cancelErr = fmt.Errorf("failed to cancel buy order %s: %w", buyOrder.OrderId, err)
+			continue
+		}
+		l.BuyOrders[i].OrderId = ""
+	}
+	return cancelErr
+}
+
+func (l *Ladder) ResumeBuying(ctx *Context) error {
+	if l.completed || l.waiting {
+		return nil
+	}
+	for i, buyOrder := range l.BuyOrders {
+		if buyOrder.OrderId != "" || buyOrder.Filled {
+			continue
+		}
+		size := buyOrder.OrderAmount / buyOrder.CoinPrice
+		orderId, err := ctx.PlaceOrder("buy", buyOrder.CoinPrice, size)
+		if err != nil {
+			return fmt.Errorf("failed to place buy order: %w", err)
+		}
+		l.BuyOrders[i].OrderId = orderId
+		log.Printf("Placed buy order %s for %s at price %.2f again", orderId, ctx.Symbol, buyOrder.CoinPrice)
+	}
+	return nil
+}
+
+// adoptAnchor starts the repeg clock of a ladder synced from a previous run,
+// whose anchor price is unknown. Ladders at fixed prices are never repegged.
+func (l *Ladder) adoptAnchor(price float64, now time.Time) {
+	relative := false
+	for _, buyOrder := range l.params.BuyOrders {
+		relative = relative || buyOrder.CoinPriceBelowPercent > 0 || buyOrder.VolatilityMultiple > 0
+	}
+	if relative && l.params.Repeg != nil && l.anchorPrice == 0 && len(l.BuyOrders) > 0 && !l.filledInCycle() {
+		l.anchorPrice = price
+		l.anchoredAt = now
+	}
+}
+
+func (l *Ladder) OnPrice(ctx *Context, price float64) error {
+	l.adoptAnchor(price, ctx.Now())
+	if reason := l.repegReason(price, ctx.Now()); reason != "" {
+		if err := l.repeg(ctx, reason); err != nil {
+			return fmt.Errorf("failed to repeg: %w", err)
+		}
+	}
+	return nil
+}
+
+func (l *Ladder) OnTimer(ctx *Context, now time.Time) error {
+	if l.completed {
+		return nil
+	}
+	if l.waiting {
+		if err := l.startCycle(ctx); err != nil {
+			return fmt.Errorf("failed to start cycle: %w", err)
+		}
+		return nil
+	}
+	if l.SellOrder != nil {
+		l.accounting.refreshFunding(ctx, now)
+	}
+	if l.params.Repeg == nil || l.params.Repeg.TimeoutMinutes <= 0 || l.filledInCycle() {
+		return nil
+	}
+	price, err := ctx.CurrentPrice()
+	if err != nil {
+		return fmt.Errorf("failed to get current price for %s: %w", ctx.Symbol, err)
+	}
+	l.adoptAnchor(price, now)
+	if reason := l.repegReason(price, now); reason != "" {
+		if err := l.repeg(ctx, reason); err != nil {
+			return fmt.Errorf("failed to repeg: %w", err)
+		}
+	}
+	return nil
+}
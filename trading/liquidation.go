@@ -0,0 +1,187 @@
+package trading
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"botcoin/api"
+	"botcoin/config"
+)
+
+var ErrBuyingPaused = errors.New("buying is paused")
+
+// liquidationGuard watches the distance of the position of a trading process
+// to its liquidation price on every timer
+type liquidationGuard struct {
+	config    config.LiquidationGuardConfig
+	alerted   bool
+	stateFile string // none in backtests and replays
+	guardState
+}
+
+// guardState is the margin added to the current position, persisted so
+// max_margin holds across restarts
+type guardState struct {
+	MarginAdded float64 `json:"margin_added"`
+	OpenedAt    string  `json:"opened_at"` // creation time of the current position
+}
+
+// liquidationStateFile returns the configured state file of the guard of symbol
+func liquidationStateFile(cfg config.LiquidationGuardConfig, symbol string) string {
+	if cfg.StateFile == "" {
+		return fmt.Sprintf("liquidation_%s.json", symbol)
+	}
+	return cfg.StateFile
+}
+
+// persist loads the state saved by a previous run and saves it to path from
+// now on
+func (g *liquidationGuard) persist(path string) error {
+	g.stateFile = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read liquidation guard state: %w", err)
+	}
+	if err := json.Unmarshal(data, &g.guardState); err != nil {
+		return fmt.Errorf("failed to parse liquidation guard state %s: %w", path, err)
+	}
+	return nil
+}
+
+func (g *liquidationGuard) save() {
+	if g.stateFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(g.guardState, "", "  ")
+	if err != nil {
+		log.Printf("Failed to encode liquidation guard state: %v", err)
+		return
+	}
+	tmp := g.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("Failed to save liquidation guard state: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, g.stateFile); err != nil {
+		log.Printf("Failed to save liquidation guard state: %v", err)
+	}
+}
+
+// liquidationDistance returns the distance of the mark price to the
+// liquidation price in percent of the mark price, false if the position has
+// no liquidation price
+func liquidationDistance(position *api.Position) (float64, bool) {
+	liquidation, err := strconv.ParseFloat(position.LiquidationPrice, 64)
+	if err != nil || liquidation <= 0 {
+		return 0, false
+	}
+	mark, err := strconv.ParseFloat(position.MarkPrice, 64)
+	if err != nil || mark <= 0 {
+		return 0, false
+	}
+	if position.HoldSide == "short" {
+		return (liquidation - mark) / mark * 100, true
+	}
+	return (mark - liquidation) / mark * 100, true
+}
+
+func (g *liquidationGuard) check(ctx *Context, strategy Strategy) {
+	position, err := ctx.Position()
+	if errors.Is(err, api.ErrNoPosition) {
+		position, err = nil, nil
+	}
+	if err != nil {
+		// the distance is unknown, keep the current state until the next check
+		log.Printf("Failed to check liquidation distance of %s: %v", ctx.Symbol, err)
+		return
+	}
+	if position == nil {
+		// no position, nothing can be liquidated
+		g.resume(ctx, strategy)
+		g.alerted = false
+		return
+	}
+	if position.CTime != g.OpenedAt {
+		g.OpenedAt = position.CTime
+		g.MarginAdded = 0
+		g.save()
+	}
+	distance, ok := liquidationDistance(position)
+	if !ok {
+		g.resume(ctx, strategy)
+		return
+	}
+
+	if g.config.AlertPercent > 0 {
+		if distance < g.config.AlertPercent && !g.alerted {
+			log.Printf("ALERT: %s position is %.2f%% from liquidation at %s (mark %s, margin ratio %s)",
+				ctx.Symbol, distance, position.LiquidationPrice, position.MarkPrice, position.MarginRatio)
+		}
+		g.alerted = distance < g.config.AlertPercent
+	}
+
+	if g.config.AddMarginPercent > 0 && distance < g.config.AddMarginPercent {
+		g.addMargin(ctx, position, distance)
+	}
+
+	if g.config.PausePercent > 0 && distance < g.config.PausePercent {
+		g.pause(ctx, strategy, distance)
+	} else {
+		g.resume(ctx, strategy)
+	}
+}
+
+func (g *liquidationGuard) addMargin(ctx *Context, position *api.Position, distance float64) {
+	if position.MarginMode != "isolated" {
+		return
+	}
+	amount := g.config.MarginAmount
+	if g.config.MaxMargin > 0 {
+		amount = min(amount, g.config.MaxMargin-g.MarginAdded)
+	}
+	if amount <= 0 {
+		return
+	}
+	if err := ctx.bot.client.AddMargin(ctx.Symbol, position.HoldSide, amount); err != nil {
+		log.Printf("Failed to add margin to %s position: %v", ctx.Symbol, err)
+		return
+	}
+	g.MarginAdded += amount
+	g.save()
+	log.Printf("Added %.2f margin to %s position %.2f%% from liquidation, %.2f added in total", amount, ctx.Symbol, distance, g.MarginAdded)
+}
+
+func (g *liquidationGuard) pause(ctx *Context, strategy Strategy, distance float64) {
+	if ctx.buyingPaused {
+		return
+	}
+	log.Printf("Pausing buy orders of %s, position is %.2f%% from liquidation", ctx.Symbol, distance)
+	ctx.buyingPaused = true
+	if pauser, ok := strategy.(BuyPauser); ok {
+		if err := pauser.PauseBuying(ctx); err != nil {
+			log.Printf("Failed to cancel buy orders of %s: %v", ctx.Symbol, err)
+		}
+	}
+}
+
+func (g *liquidationGuard) resume(ctx *Context, strategy Strategy) {
+	if !ctx.buyingPaused {
+		return
+	}
+	log.Printf("Resuming buy orders of %s", ctx.Symbol)
+	ctx.buyingPaused = false
+	if pauser, ok := strategy.(BuyPauser); ok {
+		if err := pauser.ResumeBuying(ctx); err != nil {
+			// stay paused, so the next check places the missing buy orders
+			log.Printf("Failed to place buy orders of %s again, retrying on the next check: %v", ctx.Symbol, err)
+			ctx.buyingPaused = true
+		}
+	}
+}
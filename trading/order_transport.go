@@ -0,0 +1,107 @@
+package trading
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"botcoin/api"
+)
+
+// orderPlacer places and cancels orders over a single transport
+type orderPlacer interface {
+	PlaceOrder(order api.LimitOrder) (string, error)
+	CancelOrder(symbol string, orderId string) error
+}
+
+// newOrderPlacer returns the order transport selected in the config
+func newOrderPlacer(transport string, client *api.Client, ws *api.WebsocketClient) (orderPlacer, error) {
+	switch transport {
+	case "", "rest":
+		return client, nil
+	case "websocket":
+		return &fallbackPlacer{primary: ws, fallback: client, lookup: client}, nil
+	}
+	return nil, fmt.Errorf("unknown order transport: %s", transport)
+}
+
+// orderLookup finds out whether a request sent over a failed transport
+// reached the exchange after all
+type orderLookup interface {
+	GetOrder(symbol, orderId string) (*api.Order, error)
+	GetOrderByClientOid(symbol, clientOid string) (*api.Order, error)
+}
+
+var clientOidCounter atomic.Int64
+
+// fallbackPlacer sends orders over the primary transport and retries over the
+// fallback if the primary fails for reasons other than the exchange rejecting
+// the request. A failed request may still have reached the exchange, so
+// orders carry a client order id that is looked up before and after retrying,
+// and cancelling an order that is already gone counts as success.
+type fallbackPlacer struct {
+	primary  orderPlacer
+	fallback orderPlacer
+	lookup   orderLookup
+}
+
+func (p *fallbackPlacer) PlaceOrder(order api.LimitOrder) (string, error) {
+	if order.ClientOid == "" {
+		order.ClientOid = "botcoin" + strconv.FormatInt(time.Now().UnixMilli(), 10) + "-" + strconv.FormatInt(clientOidCounter.Add(1), 10)
+	}
+	orderId, err := p.primary.PlaceOrder(order)
+	if err == nil || isRejection(err) {
+		return orderId, err
+	}
+	if placed, lookupErr := p.lookup.GetOrderByClientOid(order.Symbol, order.ClientOid); lookupErr == nil {
+		log.Printf("Placing order over websocket reported %v, but order %s was placed", err, placed.OrderId)
+		return placed.OrderId, nil
+	} else if !api.IsOrderNotFound(lookupErr) {
+		return "", fmt.Errorf("failed to place order over websocket (%v) and to look it up: %w", err, lookupErr)
+	}
+
+	log.Printf("Placing order over websocket failed, falling back to REST: %v", err)
+	orderId, err = p.fallback.PlaceOrder(order)
+	if err != nil && api.IsDuplicateClientOid(err) {
+		// the websocket request arrived after the lookup
+		placed, lookupErr := p.lookup.GetOrderByClientOid(order.Symbol, order.ClientOid)
+		if lookupErr != nil {
+			return "", fmt.Errorf("order %s rejected as duplicate, but not found: %w", order.ClientOid, lookupErr)
+		}
+		return placed.OrderId, nil
+	}
+	return orderId, err
+}
+
+func (p *fallbackPlacer) CancelOrder(symbol string, orderId string) error {
+	err := p.primary.CancelOrder(symbol, orderId)
+	if err == nil || isRejection(err) {
+		return err
+	}
+	log.Printf("Cancelling order over websocket failed, falling back to REST: %v", err)
+	err = p.fallback.CancelOrder(symbol, orderId)
+	if err == nil || !api.IsOrderNotFound(err) {
+		return err
+	}
+	// the websocket request may have cancelled the order already
+	order, lookupErr := p.lookup.GetOrder(symbol, orderId)
+	switch {
+	case lookupErr == nil && order.Status == "canceled":
+		return nil
+	case lookupErr == nil:
+		return fmt.Errorf("order %s is %s: %w", orderId, order.Status, err)
+	case api.IsOrderNotFound(lookupErr):
+		return nil
+	}
+	return err
+}
+
+// isRejection reports whether the exchange itself refused the request, in
+// which case retrying over another transport is pointless
+func isRejection(err error) bool {
+	var tradeErr *api.TradeError
+	return errors.As(err, &tradeErr)
+}
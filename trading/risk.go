@@ -0,0 +1,272 @@
+package trading
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"botcoin/api"
+	"botcoin/config"
+)
+
+var ErrRiskLimit = errors.New("risk limit reached")
+
+// riskManager enforces the account wide limits of all trading processes. It
+// is consulted before every order; orders are placed while it is locked so
+// that concurrent trading processes can't exceed a limit together. The state
+// the limits are checked against is fetched once and kept up to date with the
+// placed orders until an order update, a cancel or the timer invalidates it,
+// so a batch of orders costs no requests per order.
+type riskManager struct {
+	mu        sync.Mutex
+	config    config.RiskConfig
+	client    Exchange
+	symbols   []string
+	snapshot  *riskSnapshot            // nil when stale
+	contracts map[string]*api.Contract // by symbol, fetched once for downsizing
+}
+
+// riskSnapshot is the state of all symbols the limits are checked against
+type riskSnapshot struct {
+	exposures map[string]exposure
+	realized  float64   // pnl including fees of the orders filled since day
+	day       time.Time // midnight UTC
+}
+
+func newRiskManager(cfg config.RiskConfig, client Exchange, processes []config.TradingProcessConfig) *riskManager {
+	symbols := make([]string, 0, len(processes))
+	for _, process := range processes {
+		symbols = append(symbols, process.Symbol)
+	}
+	return &riskManager{config: cfg, client: client, symbols: symbols, contracts: make(map[string]*api.Contract)}
+}
+
+func (r *riskManager) enabled() bool {
+	return r.config.MaxTotalNotional > 0 || r.config.MaxSymbolNotional > 0 || r.config.MaxOpenPositions > 0 || r.config.MaxDailyLoss > 0
+}
+
+// exposure is the notional of a symbol's position plus the resting orders
+// that would increase it
+type exposure struct {
+	notional   float64
+	position   float64 // signed size, negative for shorts
+	unrealized float64
+}
+
+// open reports whether the symbol holds a position, resting orders don't count
+func (e exposure) open() bool {
+	return e.position != 0
+}
+
+// increases reports whether an order adds to the position instead of
+// reducing it
+func (e exposure) increases(side string) bool {
+	if side == "buy" {
+		return e.position >= 0
+	}
+	return e.position <= 0
+}
+
+func parseFloat(value string) float64 {
+	f, _ := strconv.ParseFloat(value, 64)
+	return f
+}
+
+func (r *riskManager) exposure(symbol string) (exposure, error) {
+	var e exposure
+	position, err := r.client.GetPosition(symbol)
+	if err != nil && !errors.Is(err, api.ErrNoPosition) {
+		return e, fmt.Errorf("failed to get position of %s: %w", symbol, err)
+	}
+	if err == nil && position != nil {
+		size := parseFloat(position.Total)
+		if position.HoldSide == "short" {
+			size = -size
+		}
+		price := parseFloat(position.MarkPrice)
+		if price == 0 {
+			price = parseFloat(position.OpenPriceAvg)
+		}
+		e.position = size
+		e.notional = math.Abs(size) * price
+		e.unrealized = parseFloat(position.UnrealizedPL)
+	}
+	orders, err := r.client.GetPendingOrders(symbol)
+	if err != nil {
+		return e, fmt.Errorf("failed to get pending orders of %s: %w", symbol, err)
+	}
+	for _, order := range orders {
+		if e.increases(order.Side) {
+			e.notional += parseFloat(order.Price) * parseFloat(order.Size)
+		}
+	}
+	return e, nil
+}
+
+// realizedPnl returns the pnl including fees of the orders filled since
+// the given time
+func (r *riskManager) realizedPnl(since time.Time) (float64, error) {
+	var pnl float64
+	for _, symbol := range r.symbols {
+		orders, err := r.client.GetFilledOrders(symbol, since)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get filled orders of %s: %w", symbol, err)
+		}
+		for _, order := range orders {
+			if order.Status != "filled" {
+				continue
+			}
+			pnl += parseFloat(order.Pnl) - orderFee(order)
+		}
+	}
+	return pnl, nil
+}
+
+// current returns the snapshot the limits are checked against, fetching it
+// if it is stale or from another day
+func (r *riskManager) current(now time.Time) (*riskSnapshot, error) {
+	day := now.UTC().Truncate(24 * time.Hour)
+	if r.snapshot != nil && r.snapshot.day.Equal(day) {
+		return r.snapshot, nil
+	}
+	snapshot := &riskSnapshot{exposures: make(map[string]exposure, len(r.symbols)), day: day}
+	for _, symbol := range r.symbols {
+		e, err := r.exposure(symbol)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.exposures[symbol] = e
+	}
+	if r.config.MaxDailyLoss > 0 {
+		realized, err := r.realizedPnl(day)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.realized = realized
+	}
+	r.snapshot = snapshot
+	return snapshot, nil
+}
+
+// invalidate makes the next check fetch the state again, e.g. after fills
+func (r *riskManager) invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.snapshot = nil
+}
+
+// dailyLoss returns the realized loss including fees of the orders filled
+// since midnight UTC plus the unrealized loss of the open positions
+func (s *riskSnapshot) dailyLoss() float64 {
+	pnl := s.realized
+	for _, e := range s.exposures {
+		pnl += e.unrealized
+	}
+	return -pnl
+}
+
+func (r *riskManager) contract(symbol string) (*api.Contract, error) {
+	if contract, ok := r.contracts[symbol]; ok {
+		return contract, nil
+	}
+	contract, err := r.client.GetContract(symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract of %s: %w", symbol, err)
+	}
+	r.contracts[symbol] = contract
+	return contract, nil
+}
+
+// check returns the size an order may be placed with, or an error wrapping
+// ErrRiskLimit with the reason
+func (r *riskManager) check(symbol, side string, price, size float64, now time.Time) (float64, error) {
+	snapshot, err := r.current(now)
+	if err != nil {
+		return 0, err
+	}
+	exposures := snapshot.exposures
+	current := exposures[symbol]
+	if !current.increases(side) {
+		// reducing orders only lower the risk
+		return size, nil
+	}
+
+	if r.config.MaxDailyLoss > 0 {
+		if loss := snapshot.dailyLoss(); loss >= r.config.MaxDailyLoss {
+			return 0, fmt.Errorf("%w: daily loss %.2f reached the maximum of %.2f", ErrRiskLimit, loss, r.config.MaxDailyLoss)
+		}
+	}
+
+	if r.config.MaxOpenPositions > 0 && !current.open() {
+		open := 0
+		for _, e := range exposures {
+			if e.open() {
+				open++
+			}
+		}
+		if open >= r.config.MaxOpenPositions {
+			return 0, fmt.Errorf("%w: %d of at most %d positions open", ErrRiskLimit, open, r.config.MaxOpenPositions)
+		}
+	}
+
+	room := math.Inf(1)
+	if r.config.MaxSymbolNotional > 0 {
+		room = math.Min(room, r.config.MaxSymbolNotional-current.notional)
+	}
+	if r.config.MaxTotalNotional > 0 {
+		var total float64
+		for _, e := range exposures {
+			total += e.notional
+		}
+		room = math.Min(room, r.config.MaxTotalNotional-total)
+	}
+	notional := price * size
+	if notional <= room {
+		return size, nil
+	}
+	if !r.config.Downsize || room <= 0 {
+		return 0, fmt.Errorf("%w: order notional %.2f exceeds the remaining %.2f", ErrRiskLimit, notional, math.Max(room, 0))
+	}
+	contract, err := r.contract(symbol)
+	if err != nil {
+		return 0, err
+	}
+	downsized := contract.RoundSize(room / price)
+	if downsized <= 0 || downsized < contract.MinTradeNum {
+		return 0, fmt.Errorf("%w: order notional %.2f exceeds the remaining %.2f, which is below the minimum order size of %s", ErrRiskLimit, notional, room, symbol)
+	}
+	return downsized, nil
+}
+
+// place places an order through place once the limits allow it
+func (r *riskManager) place(symbol, side string, price, size float64, now time.Time, place func(size float64) (string, error)) (string, error) {
+	if !r.enabled() {
+		return place(size)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	allowed, err := r.check(symbol, side, price, size, now)
+	if err != nil {
+		log.Printf("Rejected %s order for %s at %.2f: %v", side, symbol, price, err)
+		return "", err
+	}
+	if allowed < size {
+		log.Printf("Downsized %s order for %s at %.2f from %.6f to %.6f to stay within the risk limits", side, symbol, price, size, allowed)
+	}
+	orderId, err := place(allowed)
+	if err != nil {
+		// the order may have been placed anyway, e.g. after a timeout
+		r.snapshot = nil
+		return "", err
+	}
+	if e := r.snapshot.exposures[symbol]; e.increases(side) {
+		e.notional += price * allowed
+		r.snapshot.exposures[symbol] = e
+	}
+	return orderId, nil
+}
@@ -0,0 +1,201 @@
+package trading
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"botcoin/api"
+	"botcoin/config"
+)
+
+// stubExchange answers with canned positions and orders and records what is
+// sent to it
+type stubExchange struct {
+	positions   map[string][]api.Position
+	positionErr map[string]error
+	pending     map[string][]api.Order
+	filled      map[string][]api.Order
+	contract    api.Contract
+	sent        []string
+}
+
+func (s *stubExchange) GetCurrentPrice(symbol string) (float64, error) { return 100, nil }
+
+func (s *stubExchange) GetPosition(symbol string) (*api.Position, error) {
+	if err := s.positionErr[symbol]; err != nil {
+		return nil, err
+	}
+	if len(s.positions[symbol]) == 0 {
+		return nil, api.ErrNoPosition
+	}
+	return &s.positions[symbol][0], nil
+}
+
+func (s *stubExchange) GetPositions(symbol string) ([]api.Position, error) {
+	if err := s.positionErr[symbol]; err != nil {
+		return nil, err
+	}
+	return s.positions[symbol], nil
+}
+
+func (s *stubExchange) GetPendingOrders(symbol string) ([]api.Order, error) {
+	return s.pending[symbol], nil
+}
+
+func (s *stubExchange) GetOrderHistory(symbol string, since time.Time) ([]api.Order, error) {
+	return nil, nil
+}
+
+func (s *stubExchange) GetFilledOrders(symbol string, since time.Time) ([]api.Order, error) {
+	return s.filled[symbol], nil
+}
+
+func (s *stubExchange) GetCandles(symbol, granularity string, start, end time.Time) ([]api.Candle, error) {
+	return nil, nil
+}
+
+func (s *stubExchange) GetCurrentFundingRate(symbol string) (float64, error) { return 0, nil }
+
+func (s *stubExchange) GetNextFundingTime(symbol string) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (s *stubExchange) GetContract(symbol string) (*api.Contract, error) {
+	contract := s.contract
+	contract.Symbol = symbol
+	return &contract, nil
+}
+
+func (s *stubExchange) AddMargin(symbol, holdSide string, amount float64) error { return nil }
+
+func (s *stubExchange) PlaceMarketOrder(symbol, side string, size float64, reduceOnly bool) (string, error) {
+	s.sent = append(s.sent, fmt.Sprintf("market %s %s %v reduce only %v", symbol, side, size, reduceOnly))
+	return "market", nil
+}
+
+func (s *stubExchange) FlashClose(symbol, holdSide string) error {
+	s.sent = append(s.sent, fmt.Sprintf("flash close %s %s", symbol, holdSide))
+	return nil
+}
+
+func (s *stubExchange) PlaceOrder(order api.LimitOrder) (string, error) {
+	s.sent = append(s.sent, fmt.Sprintf("limit %s %s %v at %v", order.Symbol, order.Side, order.Size, order.Price))
+	return "limit", nil
+}
+
+func (s *stubExchange) CancelOrder(symbol string, orderId string) error {
+	s.sent = append(s.sent, fmt.Sprintf("cancel %s %s", symbol, orderId))
+	return nil
+}
+
+func long(size, price string) []api.Position {
+	return []api.Position{{HoldSide: "long", Total: size, MarkPrice: price, OpenPriceAvg: price, PosMode: "one_way_mode"}}
+}
+
+func buyOrder(id, price, size string) api.Order {
+	return api.Order{OrderId: id, Side: "buy", Price: price, Size: size, Status: "live"}
+}
+
+func filledOrder(pnl, fee string) api.Order {
+	return api.Order{Side: "sell", Status: "filled", Pnl: pnl, FillFee: fee}
+}
+
+func TestRiskCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   config.RiskConfig
+		exchange stubExchange
+		side     string
+		size     float64 // at a price of 100
+		want     float64
+		wantErr  error
+	}{
+		{"within the limit", config.RiskConfig{MaxSymbolNotional: 1000},
+			stubExchange{positions: map[string][]api.Position{"BTCUSDT": long("5", "100")}}, "buy", 5, 5, nil},
+		{"over the limit", config.RiskConfig{MaxSymbolNotional: 1000},
+			stubExchange{positions: map[string][]api.Position{"BTCUSDT": long("5", "100")}}, "buy", 8, 0, ErrRiskLimit},
+		{"resting orders count", config.RiskConfig{MaxTotalNotional: 1000},
+			stubExchange{pending: map[string][]api.Order{"ETHUSDT": {buyOrder("1", "100", "6")}}}, "buy", 5, 0, ErrRiskLimit},
+		{"reducing order always allowed", config.RiskConfig{MaxSymbolNotional: 100},
+			stubExchange{positions: map[string][]api.Position{"BTCUSDT": long("5", "100")}}, "sell", 20, 20, nil},
+
+		{"downsized to the size step", config.RiskConfig{MaxSymbolNotional: 1000, Downsize: true},
+			stubExchange{positions: map[string][]api.Position{"BTCUSDT": long("5", "100")}, contract: api.Contract{SizeStep: 0.3}}, "buy", 8, 4.8, nil},
+		{"downsized without size rules", config.RiskConfig{MaxSymbolNotional: 1000, Downsize: true},
+			stubExchange{positions: map[string][]api.Position{"BTCUSDT": long("5", "100")}}, "buy", 8, 5, nil},
+		{"downsized below the minimum", config.RiskConfig{MaxSymbolNotional: 1000, Downsize: true},
+			stubExchange{positions: map[string][]api.Position{"BTCUSDT": long("5", "100")}, contract: api.Contract{MinTradeNum: 6}}, "buy", 8, 0, ErrRiskLimit},
+		{"downsized below one size step", config.RiskConfig{MaxSymbolNotional: 1000, Downsize: true},
+			stubExchange{positions: map[string][]api.Position{"BTCUSDT": long("9.95", "100")}, contract: api.Contract{SizeStep: 0.1}}, "buy", 1, 0, ErrRiskLimit},
+
+		{"daily loss from filled orders", config.RiskConfig{MaxDailyLoss: 50},
+			stubExchange{filled: map[string][]api.Order{"BTCUSDT": {filledOrder("-30", "-1")}, "ETHUSDT": {filledOrder("-15", "-4")}}}, "buy", 1, 0, ErrRiskLimit},
+		{"daily loss below the maximum", config.RiskConfig{MaxDailyLoss: 50},
+			stubExchange{filled: map[string][]api.Order{"BTCUSDT": {filledOrder("-30", "-1"), filledOrder("10", "-1")}}}, "buy", 1, 1, nil},
+		{"daily loss ignores unfilled orders", config.RiskConfig{MaxDailyLoss: 50},
+			stubExchange{filled: map[string][]api.Order{"BTCUSDT": {{Status: "canceled", Pnl: "-100"}}}}, "buy", 1, 1, nil},
+		{"daily loss includes unrealized", config.RiskConfig{MaxDailyLoss: 50},
+			stubExchange{
+				positions: map[string][]api.Position{"ETHUSDT": {{HoldSide: "long", Total: "1", MarkPrice: "60", UnrealizedPL: "-40"}}},
+				filled:    map[string][]api.Order{"ETHUSDT": {filledOrder("-5", "-5")}},
+			}, "buy", 1, 0, ErrRiskLimit},
+
+		{"open positions below the maximum", config.RiskConfig{MaxOpenPositions: 1},
+			stubExchange{pending: map[string][]api.Order{"ETHUSDT": {buyOrder("1", "100", "1")}}}, "buy", 1, 1, nil},
+		{"open positions at the maximum", config.RiskConfig{MaxOpenPositions: 1},
+			stubExchange{positions: map[string][]api.Position{"ETHUSDT": long("1", "100")}}, "buy", 1, 0, ErrRiskLimit},
+		{"adding to an open position", config.RiskConfig{MaxOpenPositions: 1},
+			stubExchange{positions: map[string][]api.Position{"BTCUSDT": long("1", "100")}}, "buy", 1, 1, nil},
+	}
+	processes := []config.TradingProcessConfig{{Symbol: "BTCUSDT"}, {Symbol: "ETHUSDT"}}
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRiskManager(tt.config, &tt.exchange, processes)
+			got, err := r.check("BTCUSDT", tt.side, 100, tt.size, now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("size = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRiskFailsClosed(t *testing.T) {
+	exchange := &stubExchange{positionErr: map[string]error{"ETHUSDT": errors.New("timeout")}}
+	r := newRiskManager(config.RiskConfig{MaxTotalNotional: 1000}, exchange, []config.TradingProcessConfig{{Symbol: "BTCUSDT"}, {Symbol: "ETHUSDT"}})
+	placed := false
+	_, err := r.place("BTCUSDT", "buy", 100, 1, time.Now(), func(size float64) (string, error) {
+		placed = true
+		return "1", nil
+	})
+	if err == nil || errors.Is(err, ErrRiskLimit) {
+		t.Errorf("err = %v, want the failed position request", err)
+	}
+	if placed {
+		t.Error("order placed while the position was unknown")
+	}
+}
+
+func TestRiskPlaceAddsToExposure(t *testing.T) {
+	exchange := &stubExchange{}
+	r := newRiskManager(config.RiskConfig{MaxSymbolNotional: 250}, exchange, []config.TradingProcessConfig{{Symbol: "BTCUSDT"}})
+	place := func(size float64) (string, error) { return "1", nil }
+	now := time.Now()
+	for i, wantErr := range []error{nil, nil, ErrRiskLimit} {
+		if _, err := r.place("BTCUSDT", "buy", 100, 1, now, place); !errors.Is(err, wantErr) {
+			t.Errorf("order %d: err = %v, want %v", i+1, err, wantErr)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package trading
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"botcoin/api"
+	"botcoin/config"
+)
+
+const defaultStrategy = "ladder"
+
+// Strategy decides the orders of one trading process. The bot calls its
+// methods one at a time, so implementations need no locking of their own.
+type Strategy interface {
+	// OnStart is called once when the bot starts with the open orders of the
+	// symbol, e.g. to adopt the orders of a previous run
+	OnStart(ctx *Context, openOrders []api.Order) error
+	// OnOrderUpdate is called for every order update of the symbol, including
+	// updates replayed after a websocket reconnect
+	OnOrderUpdate(ctx *Context, order api.Order) error
+	// OnPrice is called with the latest price of the symbol
+	OnPrice(ctx *Context, price float64) error
+	// OnTimer is called periodically
+	OnTimer(ctx *Context, now time.Time) error
+}
+
+// BuyPauser is implemented by strategies that can take back their resting
+// buy orders while buying is paused, e.g. by the liquidation guard
+type BuyPauser interface {
+	// PauseBuying cancels the resting buy orders
+	PauseBuying(ctx *Context) error
+	// ResumeBuying places the buy orders cancelled by PauseBuying again
+	ResumeBuying(ctx *Context) error
+}
+
+// persister is implemented by strategies keeping state in a file across
+// restarts. Only the live bot enables it, simulated bots never touch the
+// files of a running bot.
+type persister interface {
+	persist()
+}
+
+// StrategyFactory creates a strategy for a trading process from its config,
+// strategy specific parameters are found in cfg.Params
+type StrategyFactory func(cfg config.TradingProcessConfig) (Strategy, error)
+
+var (
+	strategiesMu sync.Mutex
+	strategies   = make(map[string]StrategyFactory)
+)
+
+// RegisterStrategy makes a strategy available under name, usually from the
+// init function of the file implementing it
+func RegisterStrategy(name string, factory StrategyFactory) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	if _, exists := strategies[name]; exists {
+		panic("strategy registered twice: " + name)
+	}
+	strategies[name] = factory
+}
+
+// Strategies returns the names of all registered strategies
+func Strategies() []string {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	names := make([]string, 0, len(strategies))
+	for name := range strategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewStrategy creates the strategy configured for a trading process
+func NewStrategy(cfg config.TradingProcessConfig) (Strategy, error) {
+	name := cfg.Strategy
+	if name == "" {
+		name = defaultStrategy
+	}
+	strategiesMu.Lock()
+	factory, ok := strategies[name]
+	strategiesMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q for %s, available: %v", name, cfg.Symbol, Strategies())
+	}
+	strategy, err := factory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s strategy for %s: %w", name, cfg.Symbol, err)
+	}
+	return strategy, nil
+}
+
+// Context gives a strategy access to the exchange for the symbol of its
+// trading process
+type Context struct {
+	Symbol string
+	bot    *Bot
+	// buyingPaused rejects buy orders, e.g. while the position is close to
+	// liquidation
+	buyingPaused bool
+}
+
+// Now returns the time of the bot, which is simulated in backtests and replays
+func (c *Context) Now() time.Time {
+	return c.bot.clock.Now()
+}
+
+func (c *Context) CurrentPrice() (float64, error) {
+	return c.bot.client.GetCurrentPrice(c.Symbol)
+}
+
+func (c *Context) Position() (*api.Position, error) {
+	return c.bot.client.GetPosition(c.Symbol)
+}
+
+// PositionAfter returns the position once the given order fill is reflected
+// in it, preferring the pushed position over polling the exchange
+func (c *Context) PositionAfter(order api.Order) (*api.Position, error) {
+	return c.bot.currentPosition(&order)
+}
+
+func (c *Context) PendingOrders() ([]api.Order, error) {
+	return c.bot.client.GetPendingOrders(c.Symbol)
+}
+
+// OrderHistory returns the orders of the symbol created since the given time
+func (c *Context) OrderHistory(since time.Time) ([]api.Order, error) {
+	return c.bot.client.GetOrderHistory(c.Symbol, since)
+}
+
+// FilledOrders returns the orders of the symbol filled since the given time,
+// including orders created before it
+func (c *Context) FilledOrders(since time.Time) ([]api.Order, error) {
+	return c.bot.client.GetFilledOrders(c.Symbol, since)
+}
+
+// Candles returns the last count closed candles of the given granularity
+func (c *Context) Candles(granularity string, count int) ([]api.Candle, error) {
+	interval, err := api.GranularityDuration(granularity)
+	if err != nil {
+		return nil, err
+	}
+	end := c.Now().Truncate(interval)
+	candles, err := c.bot.client.GetCandles(c.Symbol, granularity, end.Add(-time.Duration(count)*interval), end)
+	if err != nil {
+		return nil, err
+	}
+	if len(candles) > count {
+		candles = candles[len(candles)-count:]
+	}
+	return candles, nil
+}
+
+// FundingRate returns the funding rate of the next settlement, paid by longs
+// if positive
+func (c *Context) FundingRate() (float64, error) {
+	return c.bot.client.GetCurrentFundingRate(c.Symbol)
+}
+
+func (c *Context) NextFundingTime() (time.Time, error) {
+	return c.bot.client.GetNextFundingTime(c.Symbol)
+}
+
+// BuyingPaused reports whether buy orders are rejected with ErrBuyingPaused
+func (c *Context) BuyingPaused() bool {
+	return c.buyingPaused
+}
+
+// RepeatCycles reports whether strategies start over once their cycle
+// completed
+func (c *Context) RepeatCycles() bool {
+	return c.bot.repeatCycles
+}
+
+// PlaceOrder places a limit order and returns its id
+func (c *Context) PlaceOrder(side string, price, size float64) (string, error) {
+	if side == "buy" && c.buyingPaused {
+		return "", ErrBuyingPaused
+	}
+	return c.bot.risk.place(c.Symbol, side, price, size, c.Now(), func(size float64) (string, error) {
+		return c.bot.orders.PlaceOrder(api.LimitOrder{
+			Symbol: c.Symbol,
+			Side:   side,
+			Price:  price,
+			Size:   size,
+		})
+	})
+}
+
+func (c *Context) CancelOrder(orderId string) error {
+	err := c.bot.orders.CancelOrder(c.Symbol, orderId)
+	c.bot.risk.invalidate()
+	return err
+}